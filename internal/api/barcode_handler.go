@@ -0,0 +1,225 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type barcodeRequest struct {
+	Code      string `json:"code"`
+	Symbology string `json:"symbology"`
+	Unit      string `json:"unit"`
+}
+
+type BarcodeHandler struct {
+	barcodeStore  store.BarcodeStore
+	itemStore     store.ItemStore
+	unitStore     store.UnitStore
+	locationStore store.LocationStore
+	logger        *log.Logger
+}
+
+func NewBarcodeHandler(barcodeStore store.BarcodeStore, itemStore store.ItemStore, unitStore store.UnitStore, locationStore store.LocationStore, logger *log.Logger) *BarcodeHandler {
+	return &BarcodeHandler{
+		barcodeStore:  barcodeStore,
+		itemStore:     itemStore,
+		unitStore:     unitStore,
+		locationStore: locationStore,
+		logger:        logger,
+	}
+}
+
+func (bh *BarcodeHandler) HandleCreateBarcode(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	item, ok := loadItem(w, r, bh.itemStore, bh.logger, user)
+	if !ok {
+		return
+	}
+
+	var req barcodeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		bh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	barcode := &store.Barcode{
+		OrganizationID: item.OrganizationID,
+		ItemID:         item.ID,
+		Code:           strings.TrimSpace(req.Code),
+		Symbology:      req.Symbology,
+		Unit:           item.BaseUnit,
+	}
+
+	// Without a symbology, numeric codes of GTIN length are taken as GTINs
+	// and anything else as an internal code.
+	if barcode.Symbology == "" {
+		switch len(barcode.Code) {
+		case 12:
+			barcode.Symbology = store.BarcodeTypeUPCA
+		case 13:
+			barcode.Symbology = store.BarcodeTypeEAN13
+		case 14:
+			barcode.Symbology = store.BarcodeTypeGTIN14
+		}
+
+		if store.ValidateBarcode(barcode.Symbology, barcode.Code) != nil {
+			barcode.Symbology = store.BarcodeTypeInternal
+		}
+	}
+
+	if err := store.ValidateBarcode(barcode.Symbology, barcode.Code); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if req.Unit != "" && req.Unit != item.BaseUnit {
+		units, err := bh.unitStore.GetItemUnits(item.ID)
+		if err != nil {
+			bh.logger.Printf("Error fetching units: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch units"})
+			return
+		}
+
+		for _, unit := range units {
+			if unit.Name == req.Unit {
+				barcode.UnitID = &unit.ID
+				barcode.Unit = unit.Name
+			}
+		}
+
+		if barcode.UnitID == nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": store.ErrUnknownUnit.Error()})
+			return
+		}
+	}
+
+	createdBarcode, err := bh.barcodeStore.CreateBarcode(barcode)
+	if err != nil {
+		if errors.Is(err, store.ErrBarcodeTaken) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Barcode is already assigned to an item"})
+			return
+		}
+
+		bh.logger.Printf("Error creating barcode: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create barcode"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdBarcode})
+}
+
+func (bh *BarcodeHandler) HandleGetItemBarcodes(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	item, ok := loadItem(w, r, bh.itemStore, bh.logger, user)
+	if !ok {
+		return
+	}
+
+	barcodes, err := bh.barcodeStore.GetItemBarcodes(item.ID)
+	if err != nil {
+		bh.logger.Printf("Error fetching barcodes: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch barcodes"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": barcodes, "count": len(barcodes)})
+}
+
+func (bh *BarcodeHandler) HandleDeleteBarcode(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	item, ok := loadItem(w, r, bh.itemStore, bh.logger, user)
+	if !ok {
+		return
+	}
+
+	barcodeID, err := uuid.Parse(chi.URLParam(r, "barcodeID"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid barcode ID"})
+		return
+	}
+
+	err = bh.barcodeStore.DeleteBarcode(item.ID, barcodeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Barcode not found"})
+		return
+	}
+
+	if err != nil {
+		bh.logger.Printf("Error deleting barcode: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete barcode"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (bh *BarcodeHandler) HandleScan(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	var locationID *uuid.UUID
+	if value := r.URL.Query().Get("location_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location_id must be a valid UUID"})
+			return
+		}
+
+		location, err := bh.locationStore.GetLocationByID(id)
+		if err != nil {
+			bh.logger.Printf("Error retrieving location: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve location"})
+			return
+		}
+
+		if location == nil || location.OrganizationID != user.OrganizationID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location_id does not reference a known location"})
+			return
+		}
+		locationID = &id
+	}
+
+	result, err := bh.barcodeStore.ScanBarcode(user.OrganizationID, strings.TrimSpace(chi.URLParam(r, "code")), locationID)
+	if err != nil {
+		bh.logger.Printf("Error scanning barcode: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to look up barcode"})
+		return
+	}
+
+	if result == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Barcode not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": result})
+}
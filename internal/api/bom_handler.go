@@ -0,0 +1,288 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type bomRequest struct {
+	ItemID     uuid.UUID `json:"item_id"`
+	Notes      *string   `json:"notes"`
+	Components []struct {
+		ItemID   uuid.UUID `json:"item_id"`
+		Quantity float64   `json:"quantity"`
+		Unit     string    `json:"unit"`
+	} `json:"components"`
+}
+
+type BOMHandler struct {
+	bomStore  store.BOMStore
+	itemStore store.ItemStore
+	unitStore store.UnitStore
+	logger    *log.Logger
+}
+
+func NewBOMHandler(bomStore store.BOMStore, itemStore store.ItemStore, unitStore store.UnitStore, logger *log.Logger) *BOMHandler {
+	return &BOMHandler{
+		bomStore:  bomStore,
+		itemStore: itemStore,
+		unitStore: unitStore,
+		logger:    logger,
+	}
+}
+
+func (bh *BOMHandler) HandleCreateBOM(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	bom, ok := bh.decodeBOM(w, r, user)
+	if !ok {
+		return
+	}
+	bom.OrganizationID = user.OrganizationID
+
+	createdBOM, err := bh.bomStore.CreateBOM(bom)
+	if err != nil {
+		bh.logger.Printf("Error creating bill of materials: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create bill of materials"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdBOM})
+}
+
+func (bh *BOMHandler) HandleGetBOMByID(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	bom, ok := bh.loadBOM(w, r, user)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": bom})
+}
+
+func (bh *BOMHandler) HandleUpdateBOM(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingBOM, ok := bh.loadBOM(w, r, user)
+	if !ok {
+		return
+	}
+
+	bom, ok := bh.decodeBOM(w, r, user)
+	if !ok {
+		return
+	}
+
+	if bom.ItemID != existingBOM.ItemID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "item_id cannot be changed"})
+		return
+	}
+	bom.ID = existingBOM.ID
+	bom.OrganizationID = existingBOM.OrganizationID
+
+	updatedBOM, err := bh.bomStore.UpdateBOM(bom)
+	if err != nil {
+		bh.logger.Printf("Error updating bill of materials: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update bill of materials"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updatedBOM})
+}
+
+func (bh *BOMHandler) HandleDeleteBOM(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingBOM, ok := bh.loadBOM(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := bh.bomStore.DeleteBOM(existingBOM.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Bill of materials not found"})
+		case errors.Is(err, store.ErrBOMInUse):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Bill of materials has work orders"})
+		default:
+			bh.logger.Printf("Error deleting bill of materials: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete bill of materials"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (bh *BOMHandler) HandleGetBOMsByOrganization(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := bh.bomStore.GetBOMsByOrganization(params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		bh.logger.Printf("Error fetching bills of materials: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch bills of materials"})
+		return
+	}
+
+	totalBOMs, err := bh.bomStore.CountBOMsByOrganization(user.OrganizationID)
+	if err != nil {
+		bh.logger.Printf("Error counting bills of materials: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count bills of materials"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalBOMs))
+}
+
+// decodeBOM reads a create or update payload and checks that the finished item
+// and every component belong to the caller's organization.
+func (bh *BOMHandler) decodeBOM(w http.ResponseWriter, r *http.Request, user *store.User) (*store.BOM, bool) {
+	var req bomRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		bh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return nil, false
+	}
+
+	if err := bh.validateBOMRequest(&req); err != nil {
+		bh.logger.Printf("Validation error: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	bom := &store.BOM{
+		ItemID:     req.ItemID,
+		Notes:      req.Notes,
+		Components: make([]store.BOMComponent, 0, len(req.Components)),
+	}
+
+	itemIDs := []uuid.UUID{req.ItemID}
+	for _, component := range req.Components {
+		itemIDs = append(itemIDs, component.ItemID)
+	}
+
+	for _, itemID := range itemIDs {
+		itemOrgID, err := bh.itemStore.GetItemOrgID(itemID)
+		if err != nil {
+			bh.logger.Printf("Error retrieving item: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+			return nil, false
+		}
+
+		if itemOrgID != user.OrganizationID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "item_id does not reference a known item"})
+			return nil, false
+		}
+	}
+
+	for _, component := range req.Components {
+		quantity, ok := baseQuantity(w, bh.unitStore, bh.logger, component.ItemID, component.Unit, component.Quantity)
+		if !ok {
+			return nil, false
+		}
+
+		bom.Components = append(bom.Components, store.BOMComponent{
+			ItemID:   component.ItemID,
+			Quantity: quantity,
+		})
+	}
+
+	return bom, true
+}
+
+func (bh *BOMHandler) loadBOM(w http.ResponseWriter, r *http.Request, user *store.User) (*store.BOM, bool) {
+	bomID, err := utils.ReadIDParam(r)
+	if err != nil {
+		bh.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return nil, false
+	}
+
+	bom, err := bh.bomStore.GetBOMByID(*bomID)
+	if err != nil {
+		bh.logger.Printf("Error retrieving bill of materials: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve bill of materials"})
+		return nil, false
+	}
+
+	if bom == nil || bom.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Bill of materials not found"})
+		return nil, false
+	}
+
+	return bom, true
+}
+
+func (bh *BOMHandler) validateBOMRequest(req *bomRequest) error {
+	if req.ItemID == uuid.Nil {
+		return errors.New("item_id is required")
+	}
+
+	if len(req.Components) == 0 {
+		return errors.New("components cannot be empty")
+	}
+
+	seen := make(map[uuid.UUID]bool, len(req.Components))
+	for _, component := range req.Components {
+		if component.ItemID == uuid.Nil {
+			return errors.New("item_id is required for components")
+		}
+
+		if component.ItemID == req.ItemID {
+			return errors.New("an item cannot be a component of itself")
+		}
+
+		if component.Quantity <= 0 {
+			return errors.New("quantity must be greater than zero for components")
+		}
+
+		if seen[component.ItemID] {
+			return errors.New("each component may only appear once per bill of materials")
+		}
+		seen[component.ItemID] = true
+	}
+
+	return nil
+}
@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
 	"kabancount/internal/store"
 	"kabancount/internal/utils"
 	"log"
 	"net/http"
+
+	"github.com/google/uuid"
 )
 
 type CategoryHandler struct {
@@ -46,6 +49,10 @@ func (ch *CategoryHandler) HandleCreateCategory(w http.ResponseWriter, r *http.R
 	}
 	req.OrganizationID = user.OrganizationID
 
+	if !ch.checkParent(w, req.ParentID, user.OrganizationID) {
+		return
+	}
+
 	createdCategory, err := ch.categoryStore.CreateCategory(&req)
 	if err != nil {
 		ch.logger.Printf("Error creating category: %v", err)
@@ -124,6 +131,15 @@ func (ch *CategoryHandler) HandleUpdateCategory(w http.ResponseWriter, r *http.R
 		existingCategory.Description = req.Description
 	}
 
+	if req.Attributes != nil {
+		existingCategory.Attributes = req.Attributes
+	}
+
+	if err := store.ValidateAttributeSchema(existingCategory.Attributes); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	if user.OrganizationID != existingCategory.OrganizationID {
 		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "You do not have permission to update this category"})
 		return
@@ -171,6 +187,26 @@ func (ch *CategoryHandler) HandleDeleteCategory(w http.ResponseWriter, r *http.R
 
 	err = ch.categoryStore.DeleteCategory(*categoryID)
 	if err != nil {
+		if errors.Is(err, store.ErrCategoryHasChildren) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Category has child categories; move or delete them first"})
+			return
+		}
+
+		if errors.Is(err, store.ErrCategoryHasProducts) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Category has products; move or delete them first"})
+			return
+		}
+
+		if errors.Is(err, store.ErrCategoryItemsInUse) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Category has items with stock, active reservations or open orders"})
+			return
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Category not found"})
+			return
+		}
+
 		ch.logger.Printf("Error deleting category: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete category"})
 		return
@@ -186,9 +222,17 @@ func (ch *CategoryHandler) HandleGetCategoriesByOrganization(w http.ResponseWrit
 		return
 	}
 
-	pageSize, page := utils.PaginationParams(r)
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := ch.categoryStore.GetCategoryByOrganization(params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 
-	categories, err := ch.categoryStore.GetCategoryByOrganization(page, pageSize, user.OrganizationID)
 	if err != nil {
 		ch.logger.Printf("Error fetching categories: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch categories"})
@@ -202,13 +246,198 @@ func (ch *CategoryHandler) HandleGetCategoriesByOrganization(w http.ResponseWrit
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
-		"data":      categories,
-		"count":     len(categories),
-		"total":     totalCategories,
-		"page":      page,
-		"page_size": pageSize,
-	})
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalCategories))
+}
+
+// HandleRestoreCategory takes a category out of the trash, along with the
+// items that were deleted with it.
+func (ch *CategoryHandler) HandleRestoreCategory(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	categoryID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid category ID"})
+		return
+	}
+
+	restoredCategory, err := ch.categoryStore.RestoreCategory(user.OrganizationID, *categoryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Deleted category not found"})
+		case errors.Is(err, store.ErrCategoryDeleted), errors.Is(err, store.ErrCategoryNameTaken), errors.Is(err, store.ErrItemNameTaken):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		default:
+			ch.logger.Printf("Error restoring category: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to restore category"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"category": restoredCategory})
+}
+
+// HandleGetDeletedCategories lists the categories in the trash, most recently
+// deleted first.
+func (ch *CategoryHandler) HandleGetDeletedCategories(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := ch.categoryStore.GetDeletedCategories(params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ch.logger.Printf("Error fetching deleted categories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch deleted categories"})
+		return
+	}
+
+	totalCategories, err := ch.categoryStore.CountDeletedCategories(user.OrganizationID)
+	if err != nil {
+		ch.logger.Printf("Error counting deleted categories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count deleted categories"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalCategories))
+}
+
+func (ch *CategoryHandler) HandleMoveCategory(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	categoryID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid category ID"})
+		return
+	}
+
+	existingCategory, err := ch.categoryStore.GetCategoryByID(*categoryID)
+	if err != nil {
+		ch.logger.Printf("Error retrieving category: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve category"})
+		return
+	}
+
+	if existingCategory == nil || existingCategory.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Category not found"})
+		return
+	}
+
+	var req struct {
+		ParentID *uuid.UUID `json:"parent_id"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ch.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if !ch.checkParent(w, req.ParentID, user.OrganizationID) {
+		return
+	}
+
+	movedCategory, err := ch.categoryStore.MoveCategory(*categoryID, req.ParentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Category not found"})
+		case errors.Is(err, store.ErrInvalidCategoryTree):
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "A category cannot be moved beneath itself or one of its descendants"})
+		default:
+			ch.logger.Printf("Error moving category: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to move category"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"category": movedCategory})
+}
+
+func (ch *CategoryHandler) HandleGetCategoryTree(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	tree, err := ch.categoryStore.GetCategoryTree(user.OrganizationID, nil)
+	if err != nil {
+		ch.logger.Printf("Error fetching category tree: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch category tree"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": tree})
+}
+
+func (ch *CategoryHandler) HandleGetCategorySubtree(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	categoryID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid category ID"})
+		return
+	}
+
+	tree, err := ch.categoryStore.GetCategoryTree(user.OrganizationID, categoryID)
+	if err != nil {
+		ch.logger.Printf("Error fetching category tree: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch category tree"})
+		return
+	}
+
+	if len(tree) == 0 {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Category not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": tree[0]})
+}
+
+// checkParent writes a 400 response unless parentID is nil or references a
+// category of the organization.
+func (ch *CategoryHandler) checkParent(w http.ResponseWriter, parentID *uuid.UUID, organizationID uuid.UUID) bool {
+	if parentID == nil {
+		return true
+	}
+
+	parent, err := ch.categoryStore.GetCategoryByID(*parentID)
+	if err != nil {
+		ch.logger.Printf("Error retrieving parent category: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve parent category"})
+		return false
+	}
+
+	if parent == nil || parent.OrganizationID != organizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "parent_id does not reference a known category"})
+		return false
+	}
+
+	return true
 }
 
 func (ch *CategoryHandler) validateCreateCategoryRequest(req *store.Category) error {
@@ -216,5 +445,9 @@ func (ch *CategoryHandler) validateCreateCategoryRequest(req *store.Category) er
 		return errors.New("name is required")
 	}
 
+	if err := store.ValidateAttributeSchema(req.Attributes); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type createCycleCountRequest struct {
+	LocationID uuid.UUID  `json:"location_id"`
+	CategoryID *uuid.UUID `json:"category_id"`
+}
+
+type recordCountsRequest struct {
+	Lines []struct {
+		ItemID          uuid.UUID `json:"item_id"`
+		CountedQuantity *float64  `json:"counted_quantity"`
+		Unit            string    `json:"unit"`
+	} `json:"lines"`
+}
+
+type CycleCountHandler struct {
+	cycleCountStore store.CycleCountStore
+	locationStore   store.LocationStore
+	categoryStore   store.CategoryStore
+	unitStore       store.UnitStore
+	logger          *log.Logger
+}
+
+func NewCycleCountHandler(cycleCountStore store.CycleCountStore, locationStore store.LocationStore, categoryStore store.CategoryStore, unitStore store.UnitStore, logger *log.Logger) *CycleCountHandler {
+	return &CycleCountHandler{
+		cycleCountStore: cycleCountStore,
+		locationStore:   locationStore,
+		categoryStore:   categoryStore,
+		unitStore:       unitStore,
+		logger:          logger,
+	}
+}
+
+func (ch *CycleCountHandler) HandleCreateCycleCount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	var req createCycleCountRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ch.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if req.LocationID == uuid.Nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location_id is required"})
+		return
+	}
+
+	location, err := ch.locationStore.GetLocationByID(req.LocationID)
+	if err != nil {
+		ch.logger.Printf("Error retrieving location: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve location"})
+		return
+	}
+
+	if location == nil || location.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location_id does not reference a known location"})
+		return
+	}
+
+	if req.CategoryID != nil {
+		category, err := ch.categoryStore.GetCategoryByID(*req.CategoryID)
+		if err != nil {
+			ch.logger.Printf("Error retrieving category: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve category"})
+			return
+		}
+
+		if category == nil || category.OrganizationID != user.OrganizationID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "category_id does not reference a known category"})
+			return
+		}
+	}
+
+	cycleCount := &store.CycleCount{
+		OrganizationID: user.OrganizationID,
+		LocationID:     req.LocationID,
+		CategoryID:     req.CategoryID,
+		CreatedBy:      &user.ID,
+	}
+
+	createdCycleCount, err := ch.cycleCountStore.CreateCycleCount(cycleCount)
+	if err != nil {
+		ch.logger.Printf("Error creating cycle count: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create cycle count"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdCycleCount})
+}
+
+func (ch *CycleCountHandler) HandleGetCycleCountByID(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	cycleCount, ok := ch.loadCycleCount(w, r, user)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": cycleCount})
+}
+
+func (ch *CycleCountHandler) HandleGetCycleCountsByOrganization(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+
+	page, err := ch.cycleCountStore.GetCycleCountsByOrganization(status, params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ch.logger.Printf("Error fetching cycle counts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch cycle counts"})
+		return
+	}
+
+	totalCycleCounts, err := ch.cycleCountStore.CountCycleCountsByOrganization(status, user.OrganizationID)
+	if err != nil {
+		ch.logger.Printf("Error counting cycle counts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count cycle counts"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalCycleCounts))
+}
+
+func (ch *CycleCountHandler) HandleRecordCounts(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingCycleCount, ok := ch.loadCycleCount(w, r, user)
+	if !ok {
+		return
+	}
+
+	var req recordCountsRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ch.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if len(req.Lines) == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "lines cannot be empty"})
+		return
+	}
+
+	lines := make([]store.CycleCountLine, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		if line.ItemID == uuid.Nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "item_id is required for count lines"})
+			return
+		}
+
+		if line.CountedQuantity == nil || *line.CountedQuantity < 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "counted_quantity must be zero or greater for count lines"})
+			return
+		}
+
+		counted, ok := baseQuantity(w, ch.unitStore, ch.logger, line.ItemID, line.Unit, *line.CountedQuantity)
+		if !ok {
+			return
+		}
+
+		lines = append(lines, store.CycleCountLine{
+			ItemID:          line.ItemID,
+			CountedQuantity: &counted,
+		})
+	}
+
+	cycleCount, err := ch.cycleCountStore.RecordCounts(existingCycleCount.ID, lines, user.ID)
+	if err != nil {
+		ch.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": cycleCount})
+}
+
+func (ch *CycleCountHandler) HandleApproveCycleCount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingCycleCount, ok := ch.loadCycleCount(w, r, user)
+	if !ok {
+		return
+	}
+
+	cycleCount, err := ch.cycleCountStore.ApproveCycleCount(existingCycleCount.ID, user.ID)
+	if err != nil {
+		ch.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": cycleCount})
+}
+
+func (ch *CycleCountHandler) HandleCancelCycleCount(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingCycleCount, ok := ch.loadCycleCount(w, r, user)
+	if !ok {
+		return
+	}
+
+	cycleCount, err := ch.cycleCountStore.CancelCycleCount(existingCycleCount.ID)
+	if err != nil {
+		ch.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": cycleCount})
+}
+
+func (ch *CycleCountHandler) HandleGetCountAccuracy(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	report, err := ch.cycleCountStore.GetCountAccuracyByOrganization(user.OrganizationID)
+	if err != nil {
+		ch.logger.Printf("Error building count accuracy report: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to build count accuracy report"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": report})
+}
+
+func (ch *CycleCountHandler) loadCycleCount(w http.ResponseWriter, r *http.Request, user *store.User) (*store.CycleCount, bool) {
+	cycleCountID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ch.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return nil, false
+	}
+
+	cycleCount, err := ch.cycleCountStore.GetCycleCountByID(*cycleCountID)
+	if err != nil {
+		ch.logger.Printf("Error retrieving cycle count: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve cycle count"})
+		return nil, false
+	}
+
+	if cycleCount == nil || cycleCount.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Cycle count not found"})
+		return nil, false
+	}
+
+	return cycleCount, true
+}
+
+func (ch *CycleCountHandler) writeTransitionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Cycle count not found"})
+	case errors.Is(err, store.ErrInvalidStatusTransition):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Cycle count is no longer open"})
+	case errors.Is(err, store.ErrUnknownCountLine):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, store.ErrInsufficientStock):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Counted quantity is below reserved stock"})
+	case errors.Is(err, store.ErrCapacityExceeded):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location capacity exceeded"})
+	case errors.Is(err, store.ErrLocationArchived):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+	case errors.Is(err, store.ErrSerialMismatch):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Variances of serialized items must be posted as stock movements with serial_numbers"})
+	default:
+		ch.logger.Printf("Error updating cycle count: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update cycle count"})
+	}
+}
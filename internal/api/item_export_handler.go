@@ -0,0 +1,269 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+// exportFlushInterval is the number of rows written between flushes of an
+// export, so clients receive it as it is produced.
+const exportFlushInterval = 100
+
+// exportWriter records whether any of an export has reached the client, after
+// which its status can no longer change.
+type exportWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (ew *exportWriter) Write(p []byte) (int, error) {
+	ew.started = true
+	return ew.w.Write(p)
+}
+
+type exportStockColumn struct {
+	header     string
+	locationID uuid.UUID
+}
+
+// HandleExportItems streams the organization's items as CSV or JSON lines,
+// taking the same filters as the item list. CSV rows use the columns
+// accepted by HandleImportItems, with one stock.<location> column per active
+// location holding the available quantity there. JSON lines carry each item
+// as returned by the API, stock levels included.
+func (ih *ItemHandler) HandleExportItems(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	if format != "csv" && format != "jsonl" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "format must be csv or jsonl"})
+		return
+	}
+
+	filter, ok := readItemFilter(w, r)
+	if !ok {
+		return
+	}
+
+	out := &exportWriter{w: w}
+	var write func(item *store.Item) error
+	var flush func()
+
+	if format == "jsonl" {
+		buffer := bufio.NewWriter(out)
+		encoder := json.NewEncoder(buffer)
+		write = func(item *store.Item) error { return encoder.Encode(item) }
+		flush = func() { buffer.Flush() }
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="items.jsonl"`)
+	} else {
+		header, row, ok := ih.exportColumns(w, user.OrganizationID)
+		if !ok {
+			return
+		}
+
+		writer := csv.NewWriter(out)
+		write = func(item *store.Item) error { return writer.Write(row(item)) }
+		flush = writer.Flush
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="items.csv"`)
+
+		if err := writer.Write(header); err != nil {
+			ih.logger.Printf("Error writing export: %v", err)
+			return
+		}
+	}
+
+	flusher, _ := w.(http.Flusher)
+	written := 0
+
+	err := ih.itemStore.ExportItems(user.OrganizationID, filter, func(item *store.Item) error {
+		if err := write(item); err != nil {
+			return err
+		}
+
+		written++
+		if written%exportFlushInterval == 0 {
+			flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		return nil
+	})
+
+	// A failure after part of the export was sent can only cut it short.
+	if err != nil {
+		ih.logger.Printf("Error exporting items after %d rows: %v", written, err)
+		if !out.started {
+			w.Header().Del("Content-Disposition")
+			if errors.Is(err, store.ErrInvalidItemSort) {
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+				return
+			}
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to export items"})
+			return
+		}
+	}
+
+	flush()
+}
+
+// exportColumns returns the CSV header of an item export and a function
+// rendering an item as a row of it. Attribute columns cover every attribute
+// defined by the organization's categories, and stock columns every active
+// location, the ones an import can stock.
+func (ih *ItemHandler) exportColumns(w http.ResponseWriter, organizationID uuid.UUID) ([]string, func(item *store.Item) []string, bool) {
+	tree, err := ih.categoryStore.GetCategoryTree(organizationID, nil)
+	if err != nil {
+		ih.logger.Printf("Error fetching categories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch categories"})
+		return nil, nil, false
+	}
+
+	locations, err := ih.locationStore.GetAllLocations(organizationID, false)
+	if err != nil {
+		ih.logger.Printf("Error fetching locations: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch locations"})
+		return nil, nil, false
+	}
+
+	paths := map[uuid.UUID]string{}
+	attributeSet := map[string]bool{}
+	var walk func(categories []*store.Category, prefix string)
+	walk = func(categories []*store.Category, prefix string) {
+		for _, category := range categories {
+			paths[category.ID] = prefix + category.Name
+			for _, attribute := range category.Attributes {
+				attributeSet[attribute.Name] = true
+			}
+			walk(category.Children, paths[category.ID]+"/")
+		}
+	}
+	walk(tree, "")
+
+	attributes := make([]string, 0, len(attributeSet))
+	for name := range attributeSet {
+		attributes = append(attributes, name)
+	}
+	sort.Strings(attributes)
+
+	// Locations sharing a name are headed by their ID instead, which the
+	// import also accepts.
+	sort.Slice(locations, func(i, j int) bool { return locations[i].Name < locations[j].Name })
+	nameCount := map[string]int{}
+	for _, location := range locations {
+		nameCount[location.Name]++
+	}
+
+	stockColumns := make([]exportStockColumn, 0, len(locations))
+	for _, location := range locations {
+		header := "stock." + location.Name
+		if nameCount[location.Name] > 1 {
+			header = "stock." + location.ID.String()
+		}
+		stockColumns = append(stockColumns, exportStockColumn{header: header, locationID: location.ID})
+	}
+
+	header := []string{"id", "name", "sku", "category", "description", "color", "weight", "length", "width", "height",
+		"unit_price", "cost_price", "base_unit", "is_active", "track_serials"}
+	for _, name := range attributes {
+		header = append(header, "attr."+name)
+	}
+	for _, column := range stockColumns {
+		header = append(header, column.header)
+	}
+
+	text := func(value *string) string {
+		if value == nil {
+			return ""
+		}
+		return *value
+	}
+
+	number := func(value *float64) string {
+		if value == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*value, 'f', -1, 64)
+	}
+
+	row := func(item *store.Item) []string {
+		record := []string{
+			item.ID.String(),
+			item.Name,
+			text(item.SKU),
+			paths[item.CategoryID],
+			text(item.Description),
+			text(item.Color),
+			number(item.Weight),
+			number(item.Length),
+			number(item.Width),
+			number(item.Height),
+			strconv.Itoa(item.UnitPrice),
+			strconv.Itoa(item.CostPrice),
+			item.BaseUnit,
+			strconv.FormatBool(item.IsActive),
+			strconv.FormatBool(item.TrackSerials),
+		}
+
+		for _, name := range attributes {
+			value, ok := item.Attributes[name]
+			switch v := value.(type) {
+			case string:
+				record = append(record, v)
+			case float64:
+				record = append(record, strconv.FormatFloat(v, 'f', -1, 64))
+			case bool:
+				record = append(record, strconv.FormatBool(v))
+			default:
+				if ok && value != nil {
+					encoded, _ := json.Marshal(value)
+					record = append(record, string(encoded))
+				} else {
+					record = append(record, "")
+				}
+			}
+		}
+
+		// Imports take the available quantity as initial stock and skip
+		// empty cells, so locations with nothing available are left empty.
+		quantities := make(map[uuid.UUID]int, len(item.Stock))
+		for _, stock := range item.Stock {
+			quantities[stock.LocationID] = stock.QuantityAvailable
+		}
+
+		for _, column := range stockColumns {
+			if quantity := quantities[column.locationID]; quantity > 0 {
+				record = append(record, strconv.Itoa(quantity))
+			} else {
+				record = append(record, "")
+			}
+		}
+
+		return record
+	}
+
+	return header, row, true
+}
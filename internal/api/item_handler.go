@@ -1,26 +1,37 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
 	"kabancount/internal/store"
 	"kabancount/internal/utils"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/google/uuid"
 )
 
 type ItemHandler struct {
-	itemStore store.ItemStore
-	logger    *log.Logger
+	itemStore     store.ItemStore
+	categoryStore store.CategoryStore
+	locationStore store.LocationStore
+	unitStore     store.UnitStore
+	logger        *log.Logger
 }
 
-func NewItemHandler(itemStore store.ItemStore, logger *log.Logger) *ItemHandler {
+func NewItemHandler(itemStore store.ItemStore, categoryStore store.CategoryStore, locationStore store.LocationStore, unitStore store.UnitStore, logger *log.Logger) *ItemHandler {
 	return &ItemHandler{
-		itemStore: itemStore,
-		logger:    logger,
+		itemStore:     itemStore,
+		categoryStore: categoryStore,
+		locationStore: locationStore,
+		unitStore:     unitStore,
+		logger:        logger,
 	}
 }
 
@@ -40,16 +51,56 @@ func (ih *ItemHandler) HandleCreateItem(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := ih.validateCreateItemRequest(&req); err != nil {
+	category, ok := ih.loadCategory(w, req.CategoryID, user.OrganizationID)
+	if !ok {
+		return
+	}
+
+	if err := ih.validateCreateItemRequest(&req, category); err != nil {
 		ih.logger.Printf("Validation error: %v", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 		return
 	}
 
+	if req.TrackSerials && len(req.Stock) > 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Stock for serialized items must be received through stock movements with serial_numbers"})
+		return
+	}
+
 	req.OrganizationID = user.OrganizationID
+	req.ProductID = nil
+	req.OptionValues = nil
+	req.IsKit = false
+	if req.BaseUnit == "" {
+		req.BaseUnit = store.DefaultBaseUnit
+	}
+
+	if !ih.convertItemStock(w, &req, false) {
+		return
+	}
 
 	createdItem, err := ih.itemStore.CreateItem(&req)
 	if err != nil {
+		if errors.Is(err, store.ErrSerialMismatch) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Stock for serialized items must be received through stock movements with serial_numbers"})
+			return
+		}
+
+		if errors.Is(err, store.ErrCapacityExceeded) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location capacity exceeded"})
+			return
+		}
+
+		if errors.Is(err, store.ErrLocationArchived) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+			return
+		}
+
+		if errors.Is(err, store.ErrItemNameTaken) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+			return
+		}
+
 		ih.logger.Printf("Error creating item: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create item"})
 		return
@@ -73,6 +124,12 @@ func (ih *ItemHandler) HandleGetItemByID(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if item == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Item not found"})
+		return
+	}
+
+	w.Header().Set("ETag", item.ETag())
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": item})
 }
 
@@ -110,24 +167,106 @@ func (ih *ItemHandler) HandleUpdateItem(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := ih.validateCreateItemRequest(&paramItem); err != nil {
+	if existingItem.OrganizationID != user.OrganizationID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	category, ok := ih.loadCategory(w, paramItem.CategoryID, user.OrganizationID)
+	if !ok {
+		return
+	}
+
+	if err := ih.validateCreateItemRequest(&paramItem, category); err != nil {
 		ih.logger.Printf("Validation error: %v", err)
 		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
 		return
 	}
 
-	if existingItem.OrganizationID != user.OrganizationID {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		utils.WriteJSON(w, http.StatusPreconditionRequired, utils.Envelope{"error": "If-Match header is required"})
+		return
+	}
+
+	paramItem.ID = existingItem.ID
+	paramItem.OrganizationID = existingItem.OrganizationID
+	paramItem.ProductID = existingItem.ProductID
+	paramItem.OptionValues = existingItem.OptionValues
+	paramItem.IsKit = existingItem.IsKit
+	if paramItem.BaseUnit == "" {
+		paramItem.BaseUnit = existingItem.BaseUnit
+	}
+
+	if !ih.convertItemStock(w, &paramItem, true) {
 		return
 	}
 
-	updatedItem, err := ih.itemStore.UpdateItem(existingItem)
+	updatedItem, err := ih.itemStore.UpdateItem(&paramItem, ifMatch)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Item not found"})
+			return
+		}
+
+		if errors.Is(err, store.ErrInsufficientStock) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Stock is reserved at a location being reduced"})
+			return
+		}
+
+		if errors.Is(err, store.ErrCapacityExceeded) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location capacity exceeded"})
+			return
+		}
+
+		if errors.Is(err, store.ErrLocationArchived) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+			return
+		}
+
+		if errors.Is(err, store.ErrKitNotStocked) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Kits hold no stock of their own; stock their components instead"})
+			return
+		}
+
+		if errors.Is(err, store.ErrItemHasStock) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Serial tracking can only be turned on while the item has no stock"})
+			return
+		}
+
+		if errors.Is(err, store.ErrSerializedKit) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Serial tracking cannot be turned on for a kit component"})
+			return
+		}
+
+		if errors.Is(err, store.ErrBaseUnitInUse) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "base_unit can only change while the item has no stock and no alternate units"})
+			return
+		}
+
+		if errors.Is(err, store.ErrSerialMismatch) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Stock of serialized items changes through stock movements with serial_numbers"})
+			return
+		}
+
+		if errors.Is(err, store.ErrVersionConflict) {
+			currentItem, err := ih.itemStore.GetItemByID(*itemID)
+			if err != nil || currentItem == nil {
+				ih.logger.Printf("Error reloading item after conflict: %v", err)
+				utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Item was modified by another request"})
+				return
+			}
+
+			ih.writeItemConflict(w, currentItem)
+			return
+		}
+
 		ih.logger.Printf("Error updating item: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update item"})
 		return
 	}
 
+	w.Header().Set("ETag", updatedItem.ETag())
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updatedItem})
 }
 
@@ -163,6 +302,16 @@ func (ih *ItemHandler) HandleDeleteItem(w http.ResponseWriter, r *http.Request)
 	}
 
 	err = ih.itemStore.DeleteItem(*itemID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Item not found"})
+		return
+	}
+
+	if errors.Is(err, store.ErrItemInUse) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Item has stock, active reservations or open orders"})
+		return
+	}
+
 	if err != nil {
 		ih.logger.Printf("Error deleting item: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete item"})
@@ -172,43 +321,218 @@ func (ih *ItemHandler) HandleDeleteItem(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// HandleRestoreItem takes an item out of the trash.
+func (ih *ItemHandler) HandleRestoreItem(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	itemID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ih.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return
+	}
+
+	restoredItem, err := ih.itemStore.RestoreItem(user.OrganizationID, *itemID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Deleted item not found"})
+		case errors.Is(err, store.ErrCategoryDeleted), errors.Is(err, store.ErrItemNameTaken), errors.Is(err, store.ErrVariantExists):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		default:
+			ih.logger.Printf("Error restoring item: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to restore item"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": restoredItem})
+}
+
 func (ih *ItemHandler) HandleGetItemsByOrganization(w http.ResponseWriter, r *http.Request) {
+	ih.listItems(w, r, false)
+}
+
+// HandleGetDeletedItems lists the items in the trash, taking the same filters
+// as the item list. They are sorted most recently deleted first unless sort
+// says otherwise.
+func (ih *ItemHandler) HandleGetDeletedItems(w http.ResponseWriter, r *http.Request) {
+	ih.listItems(w, r, true)
+}
+
+func (ih *ItemHandler) listItems(w http.ResponseWriter, r *http.Request, deleted bool) {
 	user := middleware.GetUser(r)
 	if user.IsAnonymous() {
 		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
 		return
 	}
 
-	pageSize, page := utils.PaginationParams(r)
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+
+	filter, ok := readItemFilter(w, r)
+	if !ok {
+		return
+	}
+
+	filter.Deleted = deleted
+	if deleted && filter.Sort == "" {
+		filter.Sort = "-deleted_at"
+	}
+
+	page, err := ih.itemStore.GetItemsByOrganization(params, user.OrganizationID, filter)
+	if errors.Is(err, store.ErrInvalidItemSort) || errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
 
-	items, err := ih.itemStore.GetItemsByOrganization(page, pageSize, user.OrganizationID)
 	if err != nil {
 		ih.logger.Printf("Error fetching items: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch items"})
 		return
 	}
 
-	ih.logger.Printf("Fetched %d items for organization %s", len(items), user.OrganizationID)
-	ih.logger.Printf("Page: %d, Page Size: %d", page, pageSize)
-
-	totalItems, err := ih.itemStore.CountItemsByOrganization(user.OrganizationID)
+	totalItems, err := ih.itemStore.CountItemsByOrganization(user.OrganizationID, filter)
 	if err != nil {
 		ih.logger.Printf("Error counting items: %v", err)
 		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count items"})
 		return
 	}
 
-	envelope := utils.Envelope{
-		"data":      items,
-		"count":     len(items),
-		"total":     totalItems,
-		"page":      page,
-		"page_size": pageSize,
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalItems))
+}
+
+// readItemFilter reads the item list filters and sort order from the query
+// string, writing a 400 response when one is malformed. attr.<name>=<value>
+// narrows the list to items whose custom attribute has that value.
+func readItemFilter(w http.ResponseWriter, r *http.Request) (store.ItemFilter, bool) {
+	query := r.URL.Query()
+	filter := store.ItemFilter{
+		Search:     strings.TrimSpace(query.Get("q")),
+		LowStock:   query.Get("low_stock") == "true",
+		Attributes: map[string]string{},
+		Sort:       query.Get("sort"),
+	}
+
+	if value := query.Get("category_id"); value != "" {
+		categoryID, err := uuid.Parse(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "category_id must be a valid UUID"})
+			return filter, false
+		}
+		filter.CategoryID = &categoryID
+		filter.IncludeDescendants = query.Get("include_descendants") == "true"
+	}
+
+	if value := query.Get("is_active"); value != "" {
+		isActive, err := strconv.ParseBool(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "is_active must be true or false"})
+			return filter, false
+		}
+		filter.IsActive = &isActive
+	}
+
+	for name, field := range map[string]**int{"min_price": &filter.MinPrice, "max_price": &filter.MaxPrice} {
+		if value := query.Get(name); value != "" {
+			price, err := strconv.Atoi(value)
+			if err != nil || price < 0 {
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": name + " must be a whole number of minor units"})
+				return filter, false
+			}
+			*field = &price
+		}
+	}
+
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "min_price cannot be greater than max_price"})
+		return filter, false
+	}
+
+	if value := query.Get("location_id"); value != "" {
+		locationID, err := uuid.Parse(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location_id must be a valid UUID"})
+			return filter, false
+		}
+		filter.LocationID = &locationID
+	}
+
+	for key, values := range query {
+		if name, ok := strings.CutPrefix(key, "attr."); ok && name != "" {
+			filter.Attributes[name] = values[0]
+		}
+	}
+
+	return filter, true
+}
+
+func (ih *ItemHandler) writeItemConflict(w http.ResponseWriter, current *store.Item) {
+	w.Header().Set("ETag", current.ETag())
+	utils.WriteJSON(w, http.StatusConflict, utils.Envelope{
+		"error": "Item was modified by another request",
+		"data":  current,
+	})
+}
+
+// loadCategory fetches the category an item is filed under, writing a 400
+// response when it belongs to another organization. It returns nil without
+// error when no category is given so validation can report it.
+func (ih *ItemHandler) loadCategory(w http.ResponseWriter, categoryID, organizationID uuid.UUID) (*store.Category, bool) {
+	if categoryID == uuid.Nil {
+		return nil, true
+	}
+
+	category, err := ih.categoryStore.GetCategoryByID(categoryID)
+	if err != nil {
+		ih.logger.Printf("Error retrieving category: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve category"})
+		return nil, false
+	}
+
+	if category == nil || category.OrganizationID != organizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "category_id does not reference a known category"})
+		return nil, false
+	}
+
+	return category, true
+}
+
+// convertItemStock converts stock entries given in one of the item's units to
+// base units. New items have no alternate units yet, so only their base unit
+// is accepted. Quantities the units cannot express get a 400 response and ok
+// is false.
+func (ih *ItemHandler) convertItemStock(w http.ResponseWriter, item *store.Item, existing bool) bool {
+	for i := range item.Stock {
+		stock := &item.Stock[i]
+		if stock.Unit == "" || stock.Unit == item.BaseUnit {
+			stock.Unit = ""
+			continue
+		}
+
+		if !existing {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": fmt.Sprintf("%v: %s", store.ErrUnknownUnit, stock.Unit)})
+			return false
+		}
+
+		quantity, ok := baseQuantity(w, ih.unitStore, ih.logger, item.ID, stock.Unit, float64(stock.QuantityAvailable))
+		if !ok {
+			return false
+		}
+		stock.QuantityAvailable = quantity
+		stock.Unit = ""
 	}
-	utils.WriteJSON(w, http.StatusOK, envelope)
+
+	return true
 }
 
-func (ih *ItemHandler) validateCreateItemRequest(req *store.Item) error {
+func (ih *ItemHandler) validateCreateItemRequest(req *store.Item, category *store.Category) error {
 	if req.CategoryID == uuid.Nil {
 		return errors.New("category_id is required")
 	}
@@ -221,10 +545,6 @@ func (ih *ItemHandler) validateCreateItemRequest(req *store.Item) error {
 		return errors.New("unit_price is required")
 	}
 
-	if len(req.Stock) == 0 {
-		return errors.New("stock cannot be empty")
-	}
-
 	for _, r := range req.Stock {
 		if r.LocationID == uuid.Nil {
 			return errors.New("location_id is required for stock entries")
@@ -236,6 +556,10 @@ func (ih *ItemHandler) validateCreateItemRequest(req *store.Item) error {
 
 	}
 
+	if err := store.ValidateAttributes(category.Attributes, req.Attributes); err != nil {
+		return err
+	}
+
 	return nil
 
 }
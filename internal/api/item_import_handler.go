@@ -0,0 +1,411 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"kabancount/internal/middleware"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxImportSize caps the size of an uploaded import file.
+const maxImportSize = 10 << 20
+
+type importRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type importStockColumn struct {
+	index      int
+	locationID uuid.UUID
+}
+
+// itemImport holds what the header row of an import file resolves to.
+type itemImport struct {
+	columns    map[string]int
+	attributes map[string]int
+	stock      []importStockColumn
+	categories map[string][]*store.Category
+}
+
+// HandleImportItems creates items from a CSV or TSV file with a header row.
+// Columns map to item fields, "category" names a category by name or by its
+// path such as "Electronics/Phones", "stock.<location>" columns give initial
+// stock at a location and "attr.<name>" columns give custom attribute values.
+// Rows that fail validation are reported and skipped; the rest are created
+// in one transaction, or only checked with dry_run=true.
+func (ih *ItemHandler) HandleImportItems(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	reader := csv.NewReader(http.MaxBytesReader(w, r.Body, maxImportSize))
+	reader.TrimLeadingSpace = true
+	if r.URL.Query().Get("format") == "tsv" || strings.Contains(r.Header.Get("Content-Type"), "tab-separated-values") {
+		reader.Comma = '\t'
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "file has no header row"})
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid import file: " + err.Error()})
+		return
+	}
+
+	imp, ok := ih.readImportHeader(w, header, user.OrganizationID)
+	if !ok {
+		return
+	}
+
+	var items []*store.Item
+	var rows []int
+	rowErrors := []importRowError{}
+	names := map[string]int{}
+	totalRows := 0
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid import file: " + err.Error()})
+			return
+		}
+
+		totalRows++
+		row, _ := reader.FieldPos(0)
+
+		if err != nil {
+			rowErrors = append(rowErrors, importRowError{Row: row, Error: fmt.Sprintf("expected %d columns, found %d", len(header), len(record))})
+			continue
+		}
+
+		item, category, err := imp.parseRow(record)
+		if err == nil {
+			item.OrganizationID = user.OrganizationID
+			err = ih.validateCreateItemRequest(item, category)
+		}
+
+		if err == nil && item.TrackSerials && len(item.Stock) > 0 {
+			err = errors.New("stock for serialized items must be received through stock movements with serial_numbers")
+		}
+
+		if err == nil && names[item.Name] != 0 {
+			err = fmt.Errorf("name %s is already used on row %d", item.Name, names[item.Name])
+		}
+
+		if err != nil {
+			rowErrors = append(rowErrors, importRowError{Row: row, Error: err.Error()})
+			continue
+		}
+
+		names[item.Name] = row
+		items = append(items, item)
+		rows = append(rows, row)
+	}
+
+	if len(items) > 0 {
+		itemNames := make([]string, len(items))
+		for i, item := range items {
+			itemNames[i] = item.Name
+		}
+
+		taken, err := ih.itemStore.GetTakenItemNames(user.OrganizationID, itemNames)
+		if err != nil {
+			ih.logger.Printf("Error checking item names: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to check item names"})
+			return
+		}
+
+		valid := items[:0]
+		validRows := rows[:0]
+		for i, item := range items {
+			if taken[item.Name] {
+				rowErrors = append(rowErrors, importRowError{Row: rows[i], Error: "an item named " + item.Name + " already exists"})
+				continue
+			}
+			valid = append(valid, item)
+			validRows = append(validRows, rows[i])
+		}
+		items = valid
+		rows = validRows
+	}
+
+	envelope := utils.Envelope{
+		"dry_run":    dryRun,
+		"total_rows": totalRows,
+		"valid_rows": len(items),
+		"created":    0,
+		"errors":     rowErrors,
+	}
+
+	if dryRun || len(items) == 0 {
+		utils.WriteJSON(w, http.StatusOK, envelope)
+		return
+	}
+
+	createdItems, err := ih.itemStore.ImportItems(items)
+	if err != nil {
+		if errors.Is(err, store.ErrCapacityExceeded) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location capacity exceeded; no items were imported", "detail": err.Error()})
+			return
+		}
+
+		if errors.Is(err, store.ErrLocationArchived) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived; no items were imported"})
+			return
+		}
+
+		// A name taken since the check above fails the whole transaction;
+		// report it against its row like the names found taken up front.
+		var importErr *store.ItemImportError
+		if errors.As(err, &importErr) && errors.Is(err, store.ErrItemNameTaken) {
+			envelope["valid_rows"] = len(items) - 1
+			envelope["errors"] = append(rowErrors, importRowError{Row: rows[importErr.Index], Error: "an item named " + importErr.Name + " already exists"})
+			envelope["error"] = "An item name was taken during the import; no items were imported"
+			utils.WriteJSON(w, http.StatusConflict, envelope)
+			return
+		}
+
+		ih.logger.Printf("Error importing items: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to import items"})
+		return
+	}
+
+	envelope["created"] = len(createdItems)
+	envelope["data"] = createdItems
+	utils.WriteJSON(w, http.StatusCreated, envelope)
+}
+
+// readImportHeader maps the header row to item fields, resolving the
+// locations of stock columns. It writes a 400 response for columns that
+// cannot be imported.
+func (ih *ItemHandler) readImportHeader(w http.ResponseWriter, header []string, organizationID uuid.UUID) (*itemImport, bool) {
+	locations, err := ih.locationStore.GetAllLocations(organizationID, false)
+	if err != nil {
+		ih.logger.Printf("Error fetching locations: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch locations"})
+		return nil, false
+	}
+
+	// Stock columns name a location, or give its ID when the name is shared.
+	locationIDs := map[string][]uuid.UUID{}
+	for _, location := range locations {
+		locationIDs[location.Name] = append(locationIDs[location.Name], location.ID)
+		locationIDs[location.ID.String()] = append(locationIDs[location.ID.String()], location.ID)
+	}
+
+	tree, err := ih.categoryStore.GetCategoryTree(organizationID, nil)
+	if err != nil {
+		ih.logger.Printf("Error fetching categories: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch categories"})
+		return nil, false
+	}
+
+	imp := &itemImport{
+		columns:    map[string]int{},
+		attributes: map[string]int{},
+		categories: map[string][]*store.Category{},
+	}
+	imp.addCategories(tree, "")
+
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+
+		if name, ok := strings.CutPrefix(column, "stock."); ok {
+			ids := locationIDs[name]
+			switch {
+			case len(ids) == 0:
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "column " + column + " does not reference a known location"})
+				return nil, false
+			case len(ids) > 1:
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "column " + column + " matches more than one location"})
+				return nil, false
+			}
+			imp.stock = append(imp.stock, importStockColumn{index: i, locationID: ids[0]})
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(column, "attr."); ok && name != "" {
+			imp.attributes[name] = i
+			continue
+		}
+
+		column = strings.ToLower(column)
+		switch column {
+		case "id":
+			// Exports carry item IDs; imports always create new items.
+		case "name", "sku", "category", "description", "color", "weight", "length", "width", "height",
+			"unit_price", "cost_price", "base_unit", "is_active", "track_serials":
+			if _, ok := imp.columns[column]; ok {
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "column " + column + " appears more than once"})
+				return nil, false
+			}
+			imp.columns[column] = i
+		default:
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unknown column " + column})
+			return nil, false
+		}
+	}
+
+	for _, column := range []string{"name", "category"} {
+		if _, ok := imp.columns[column]; !ok {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "column " + column + " is required"})
+			return nil, false
+		}
+	}
+
+	return imp, true
+}
+
+// addCategories indexes categories by name and by their path from the top of
+// the tree.
+func (imp *itemImport) addCategories(categories []*store.Category, prefix string) {
+	for _, category := range categories {
+		path := prefix + category.Name
+		imp.categories[category.Name] = append(imp.categories[category.Name], category)
+		if path != category.Name {
+			imp.categories[path] = append(imp.categories[path], category)
+		}
+		imp.addCategories(category.Children, path+"/")
+	}
+}
+
+// parseRow builds an item from one record of the import file.
+func (imp *itemImport) parseRow(record []string) (*store.Item, *store.Category, error) {
+	value := func(column string) string {
+		if i, ok := imp.columns[column]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	optional := func(column string) *string {
+		if v := value(column); v != "" {
+			return &v
+		}
+		return nil
+	}
+
+	item := &store.Item{
+		Name:        value("name"),
+		SKU:         optional("sku"),
+		Description: optional("description"),
+		Color:       optional("color"),
+		BaseUnit:    value("base_unit"),
+		IsActive:    true,
+		Attributes:  map[string]any{},
+	}
+	if item.BaseUnit == "" {
+		item.BaseUnit = store.DefaultBaseUnit
+	}
+
+	categoryName := value("category")
+	categories := imp.categories[categoryName]
+	switch {
+	case categoryName == "":
+		return nil, nil, errors.New("category is required")
+	case len(categories) == 0:
+		return nil, nil, fmt.Errorf("category %s does not reference a known category", categoryName)
+	case len(categories) > 1:
+		return nil, nil, fmt.Errorf("category %s matches more than one category; give its full path", categoryName)
+	}
+	category := categories[0]
+	item.CategoryID = category.ID
+
+	for column, field := range map[string]**float64{"weight": &item.Weight, "length": &item.Length, "width": &item.Width, "height": &item.Height} {
+		if v := value(column); v != "" {
+			number, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s must be a number", column)
+			}
+			*field = &number
+		}
+	}
+
+	for column, field := range map[string]*int{"unit_price": &item.UnitPrice, "cost_price": &item.CostPrice} {
+		if v := value(column); v != "" {
+			number, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s must be a whole number", column)
+			}
+			*field = number
+		}
+	}
+
+	for column, field := range map[string]*bool{"is_active": &item.IsActive, "track_serials": &item.TrackSerials} {
+		if v := value(column); v != "" {
+			flag, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s must be true or false", column)
+			}
+			*field = flag
+		}
+	}
+
+	types := map[string]string{}
+	for _, attribute := range category.Attributes {
+		types[attribute.Name] = attribute.Type
+	}
+
+	for name, i := range imp.attributes {
+		v := strings.TrimSpace(record[i])
+		if v == "" {
+			continue
+		}
+
+		switch types[name] {
+		case store.AttributeTypeNumber:
+			number, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("attribute %s must be a number", name)
+			}
+			item.Attributes[name] = number
+		case store.AttributeTypeBoolean:
+			flag, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("attribute %s must be true or false", name)
+			}
+			item.Attributes[name] = flag
+		default:
+			item.Attributes[name] = v
+		}
+	}
+
+	for _, column := range imp.stock {
+		v := strings.TrimSpace(record[column.index])
+		if v == "" || v == "0" {
+			continue
+		}
+
+		quantity, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, nil, errors.New("stock quantities must be whole numbers of base units")
+		}
+
+		item.Stock = append(item.Stock, store.ItemStock{LocationID: column.locationID, QuantityAvailable: quantity})
+	}
+
+	return item, category, nil
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// loadItem reads the item ID from the URL and returns the item when it belongs
+// to the user's organization, writing the error response when it does not.
+func loadItem(w http.ResponseWriter, r *http.Request, itemStore store.ItemStore, logger *log.Logger, user *store.User) (*store.Item, bool) {
+	itemID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return nil, false
+	}
+
+	item, err := itemStore.GetItemByID(*itemID)
+	if err != nil {
+		logger.Printf("Error retrieving item: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+		return nil, false
+	}
+
+	if item == nil || item.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Item not found"})
+		return nil, false
+	}
+
+	return item, true
+}
+
+// loadItemID is loadItem for handlers that only need the item's ID.
+func loadItemID(w http.ResponseWriter, r *http.Request, itemStore store.ItemStore, logger *log.Logger, user *store.User) (uuid.UUID, bool) {
+	itemID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return uuid.Nil, false
+	}
+
+	itemOrgID, err := itemStore.GetItemOrgID(*itemID)
+	if err != nil {
+		logger.Printf("Error retrieving item: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+		return uuid.Nil, false
+	}
+
+	if itemOrgID == uuid.Nil || itemOrgID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Item not found"})
+		return uuid.Nil, false
+	}
+
+	return *itemID, true
+}
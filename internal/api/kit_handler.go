@@ -0,0 +1,184 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type kitRequest struct {
+	Components []struct {
+		ItemID   uuid.UUID `json:"item_id"`
+		Quantity float64   `json:"quantity"`
+		Unit     string    `json:"unit"`
+	} `json:"components"`
+}
+
+type KitHandler struct {
+	kitStore  store.KitStore
+	itemStore store.ItemStore
+	unitStore store.UnitStore
+	logger    *log.Logger
+}
+
+func NewKitHandler(kitStore store.KitStore, itemStore store.ItemStore, unitStore store.UnitStore, logger *log.Logger) *KitHandler {
+	return &KitHandler{
+		kitStore:  kitStore,
+		itemStore: itemStore,
+		unitStore: unitStore,
+		logger:    logger,
+	}
+}
+
+func (kh *KitHandler) HandleSetKit(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	itemID, ok := loadItemID(w, r, kh.itemStore, kh.logger, user)
+	if !ok {
+		return
+	}
+
+	var req kitRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		kh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if len(req.Components) == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "components cannot be empty"})
+		return
+	}
+
+	kit := &store.Kit{
+		ItemID:     itemID,
+		Components: make([]store.KitComponent, 0, len(req.Components)),
+	}
+
+	seen := make(map[uuid.UUID]bool, len(req.Components))
+	for _, component := range req.Components {
+		if component.ItemID == itemID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "a kit cannot be a component of itself"})
+			return
+		}
+
+		if component.Quantity <= 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "quantity must be greater than zero for components"})
+			return
+		}
+
+		if seen[component.ItemID] {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "each component may only appear once per kit"})
+			return
+		}
+		seen[component.ItemID] = true
+
+		itemOrgID, err := kh.itemStore.GetItemOrgID(component.ItemID)
+		if err != nil {
+			kh.logger.Printf("Error retrieving item: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+			return
+		}
+
+		if itemOrgID != user.OrganizationID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "item_id does not reference a known item"})
+			return
+		}
+
+		quantity, ok := baseQuantity(w, kh.unitStore, kh.logger, component.ItemID, component.Unit, component.Quantity)
+		if !ok {
+			return
+		}
+
+		kit.Components = append(kit.Components, store.KitComponent{
+			ItemID:   component.ItemID,
+			Quantity: quantity,
+		})
+	}
+
+	updatedKit, err := kh.kitStore.SetKit(kit)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrItemHasStock):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Item holds stock; only an item without stock can become a kit"})
+		case errors.Is(err, store.ErrNestedKit), errors.Is(err, store.ErrSerializedKit):
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		case errors.Is(err, store.ErrKitInUse):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Kit has open reservations or allocated sales orders"})
+		default:
+			kh.logger.Printf("Error saving kit: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to save kit"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updatedKit})
+}
+
+func (kh *KitHandler) HandleGetKit(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	itemID, ok := loadItemID(w, r, kh.itemStore, kh.logger, user)
+	if !ok {
+		return
+	}
+
+	kit, err := kh.kitStore.GetKit(itemID)
+	if err != nil {
+		kh.logger.Printf("Error fetching kit: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch kit"})
+		return
+	}
+
+	if kit == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Item is not a kit"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": kit})
+}
+
+func (kh *KitHandler) HandleDeleteKit(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	itemID, ok := loadItemID(w, r, kh.itemStore, kh.logger, user)
+	if !ok {
+		return
+	}
+
+	err := kh.kitStore.DeleteKit(itemID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Item is not a kit"})
+		case errors.Is(err, store.ErrKitInUse):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Kit has open reservations or allocated sales orders"})
+		default:
+			kh.logger.Printf("Error deleting kit: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete kit"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
@@ -1,13 +1,17 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
 	"kabancount/internal/store"
 	"kabancount/internal/utils"
 	"log"
 	"net/http"
+
+	"github.com/google/uuid"
 )
 
 type LocationHandler struct {
@@ -46,6 +50,13 @@ func (lh *LocationHandler) HandleCreateLocation(w http.ResponseWriter, r *http.R
 	}
 
 	req.OrganizationID = user.OrganizationID
+	if req.LocationType == "" {
+		req.LocationType = store.LocationTypeWarehouse
+	}
+
+	if !lh.checkParent(w, &req) {
+		return
+	}
 
 	createdLocation, err := lh.locationStore.CreateLocation(&req)
 	if err != nil {
@@ -65,15 +76,252 @@ func (lh *LocationHandler) HandleGetLocationsByOrganization(w http.ResponseWrite
 		return
 	}
 
-	locations, err := lh.locationStore.GetLocationsByOrganization(user.OrganizationID)
+	includeArchived := r.URL.Query().Get("include_archived") == "true"
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := lh.locationStore.GetLocationsByOrganization(params, user.OrganizationID, includeArchived)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
 	if err != nil {
 		lh.logger.Printf("Error fetching locations: %v", err)
 		http.Error(w, "Failed to fetch locations", http.StatusInternalServerError)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": locations})
+	totalLocations, err := lh.locationStore.CountLocationsByOrganization(user.OrganizationID, includeArchived)
+	if err != nil {
+		lh.logger.Printf("Error counting locations: %v", err)
+		http.Error(w, "Failed to count locations", http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalLocations))
+}
+
+func (lh *LocationHandler) HandleGetLocationByID(w http.ResponseWriter, r *http.Request) {
+	location, ok := lh.loadLocation(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": location})
+}
+
+func (lh *LocationHandler) HandleUpdateLocation(w http.ResponseWriter, r *http.Request) {
+	existingLocation, ok := lh.loadLocation(w, r)
+	if !ok {
+		return
+	}
+
+	var req store.Location
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		lh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if err := lh.validateCreateLocationRequest(&req); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	req.ID = existingLocation.ID
+	req.OrganizationID = existingLocation.OrganizationID
+	if req.LocationType == "" {
+		req.LocationType = existingLocation.LocationType
+	}
+
+	if !lh.checkParent(w, &req) {
+		return
+	}
+
+	updatedLocation, err := lh.locationStore.UpdateLocation(&req)
+	if errors.Is(err, store.ErrInvalidLocationTree) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location cannot be moved inside itself and its child locations must still fit inside it"})
+		return
+	}
+
+	if errors.Is(err, store.ErrCapacityExceeded) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location or one of its parents would hold more stock than its capacity"})
+		return
+	}
+
+	if err != nil {
+		lh.logger.Printf("Error updating location: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update location"})
+		return
+	}
 
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updatedLocation})
+}
+
+func (lh *LocationHandler) HandleDeleteLocation(w http.ResponseWriter, r *http.Request) {
+	location, ok := lh.loadLocation(w, r)
+	if !ok {
+		return
+	}
+
+	err := lh.locationStore.DeleteLocation(location.ID)
+	if errors.Is(err, store.ErrLocationHasStock) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location still holds stock; archive it instead"})
+		return
+	}
+
+	if errors.Is(err, store.ErrLocationHasChildren) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location has child locations"})
+		return
+	}
+
+	if errors.Is(err, store.ErrLocationHasHistory) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location has stock movement or document history; archive it instead"})
+		return
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Location not found"})
+		return
+	}
+
+	if err != nil {
+		lh.logger.Printf("Error deleting location: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete location"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (lh *LocationHandler) HandleArchiveLocation(w http.ResponseWriter, r *http.Request) {
+	location, ok := lh.loadLocation(w, r)
+	if !ok {
+		return
+	}
+
+	lh.setArchived(w, location, lh.locationStore.ArchiveLocation)
+}
+
+func (lh *LocationHandler) HandleRestoreLocation(w http.ResponseWriter, r *http.Request) {
+	location, ok := lh.loadLocation(w, r)
+	if !ok {
+		return
+	}
+
+	if location.ParentID != nil {
+		parent, err := lh.locationStore.GetLocationByID(*location.ParentID)
+		if err != nil {
+			lh.logger.Printf("Error retrieving parent location: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve parent location"})
+			return
+		}
+
+		if parent != nil && parent.ArchivedAt != nil {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Parent location is archived"})
+			return
+		}
+	}
+
+	lh.setArchived(w, location, lh.locationStore.RestoreLocation)
+}
+
+func (lh *LocationHandler) setArchived(w http.ResponseWriter, location *store.Location, apply func(uuid.UUID) (*store.Location, error)) {
+	updatedLocation, err := apply(location.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Location not found"})
+		return
+	}
+
+	if err != nil {
+		lh.logger.Printf("Error updating location: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update location"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updatedLocation})
+}
+
+func (lh *LocationHandler) HandleGetLocationStock(w http.ResponseWriter, r *http.Request) {
+	location, ok := lh.loadLocation(w, r)
+	if !ok {
+		return
+	}
+
+	stock, err := lh.locationStore.GetLocationStock(location.ID)
+	if err != nil {
+		lh.logger.Printf("Error fetching location stock: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch location stock"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": stock})
+}
+
+func (lh *LocationHandler) loadLocation(w http.ResponseWriter, r *http.Request) (*store.Location, bool) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	locationID, err := utils.ReadIDParam(r)
+	if err != nil {
+		lh.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return nil, false
+	}
+
+	location, err := lh.locationStore.GetLocationByID(*locationID)
+	if err != nil {
+		lh.logger.Printf("Error retrieving location: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve location"})
+		return nil, false
+	}
+
+	if location == nil || location.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Location not found"})
+		return nil, false
+	}
+
+	return location, true
+}
+
+// checkParent checks that a location's parent_id, when set, is an active
+// location of the same organization that can hold the location's type.
+func (lh *LocationHandler) checkParent(w http.ResponseWriter, location *store.Location) bool {
+	if location.ParentID == nil {
+		return true
+	}
+
+	parent, err := lh.locationStore.GetLocationByID(*location.ParentID)
+	if err != nil {
+		lh.logger.Printf("Error retrieving parent location: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve parent location"})
+		return false
+	}
+
+	if parent == nil || parent.OrganizationID != location.OrganizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "parent_id does not reference a known location"})
+		return false
+	}
+
+	if parent.ArchivedAt != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "parent_id references an archived location"})
+		return false
+	}
+
+	if !store.CanContain(parent.LocationType, location.LocationType) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "a " + location.LocationType + " cannot be placed inside a " + parent.LocationType})
+		return false
+	}
+
+	return true
 }
 
 func (lh *LocationHandler) validateCreateLocationRequest(location *store.Location) error {
@@ -81,5 +329,13 @@ func (lh *LocationHandler) validateCreateLocationRequest(location *store.Locatio
 		return errors.New("name is required")
 	}
 
+	if location.LocationType != "" && !store.ValidLocationType(location.LocationType) {
+		return errors.New("location_type must be one of warehouse, zone, aisle or bin")
+	}
+
+	if location.Capacity != nil && *location.Capacity < 0 {
+		return errors.New("capacity cannot be negative")
+	}
+
 	return nil
 }
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultExpiryWindow = 30 * 24 * time.Hour
+
+type LotHandler struct {
+	lotStore  store.LotStore
+	itemStore store.ItemStore
+	logger    *log.Logger
+}
+
+func NewLotHandler(lotStore store.LotStore, itemStore store.ItemStore, logger *log.Logger) *LotHandler {
+	return &LotHandler{
+		lotStore:  lotStore,
+		itemStore: itemStore,
+		logger:    logger,
+	}
+}
+
+func (lh *LotHandler) HandleGetExpiringLots(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	within := defaultExpiryWindow
+	if value := r.URL.Query().Get("within"); value != "" {
+		parsed, err := parseExpiryWindow(value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+		within = parsed
+	}
+
+	lots, err := lh.lotStore.GetExpiringLots(user.OrganizationID, time.Now().Add(within))
+	if err != nil {
+		lh.logger.Printf("Error fetching expiring lots: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch expiring lots"})
+		return
+	}
+
+	if lots == nil {
+		lots = []*store.ExpiringLot{}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": lots, "count": len(lots)})
+}
+
+func (lh *LotHandler) HandleGetLotsByItem(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	itemID, err := utils.ReadIDParam(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return
+	}
+
+	itemOrgID, err := lh.itemStore.GetItemOrgID(*itemID)
+	if err != nil {
+		lh.logger.Printf("Error retrieving item: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+		return
+	}
+
+	if itemOrgID == uuid.Nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Item not found"})
+		return
+	}
+
+	if itemOrgID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "Forbidden"})
+		return
+	}
+
+	lots, err := lh.lotStore.GetLotsByItem(*itemID)
+	if err != nil {
+		lh.logger.Printf("Error fetching lots: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch lots"})
+		return
+	}
+
+	if lots == nil {
+		lots = []*store.Lot{}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": lots, "count": len(lots)})
+}
+
+// parseExpiryWindow accepts a number of days such as "30d" or any Go duration
+// such as "72h".
+func parseExpiryWindow(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return d, nil
+	}
+
+	return 0, errors.New("within must be a number of days such as 30d or a duration such as 72h")
+}
@@ -107,6 +107,14 @@ func (oh *OrganizationHandler) HandleUpdateOrganization(w http.ResponseWriter, r
 		existingOrg.Name = paramOrganization.Name
 	}
 
+	if paramOrganization.CostingMethod != "" {
+		if paramOrganization.CostingMethod != store.CostingMethodFIFO && paramOrganization.CostingMethod != store.CostingMethodAverage {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "costing_method must be fifo or average"})
+			return
+		}
+		existingOrg.CostingMethod = paramOrganization.CostingMethod
+	}
+
 	updatedOrg, err := oh.organizationStore.UpdateOrganization(existingOrg)
 	if err != nil {
 		oh.logger.Printf("Error updating organization: %v", err)
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"kabancount/internal/pagination"
+	"kabancount/internal/utils"
+	"net/http"
+)
+
+// readPageParams reads the page a list request asks for, writing a 400
+// response when its cursor is malformed.
+func readPageParams(w http.ResponseWriter, r *http.Request) (pagination.Params, bool) {
+	params, err := pagination.FromRequest(r)
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return pagination.Params{}, false
+	}
+
+	return params, true
+}
+
+// pageEnvelope is the response body for one page of a list of total rows.
+func pageEnvelope[T any](page *pagination.Page[T], total int) utils.Envelope {
+	return utils.Envelope{
+		"data":        page.Data,
+		"count":       len(page.Data),
+		"total":       total,
+		"limit":       page.Limit,
+		"next_cursor": page.NextCursor,
+		"prev_cursor": page.PrevCursor,
+	}
+}
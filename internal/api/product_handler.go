@@ -0,0 +1,345 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type productRequest struct {
+	CategoryID  uuid.UUID             `json:"category_id"`
+	SKU         *string               `json:"sku"`
+	Name        string                `json:"name"`
+	Description *string               `json:"description"`
+	UnitPrice   *int                  `json:"unit_price"`
+	CostPrice   *int                  `json:"cost_price"`
+	BaseUnit    string                `json:"base_unit"`
+	Attributes  map[string]any        `json:"attributes"`
+	Options     []store.ProductOption `json:"options"`
+}
+
+type ProductHandler struct {
+	productStore  store.ProductStore
+	categoryStore store.CategoryStore
+	logger        *log.Logger
+}
+
+func NewProductHandler(productStore store.ProductStore, categoryStore store.CategoryStore, logger *log.Logger) *ProductHandler {
+	return &ProductHandler{
+		productStore:  productStore,
+		categoryStore: categoryStore,
+		logger:        logger,
+	}
+}
+
+func (ph *ProductHandler) HandleCreateProduct(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	var req productRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ph.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if req.Name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+		return
+	}
+
+	if req.UnitPrice == nil || req.CostPrice == nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unit_price and cost_price are required"})
+		return
+	}
+
+	product := &store.Product{
+		OrganizationID: user.OrganizationID,
+		CategoryID:     req.CategoryID,
+		SKU:            req.SKU,
+		Name:           req.Name,
+		Description:    req.Description,
+		UnitPrice:      *req.UnitPrice,
+		CostPrice:      *req.CostPrice,
+		BaseUnit:       req.BaseUnit,
+		Attributes:     req.Attributes,
+		Options:        req.Options,
+	}
+	if product.BaseUnit == "" {
+		product.BaseUnit = store.DefaultBaseUnit
+	}
+
+	if !ph.validateProduct(w, product) {
+		return
+	}
+
+	createdProduct, err := ph.productStore.CreateProduct(product)
+	if err != nil {
+		ph.logger.Printf("Error creating product: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create product"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdProduct})
+}
+
+func (ph *ProductHandler) HandleGetProductByID(w http.ResponseWriter, r *http.Request) {
+	product, ok := ph.loadProduct(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": product})
+}
+
+func (ph *ProductHandler) HandleUpdateProduct(w http.ResponseWriter, r *http.Request) {
+	existingProduct, ok := ph.loadProduct(w, r)
+	if !ok {
+		return
+	}
+
+	var req productRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ph.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if req.CategoryID != uuid.Nil {
+		existingProduct.CategoryID = req.CategoryID
+	}
+
+	if req.SKU != nil {
+		existingProduct.SKU = req.SKU
+	}
+
+	if req.Name != "" {
+		existingProduct.Name = req.Name
+	}
+
+	if req.Description != nil {
+		existingProduct.Description = req.Description
+	}
+
+	if req.UnitPrice != nil {
+		existingProduct.UnitPrice = *req.UnitPrice
+	}
+
+	if req.CostPrice != nil {
+		existingProduct.CostPrice = *req.CostPrice
+	}
+
+	if req.Attributes != nil {
+		existingProduct.Attributes = req.Attributes
+	}
+
+	if req.Options != nil {
+		existingProduct.Options = req.Options
+	}
+
+	if req.BaseUnit != "" && req.BaseUnit != existingProduct.BaseUnit {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "base_unit cannot be changed"})
+		return
+	}
+
+	if !ph.validateProduct(w, existingProduct) {
+		return
+	}
+
+	updatedProduct, err := ph.productStore.UpdateProduct(existingProduct)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidAttributes) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		ph.logger.Printf("Error updating product: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update product"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updatedProduct})
+}
+
+func (ph *ProductHandler) HandleDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	existingProduct, ok := ph.loadProduct(w, r)
+	if !ok {
+		return
+	}
+
+	err := ph.productStore.DeleteProduct(existingProduct.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Product not found"})
+		case errors.Is(err, store.ErrProductHasVariants):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Product still has variants; delete them first"})
+		default:
+			ph.logger.Printf("Error deleting product: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete product"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (ph *ProductHandler) HandleGetProductsByOrganization(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := ph.productStore.GetProductsByOrganization(params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ph.logger.Printf("Error fetching products: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch products"})
+		return
+	}
+
+	totalProducts, err := ph.productStore.CountProductsByOrganization(user.OrganizationID)
+	if err != nil {
+		ph.logger.Printf("Error counting products: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count products"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalProducts))
+}
+
+func (ph *ProductHandler) HandleGenerateVariants(w http.ResponseWriter, r *http.Request) {
+	product, ok := ph.loadProduct(w, r)
+	if !ok {
+		return
+	}
+
+	variants, err := ph.productStore.GenerateVariants(product.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Product not found"})
+		case errors.Is(err, store.ErrItemNameTaken), errors.Is(err, store.ErrVariantExists), errors.Is(err, store.ErrInvalidAttributes):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		default:
+			ph.logger.Printf("Error generating variants: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to generate variants"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": variants, "count": len(variants)})
+}
+
+func (ph *ProductHandler) loadProduct(w http.ResponseWriter, r *http.Request) (*store.Product, bool) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	productID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return nil, false
+	}
+
+	product, err := ph.productStore.GetProductByID(*productID)
+	if err != nil {
+		ph.logger.Printf("Error retrieving product: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve product"})
+		return nil, false
+	}
+
+	if product == nil || product.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Product not found"})
+		return nil, false
+	}
+
+	return product, true
+}
+
+// validateProduct checks a product's prices, category, attributes and option
+// axes, writing a 400 response when they are invalid.
+func (ph *ProductHandler) validateProduct(w http.ResponseWriter, product *store.Product) bool {
+	if product.UnitPrice < 0 || product.CostPrice < 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "unit_price and cost_price cannot be negative"})
+		return false
+	}
+
+	if len(product.Options) == 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "options must define at least one option axis"})
+		return false
+	}
+
+	names := map[string]bool{}
+	for _, option := range product.Options {
+		if option.Name == "" || len(option.Values) == 0 {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "each option requires a name and at least one value"})
+			return false
+		}
+
+		if names[option.Name] {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "option names must be unique"})
+			return false
+		}
+		names[option.Name] = true
+
+		values := map[string]bool{}
+		for _, value := range option.Values {
+			if value == "" || values[value] {
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "values of option " + option.Name + " must be non-empty and unique"})
+				return false
+			}
+			values[value] = true
+		}
+	}
+
+	if product.CategoryID == uuid.Nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "category_id is required"})
+		return false
+	}
+
+	category, err := ph.categoryStore.GetCategoryByID(product.CategoryID)
+	if err != nil {
+		ph.logger.Printf("Error retrieving category: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve category"})
+		return false
+	}
+
+	if category == nil || category.OrganizationID != product.OrganizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "category_id does not reference a known category"})
+		return false
+	}
+
+	if err := store.ValidateAttributes(category.Attributes, product.Attributes); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
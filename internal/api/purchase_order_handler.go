@@ -0,0 +1,448 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type purchaseOrderRequest struct {
+	SupplierID uuid.UUID  `json:"supplier_id"`
+	Reference  *string    `json:"reference"`
+	ExpectedAt *time.Time `json:"expected_at"`
+	Notes      *string    `json:"notes"`
+	Lines      []struct {
+		ItemID          uuid.UUID `json:"item_id"`
+		QuantityOrdered float64   `json:"quantity_ordered"`
+		Unit            string    `json:"unit"`
+		UnitCost        int       `json:"unit_cost"`
+	} `json:"lines"`
+}
+
+type receivePurchaseOrderRequest struct {
+	LocationID uuid.UUID `json:"location_id"`
+	Lines      []struct {
+		LineID         uuid.UUID  `json:"line_id"`
+		Quantity       float64    `json:"quantity"`
+		Unit           string     `json:"unit"`
+		LotNumber      *string    `json:"lot_number"`
+		ManufacturedAt *time.Time `json:"manufactured_at"`
+		ExpiresAt      *time.Time `json:"expires_at"`
+		SerialNumbers  []string   `json:"serial_numbers"`
+	} `json:"lines"`
+}
+
+type PurchaseOrderHandler struct {
+	purchaseOrderStore store.PurchaseOrderStore
+	supplierStore      store.SupplierStore
+	itemStore          store.ItemStore
+	locationStore      store.LocationStore
+	unitStore          store.UnitStore
+	logger             *log.Logger
+}
+
+func NewPurchaseOrderHandler(purchaseOrderStore store.PurchaseOrderStore, supplierStore store.SupplierStore, itemStore store.ItemStore, locationStore store.LocationStore, unitStore store.UnitStore, logger *log.Logger) *PurchaseOrderHandler {
+	return &PurchaseOrderHandler{
+		purchaseOrderStore: purchaseOrderStore,
+		supplierStore:      supplierStore,
+		itemStore:          itemStore,
+		locationStore:      locationStore,
+		unitStore:          unitStore,
+		logger:             logger,
+	}
+}
+
+func (ph *PurchaseOrderHandler) HandleCreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	order, ok := ph.decodePurchaseOrder(w, r, user)
+	if !ok {
+		return
+	}
+	order.OrganizationID = user.OrganizationID
+	order.CreatedBy = &user.ID
+
+	createdOrder, err := ph.purchaseOrderStore.CreatePurchaseOrder(order)
+	if err != nil {
+		ph.logger.Printf("Error creating purchase order: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create purchase order"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdOrder})
+}
+
+func (ph *PurchaseOrderHandler) HandleGetPurchaseOrderByID(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	order, ok := ph.loadPurchaseOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": order})
+}
+
+func (ph *PurchaseOrderHandler) HandleUpdatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingOrder, ok := ph.loadPurchaseOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	order, ok := ph.decodePurchaseOrder(w, r, user)
+	if !ok {
+		return
+	}
+	order.ID = existingOrder.ID
+	order.OrganizationID = existingOrder.OrganizationID
+	order.CreatedBy = existingOrder.CreatedBy
+
+	updatedOrder, err := ph.purchaseOrderStore.UpdatePurchaseOrder(order)
+	if err != nil {
+		ph.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updatedOrder})
+}
+
+func (ph *PurchaseOrderHandler) HandleGetPurchaseOrdersByOrganization(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+
+	page, err := ph.purchaseOrderStore.GetPurchaseOrdersByOrganization(status, params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ph.logger.Printf("Error fetching purchase orders: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch purchase orders"})
+		return
+	}
+
+	totalOrders, err := ph.purchaseOrderStore.CountPurchaseOrdersByOrganization(status, user.OrganizationID)
+	if err != nil {
+		ph.logger.Printf("Error counting purchase orders: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count purchase orders"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalOrders))
+}
+
+func (ph *PurchaseOrderHandler) HandleSendPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	ph.handleTransition(w, r, ph.purchaseOrderStore.SendPurchaseOrder)
+}
+
+func (ph *PurchaseOrderHandler) HandleCancelPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	ph.handleTransition(w, r, ph.purchaseOrderStore.CancelPurchaseOrder)
+}
+
+func (ph *PurchaseOrderHandler) HandleReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingOrder, ok := ph.loadPurchaseOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	var req receivePurchaseOrderRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ph.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if err := ph.validateReceivePurchaseOrderRequest(&req); err != nil {
+		ph.logger.Printf("Validation error: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	location, err := ph.locationStore.GetLocationByID(req.LocationID)
+	if err != nil {
+		ph.logger.Printf("Error retrieving location: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve location"})
+		return
+	}
+
+	if location == nil || location.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location_id does not reference a known location"})
+		return
+	}
+
+	items := make(map[uuid.UUID]uuid.UUID, len(existingOrder.Lines))
+	for _, line := range existingOrder.Lines {
+		items[line.ID] = line.ItemID
+	}
+
+	receipts := make([]store.PurchaseOrderReceipt, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		itemID, known := items[line.LineID]
+		if !known {
+			ph.writeTransitionError(w, store.ErrUnknownOrderLine)
+			return
+		}
+
+		quantity, ok := baseQuantity(w, ph.unitStore, ph.logger, itemID, line.Unit, line.Quantity)
+		if !ok {
+			return
+		}
+
+		if err := validateSerialNumbers(line.SerialNumbers, quantity); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		receipts = append(receipts, store.PurchaseOrderReceipt{
+			LineID:         line.LineID,
+			Quantity:       quantity,
+			LotNumber:      line.LotNumber,
+			ManufacturedAt: line.ManufacturedAt,
+			ExpiresAt:      line.ExpiresAt,
+			SerialNumbers:  line.SerialNumbers,
+		})
+	}
+
+	order, err := ph.purchaseOrderStore.ReceivePurchaseOrder(existingOrder.ID, req.LocationID, receipts, user.ID)
+	if err != nil {
+		ph.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": order})
+}
+
+func (ph *PurchaseOrderHandler) handleTransition(w http.ResponseWriter, r *http.Request, transition func(id uuid.UUID) (*store.PurchaseOrder, error)) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingOrder, ok := ph.loadPurchaseOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	order, err := transition(existingOrder.ID)
+	if err != nil {
+		ph.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": order})
+}
+
+// decodePurchaseOrder reads a create or update payload and checks that the
+// supplier and every item belong to the caller's organization.
+func (ph *PurchaseOrderHandler) decodePurchaseOrder(w http.ResponseWriter, r *http.Request, user *store.User) (*store.PurchaseOrder, bool) {
+	var req purchaseOrderRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		ph.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return nil, false
+	}
+
+	if err := ph.validatePurchaseOrderRequest(&req); err != nil {
+		ph.logger.Printf("Validation error: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	supplier, err := ph.supplierStore.GetSupplierByID(req.SupplierID)
+	if err != nil {
+		ph.logger.Printf("Error retrieving supplier: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve supplier"})
+		return nil, false
+	}
+
+	if supplier == nil || supplier.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "supplier_id does not reference a known supplier"})
+		return nil, false
+	}
+
+	order := &store.PurchaseOrder{
+		SupplierID: req.SupplierID,
+		Reference:  req.Reference,
+		ExpectedAt: req.ExpectedAt,
+		Notes:      req.Notes,
+		Lines:      make([]store.PurchaseOrderLine, 0, len(req.Lines)),
+	}
+
+	for _, line := range req.Lines {
+		itemOrgID, err := ph.itemStore.GetItemOrgID(line.ItemID)
+		if err != nil {
+			ph.logger.Printf("Error retrieving item: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+			return nil, false
+		}
+
+		if itemOrgID != user.OrganizationID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "item_id does not reference a known item"})
+			return nil, false
+		}
+
+		quantity, ok := baseQuantity(w, ph.unitStore, ph.logger, line.ItemID, line.Unit, line.QuantityOrdered)
+		if !ok {
+			return nil, false
+		}
+
+		order.Lines = append(order.Lines, store.PurchaseOrderLine{
+			ItemID:          line.ItemID,
+			QuantityOrdered: quantity,
+			UnitCost:        line.UnitCost,
+		})
+	}
+
+	return order, true
+}
+
+func (ph *PurchaseOrderHandler) loadPurchaseOrder(w http.ResponseWriter, r *http.Request, user *store.User) (*store.PurchaseOrder, bool) {
+	orderID, err := utils.ReadIDParam(r)
+	if err != nil {
+		ph.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return nil, false
+	}
+
+	order, err := ph.purchaseOrderStore.GetPurchaseOrderByID(*orderID)
+	if err != nil {
+		ph.logger.Printf("Error retrieving purchase order: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve purchase order"})
+		return nil, false
+	}
+
+	if order == nil || order.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Purchase order not found"})
+		return nil, false
+	}
+
+	return order, true
+}
+
+func (ph *PurchaseOrderHandler) writeTransitionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Purchase order not found"})
+	case errors.Is(err, store.ErrInvalidStatusTransition):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Purchase order status does not allow this action"})
+	case errors.Is(err, store.ErrUnknownOrderLine), errors.Is(err, store.ErrOverReceipt), errors.Is(err, store.ErrSerialMismatch), errors.Is(err, store.ErrKitNotStocked):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, store.ErrInsufficientStock):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Insufficient stock at location"})
+	case errors.Is(err, store.ErrCapacityExceeded):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location capacity exceeded"})
+	case errors.Is(err, store.ErrLocationArchived):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+	case errors.Is(err, store.ErrSerialUnavailable):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+	default:
+		ph.logger.Printf("Error updating purchase order: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update purchase order"})
+	}
+}
+
+func (ph *PurchaseOrderHandler) validatePurchaseOrderRequest(req *purchaseOrderRequest) error {
+	if req.SupplierID == uuid.Nil {
+		return errors.New("supplier_id is required")
+	}
+
+	if len(req.Lines) == 0 {
+		return errors.New("lines cannot be empty")
+	}
+
+	seen := make(map[uuid.UUID]bool, len(req.Lines))
+	for _, line := range req.Lines {
+		if line.ItemID == uuid.Nil {
+			return errors.New("item_id is required for order lines")
+		}
+
+		if line.QuantityOrdered <= 0 {
+			return errors.New("quantity_ordered must be greater than zero for order lines")
+		}
+
+		if line.UnitCost < 0 {
+			return errors.New("unit_cost cannot be negative for order lines")
+		}
+
+		if seen[line.ItemID] {
+			return errors.New("each item may only appear once per order")
+		}
+		seen[line.ItemID] = true
+	}
+
+	return nil
+}
+
+func (ph *PurchaseOrderHandler) validateReceivePurchaseOrderRequest(req *receivePurchaseOrderRequest) error {
+	if req.LocationID == uuid.Nil {
+		return errors.New("location_id is required")
+	}
+
+	if len(req.Lines) == 0 {
+		return errors.New("lines cannot be empty")
+	}
+
+	seen := make(map[uuid.UUID]bool, len(req.Lines))
+	for _, line := range req.Lines {
+		if line.LineID == uuid.Nil {
+			return errors.New("line_id is required for receipt lines")
+		}
+
+		if line.Quantity <= 0 {
+			return errors.New("quantity must be greater than zero for receipt lines")
+		}
+
+		if line.LotNumber != nil && *line.LotNumber == "" {
+			return errors.New("lot_number cannot be empty for receipt lines")
+		}
+
+		if seen[line.LineID] {
+			return errors.New("each order line may only appear once per receipt")
+		}
+		seen[line.LineID] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/config"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type createReservationRequest struct {
+	ItemID        uuid.UUID  `json:"item_id"`
+	LocationID    uuid.UUID  `json:"location_id"`
+	Quantity      float64    `json:"quantity"`
+	Unit          string     `json:"unit"`
+	ReferenceType *string    `json:"reference_type"`
+	ReferenceID   *uuid.UUID `json:"reference_id"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+}
+
+type commitReservationRequest struct {
+	SerialNumbers []string `json:"serial_numbers"`
+}
+
+type ReservationHandler struct {
+	reservationStore store.ReservationStore
+	itemStore        store.ItemStore
+	locationStore    store.LocationStore
+	unitStore        store.UnitStore
+	logger           *log.Logger
+}
+
+func NewReservationHandler(reservationStore store.ReservationStore, itemStore store.ItemStore, locationStore store.LocationStore, unitStore store.UnitStore, logger *log.Logger) *ReservationHandler {
+	return &ReservationHandler{
+		reservationStore: reservationStore,
+		itemStore:        itemStore,
+		locationStore:    locationStore,
+		unitStore:        unitStore,
+		logger:           logger,
+	}
+}
+
+func (rh *ReservationHandler) HandleCreateReservation(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	var req createReservationRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		rh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if err := rh.validateCreateReservationRequest(&req); err != nil {
+		rh.logger.Printf("Validation error: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	itemOrgID, err := rh.itemStore.GetItemOrgID(req.ItemID)
+	if err != nil {
+		rh.logger.Printf("Error retrieving item: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+		return
+	}
+
+	if itemOrgID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "item_id does not reference a known item"})
+		return
+	}
+
+	location, err := rh.locationStore.GetLocationByID(req.LocationID)
+	if err != nil {
+		rh.logger.Printf("Error retrieving location: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve location"})
+		return
+	}
+
+	if location == nil || location.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location_id does not reference a known location"})
+		return
+	}
+
+	quantity, ok := baseQuantity(w, rh.unitStore, rh.logger, req.ItemID, req.Unit, req.Quantity)
+	if !ok {
+		return
+	}
+
+	expiresAt := time.Now().Add(config.Get().Reservation.DefaultTTL)
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+
+	reservation := &store.Reservation{
+		OrganizationID: user.OrganizationID,
+		ItemID:         req.ItemID,
+		LocationID:     req.LocationID,
+		Quantity:       quantity,
+		ReferenceType:  req.ReferenceType,
+		ReferenceID:    req.ReferenceID,
+		ExpiresAt:      expiresAt,
+		CreatedBy:      &user.ID,
+	}
+
+	createdReservation, err := rh.reservationStore.CreateReservation(reservation)
+	if err != nil {
+		if errors.Is(err, store.ErrInsufficientStock) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Insufficient available stock at location"})
+			return
+		}
+
+		if errors.Is(err, store.ErrLocationArchived) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+			return
+		}
+
+		rh.logger.Printf("Error creating reservation: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create reservation"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdReservation})
+}
+
+func (rh *ReservationHandler) HandleGetReservationByID(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	reservationID, err := utils.ReadIDParam(r)
+	if err != nil {
+		rh.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return
+	}
+
+	reservation, err := rh.reservationStore.GetReservationByID(*reservationID)
+	if err != nil {
+		rh.logger.Printf("Error fetching reservation: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch reservation"})
+		return
+	}
+
+	if reservation == nil || reservation.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Reservation not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": reservation})
+}
+
+func (rh *ReservationHandler) HandleGetReservationsByOrganization(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+
+	page, err := rh.reservationStore.GetReservationsByOrganization(status, params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		rh.logger.Printf("Error fetching reservations: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch reservations"})
+		return
+	}
+
+	totalReservations, err := rh.reservationStore.CountReservationsByOrganization(status, user.OrganizationID)
+	if err != nil {
+		rh.logger.Printf("Error counting reservations: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count reservations"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalReservations))
+}
+
+func (rh *ReservationHandler) HandleReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	rh.handleSettle(w, r, rh.reservationStore.ReleaseReservation)
+}
+
+func (rh *ReservationHandler) HandleCommitReservation(w http.ResponseWriter, r *http.Request) {
+	var req commitReservationRequest
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			rh.logger.Printf("Error decoding request body: %v", err)
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+			return
+		}
+	}
+
+	rh.handleSettle(w, r, func(id uuid.UUID, userID uuid.UUID) (*store.Reservation, error) {
+		return rh.reservationStore.CommitReservation(id, req.SerialNumbers, userID)
+	})
+}
+
+func (rh *ReservationHandler) handleSettle(w http.ResponseWriter, r *http.Request, settle func(id uuid.UUID, userID uuid.UUID) (*store.Reservation, error)) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	reservationID, err := utils.ReadIDParam(r)
+	if err != nil {
+		rh.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return
+	}
+
+	existingReservation, err := rh.reservationStore.GetReservationByID(*reservationID)
+	if err != nil {
+		rh.logger.Printf("Error retrieving reservation: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve reservation"})
+		return
+	}
+
+	if existingReservation == nil || existingReservation.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Reservation not found"})
+		return
+	}
+
+	reservation, err := settle(*reservationID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Reservation not found"})
+		case errors.Is(err, store.ErrInvalidStatusTransition):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Reservation is no longer active"})
+		case errors.Is(err, store.ErrReservationExpired):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Reservation has expired"})
+		case errors.Is(err, store.ErrInsufficientStock):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Insufficient stock at location"})
+		case errors.Is(err, store.ErrLocationArchived):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+		case errors.Is(err, store.ErrSerialMismatch):
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		case errors.Is(err, store.ErrSerialUnavailable):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+		default:
+			rh.logger.Printf("Error updating reservation: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update reservation"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": reservation})
+}
+
+func (rh *ReservationHandler) validateCreateReservationRequest(req *createReservationRequest) error {
+	if req.ItemID == uuid.Nil {
+		return errors.New("item_id is required")
+	}
+
+	if req.LocationID == uuid.Nil {
+		return errors.New("location_id is required")
+	}
+
+	if req.Quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+
+	return nil
+}
@@ -0,0 +1,400 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type salesOrderRequest struct {
+	CustomerName string  `json:"customer_name"`
+	Reference    *string `json:"reference"`
+	Notes        *string `json:"notes"`
+	Lines        []struct {
+		ItemID     uuid.UUID `json:"item_id"`
+		LocationID uuid.UUID `json:"location_id"`
+		Quantity   float64   `json:"quantity"`
+		Unit       string    `json:"unit"`
+		UnitPrice  int       `json:"unit_price"`
+	} `json:"lines"`
+}
+
+type shipSalesOrderRequest struct {
+	TrackingNumber *string                `json:"tracking_number"`
+	SerialNumbers  map[uuid.UUID][]string `json:"serial_numbers"`
+}
+
+type SalesOrderHandler struct {
+	salesOrderStore store.SalesOrderStore
+	itemStore       store.ItemStore
+	locationStore   store.LocationStore
+	unitStore       store.UnitStore
+	logger          *log.Logger
+}
+
+func NewSalesOrderHandler(salesOrderStore store.SalesOrderStore, itemStore store.ItemStore, locationStore store.LocationStore, unitStore store.UnitStore, logger *log.Logger) *SalesOrderHandler {
+	return &SalesOrderHandler{
+		salesOrderStore: salesOrderStore,
+		itemStore:       itemStore,
+		locationStore:   locationStore,
+		unitStore:       unitStore,
+		logger:          logger,
+	}
+}
+
+func (sh *SalesOrderHandler) HandleCreateSalesOrder(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	order, ok := sh.decodeSalesOrder(w, r, user)
+	if !ok {
+		return
+	}
+	order.OrganizationID = user.OrganizationID
+	order.CreatedBy = &user.ID
+
+	createdOrder, err := sh.salesOrderStore.CreateSalesOrder(order)
+	if err != nil {
+		sh.logger.Printf("Error creating sales order: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create sales order"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdOrder})
+}
+
+func (sh *SalesOrderHandler) HandleGetSalesOrderByID(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	order, ok := sh.loadSalesOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": order})
+}
+
+func (sh *SalesOrderHandler) HandleUpdateSalesOrder(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingOrder, ok := sh.loadSalesOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	order, ok := sh.decodeSalesOrder(w, r, user)
+	if !ok {
+		return
+	}
+	order.ID = existingOrder.ID
+	order.OrganizationID = existingOrder.OrganizationID
+	order.CreatedBy = existingOrder.CreatedBy
+
+	updatedOrder, err := sh.salesOrderStore.UpdateSalesOrder(order)
+	if err != nil {
+		sh.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updatedOrder})
+}
+
+func (sh *SalesOrderHandler) HandleGetSalesOrdersByOrganization(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+
+	page, err := sh.salesOrderStore.GetSalesOrdersByOrganization(status, params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		sh.logger.Printf("Error fetching sales orders: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch sales orders"})
+		return
+	}
+
+	totalOrders, err := sh.salesOrderStore.CountSalesOrdersByOrganization(status, user.OrganizationID)
+	if err != nil {
+		sh.logger.Printf("Error counting sales orders: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count sales orders"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalOrders))
+}
+
+func (sh *SalesOrderHandler) HandleAllocateSalesOrder(w http.ResponseWriter, r *http.Request) {
+	sh.handleTransition(w, r, sh.salesOrderStore.AllocateSalesOrder)
+}
+
+func (sh *SalesOrderHandler) HandlePickSalesOrder(w http.ResponseWriter, r *http.Request) {
+	sh.handleTransition(w, r, sh.salesOrderStore.PickSalesOrder)
+}
+
+func (sh *SalesOrderHandler) HandlePackSalesOrder(w http.ResponseWriter, r *http.Request) {
+	sh.handleTransition(w, r, sh.salesOrderStore.PackSalesOrder)
+}
+
+func (sh *SalesOrderHandler) HandleCancelSalesOrder(w http.ResponseWriter, r *http.Request) {
+	sh.handleTransition(w, r, sh.salesOrderStore.CancelSalesOrder)
+}
+
+func (sh *SalesOrderHandler) HandleShipSalesOrder(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingOrder, ok := sh.loadSalesOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	var req shipSalesOrderRequest
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			sh.logger.Printf("Error decoding request body: %v", err)
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+			return
+		}
+	}
+
+	if err := validateShipSerialNumbers(existingOrder, req.SerialNumbers); err != nil {
+		sh.logger.Printf("Validation error: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	order, err := sh.salesOrderStore.ShipSalesOrder(existingOrder.ID, req.TrackingNumber, req.SerialNumbers, user.ID)
+	if err != nil {
+		sh.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": order})
+}
+
+func (sh *SalesOrderHandler) handleTransition(w http.ResponseWriter, r *http.Request, transition func(id uuid.UUID, userID uuid.UUID) (*store.SalesOrder, error)) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingOrder, ok := sh.loadSalesOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	order, err := transition(existingOrder.ID, user.ID)
+	if err != nil {
+		sh.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": order})
+}
+
+// decodeSalesOrder reads a create or update payload and checks that every item
+// and location belongs to the caller's organization.
+func (sh *SalesOrderHandler) decodeSalesOrder(w http.ResponseWriter, r *http.Request, user *store.User) (*store.SalesOrder, bool) {
+	var req salesOrderRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return nil, false
+	}
+
+	if err := sh.validateSalesOrderRequest(&req); err != nil {
+		sh.logger.Printf("Validation error: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return nil, false
+	}
+
+	order := &store.SalesOrder{
+		CustomerName: req.CustomerName,
+		Reference:    req.Reference,
+		Notes:        req.Notes,
+		Lines:        make([]store.SalesOrderLine, 0, len(req.Lines)),
+	}
+
+	checkedLocations := make(map[uuid.UUID]bool)
+	for _, line := range req.Lines {
+		itemOrgID, err := sh.itemStore.GetItemOrgID(line.ItemID)
+		if err != nil {
+			sh.logger.Printf("Error retrieving item: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+			return nil, false
+		}
+
+		if itemOrgID != user.OrganizationID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "item_id does not reference a known item"})
+			return nil, false
+		}
+
+		if !checkedLocations[line.LocationID] {
+			location, err := sh.locationStore.GetLocationByID(line.LocationID)
+			if err != nil {
+				sh.logger.Printf("Error retrieving location: %v", err)
+				utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve location"})
+				return nil, false
+			}
+
+			if location == nil || location.OrganizationID != user.OrganizationID {
+				utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location_id does not reference a known location"})
+				return nil, false
+			}
+			checkedLocations[line.LocationID] = true
+		}
+
+		quantity, ok := baseQuantity(w, sh.unitStore, sh.logger, line.ItemID, line.Unit, line.Quantity)
+		if !ok {
+			return nil, false
+		}
+
+		order.Lines = append(order.Lines, store.SalesOrderLine{
+			ItemID:     line.ItemID,
+			LocationID: line.LocationID,
+			Quantity:   quantity,
+			UnitPrice:  line.UnitPrice,
+		})
+	}
+
+	return order, true
+}
+
+func (sh *SalesOrderHandler) loadSalesOrder(w http.ResponseWriter, r *http.Request, user *store.User) (*store.SalesOrder, bool) {
+	orderID, err := utils.ReadIDParam(r)
+	if err != nil {
+		sh.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return nil, false
+	}
+
+	order, err := sh.salesOrderStore.GetSalesOrderByID(*orderID)
+	if err != nil {
+		sh.logger.Printf("Error retrieving sales order: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve sales order"})
+		return nil, false
+	}
+
+	if order == nil || order.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Sales order not found"})
+		return nil, false
+	}
+
+	return order, true
+}
+
+func (sh *SalesOrderHandler) writeTransitionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Sales order not found"})
+	case errors.Is(err, store.ErrInvalidStatusTransition):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Sales order status does not allow this action"})
+	case errors.Is(err, store.ErrInsufficientStock):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Insufficient available stock to allocate order"})
+	case errors.Is(err, store.ErrLocationArchived):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+	case errors.Is(err, store.ErrSerialMismatch):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, store.ErrSerialUnavailable):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+	default:
+		sh.logger.Printf("Error updating sales order: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update sales order"})
+	}
+}
+
+func (sh *SalesOrderHandler) validateSalesOrderRequest(req *salesOrderRequest) error {
+	if req.CustomerName == "" {
+		return errors.New("customer_name is required")
+	}
+
+	if len(req.Lines) == 0 {
+		return errors.New("lines cannot be empty")
+	}
+
+	type lineKey struct{ itemID, locationID uuid.UUID }
+	seen := make(map[lineKey]bool, len(req.Lines))
+	for _, line := range req.Lines {
+		if line.ItemID == uuid.Nil {
+			return errors.New("item_id is required for order lines")
+		}
+
+		if line.LocationID == uuid.Nil {
+			return errors.New("location_id is required for order lines")
+		}
+
+		if line.Quantity <= 0 {
+			return errors.New("quantity must be greater than zero for order lines")
+		}
+
+		if line.UnitPrice < 0 {
+			return errors.New("unit_price cannot be negative for order lines")
+		}
+
+		key := lineKey{line.ItemID, line.LocationID}
+		if seen[key] {
+			return errors.New("each item may only appear once per location in an order")
+		}
+		seen[key] = true
+	}
+
+	return nil
+}
+
+// validateShipSerialNumbers checks that serial numbers are only given for the
+// order's lines, one per unit shipped.
+func validateShipSerialNumbers(order *store.SalesOrder, serialNumbers map[uuid.UUID][]string) error {
+	quantities := make(map[uuid.UUID]int, len(order.Lines))
+	for _, line := range order.Lines {
+		quantities[line.ID] = line.Quantity
+	}
+
+	for lineID, serials := range serialNumbers {
+		quantity, ok := quantities[lineID]
+		if !ok {
+			return errors.New("serial_numbers references an unknown order line")
+		}
+
+		if err := validateSerialNumbers(serials, quantity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SerialNumberHandler struct {
+	serialNumberStore store.SerialNumberStore
+	itemStore         store.ItemStore
+	logger            *log.Logger
+}
+
+func NewSerialNumberHandler(serialNumberStore store.SerialNumberStore, itemStore store.ItemStore, logger *log.Logger) *SerialNumberHandler {
+	return &SerialNumberHandler{
+		serialNumberStore: serialNumberStore,
+		itemStore:         itemStore,
+		logger:            logger,
+	}
+}
+
+func (sh *SerialNumberHandler) HandleGetSerialNumbersByItem(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	itemID, ok := loadItemID(w, r, sh.itemStore, sh.logger, user)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", store.SerialStatusInStock, store.SerialStatusInTransit, store.SerialStatusIssued:
+	default:
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "status must be one of in_stock, in_transit or issued"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := sh.serialNumberStore.GetSerialNumbersByItem(itemID, status, params)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		sh.logger.Printf("Error fetching serial numbers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch serial numbers"})
+		return
+	}
+
+	totalSerials, err := sh.serialNumberStore.CountSerialNumbersByItem(itemID, status)
+	if err != nil {
+		sh.logger.Printf("Error counting serial numbers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count serial numbers"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalSerials))
+}
+
+func (sh *SerialNumberHandler) HandleGetSerialNumber(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	itemID, ok := loadItemID(w, r, sh.itemStore, sh.logger, user)
+	if !ok {
+		return
+	}
+
+	serial, err := sh.serialNumberStore.GetSerialNumber(itemID, chi.URLParam(r, "serial"))
+	if err != nil {
+		sh.logger.Printf("Error fetching serial number: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch serial number"})
+		return
+	}
+
+	if serial == nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Serial number not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": serial})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+)
+
+type StockAlertHandler struct {
+	stockAlertStore store.StockAlertStore
+	logger          *log.Logger
+}
+
+func NewStockAlertHandler(stockAlertStore store.StockAlertStore, logger *log.Logger) *StockAlertHandler {
+	return &StockAlertHandler{
+		stockAlertStore: stockAlertStore,
+		logger:          logger,
+	}
+}
+
+func (ah *StockAlertHandler) HandleGetAlertsByOrganization(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+	alertType := r.URL.Query().Get("type")
+
+	page, err := ah.stockAlertStore.GetAlertsByOrganization(status, alertType, params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		ah.logger.Printf("Error fetching stock alerts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch stock alerts"})
+		return
+	}
+
+	totalAlerts, err := ah.stockAlertStore.CountAlertsByOrganization(status, alertType, user.OrganizationID)
+	if err != nil {
+		ah.logger.Printf("Error counting stock alerts: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count stock alerts"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalAlerts))
+}
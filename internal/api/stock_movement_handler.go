@@ -0,0 +1,336 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type createMovementRequest struct {
+	LocationID    uuid.UUID  `json:"location_id"`
+	MovementType  string     `json:"movement_type"`
+	Quantity      float64    `json:"quantity"`
+	Unit          string     `json:"unit"`
+	ReferenceType *string    `json:"reference_type"`
+	ReferenceID   *uuid.UUID `json:"reference_id"`
+	Reason        *string    `json:"reason"`
+	UnitCost      *int       `json:"unit_cost"`
+	LotID         *uuid.UUID `json:"lot_id"`
+	Lot           *struct {
+		LotNumber      string     `json:"lot_number"`
+		ManufacturedAt *time.Time `json:"manufactured_at"`
+		ExpiresAt      *time.Time `json:"expires_at"`
+	} `json:"lot"`
+	SerialNumbers []string `json:"serial_numbers"`
+}
+
+type StockMovementHandler struct {
+	stockMovementStore store.StockMovementStore
+	itemStore          store.ItemStore
+	locationStore      store.LocationStore
+	lotStore           store.LotStore
+	unitStore          store.UnitStore
+	logger             *log.Logger
+}
+
+func NewStockMovementHandler(stockMovementStore store.StockMovementStore, itemStore store.ItemStore, locationStore store.LocationStore, lotStore store.LotStore, unitStore store.UnitStore, logger *log.Logger) *StockMovementHandler {
+	return &StockMovementHandler{
+		stockMovementStore: stockMovementStore,
+		itemStore:          itemStore,
+		locationStore:      locationStore,
+		lotStore:           lotStore,
+		unitStore:          unitStore,
+		logger:             logger,
+	}
+}
+
+func (mh *StockMovementHandler) HandleCreateMovement(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	itemID, err := utils.ReadIDParam(r)
+	if err != nil {
+		mh.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return
+	}
+
+	var req createMovementRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		mh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if err := mh.validateCreateMovementRequest(&req); err != nil {
+		mh.logger.Printf("Validation error: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	itemOrgID, err := mh.itemStore.GetItemOrgID(*itemID)
+	if err != nil {
+		mh.logger.Printf("Error retrieving item: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+		return
+	}
+
+	if itemOrgID == uuid.Nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Item not found"})
+		return
+	}
+
+	if itemOrgID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "Forbidden"})
+		return
+	}
+
+	location, err := mh.locationStore.GetLocationByID(req.LocationID)
+	if err != nil {
+		mh.logger.Printf("Error retrieving location: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve location"})
+		return
+	}
+
+	if location == nil || location.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location_id does not reference a known location"})
+		return
+	}
+
+	quantity, ok := baseQuantity(w, mh.unitStore, mh.logger, *itemID, req.Unit, req.Quantity)
+	if !ok {
+		return
+	}
+
+	serialCount := quantity
+	if serialCount < 0 {
+		serialCount = -serialCount
+	}
+
+	if err := validateSerialNumbers(req.SerialNumbers, serialCount); err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	var lot *store.Lot
+	if req.Lot != nil {
+		lot = &store.Lot{
+			LotNumber:      req.Lot.LotNumber,
+			ManufacturedAt: req.Lot.ManufacturedAt,
+			ExpiresAt:      req.Lot.ExpiresAt,
+		}
+	}
+
+	if req.LotID != nil {
+		lot, err := mh.lotStore.GetLotByID(*req.LotID)
+		if err != nil {
+			mh.logger.Printf("Error retrieving lot: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve lot"})
+			return
+		}
+
+		if lot == nil || lot.ItemID != *itemID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "lot_id does not reference a lot of this item"})
+			return
+		}
+	}
+
+	if req.MovementType == store.MovementTypeIssue {
+		quantity = -quantity
+	}
+
+	movement := &store.StockMovement{
+		ItemID:        *itemID,
+		LocationID:    req.LocationID,
+		MovementType:  req.MovementType,
+		Quantity:      quantity,
+		ReferenceType: req.ReferenceType,
+		ReferenceID:   req.ReferenceID,
+		Reason:        req.Reason,
+		CreatedBy:     &user.ID,
+		UnitCost:      req.UnitCost,
+		LotID:         req.LotID,
+		Lot:           lot,
+		SerialNumbers: req.SerialNumbers,
+	}
+
+	createdMovement, err := mh.stockMovementStore.CreateMovement(movement)
+	if err != nil {
+		if errors.Is(err, store.ErrLotExpired) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Only expired lots remain at location; issue them by lot_id"})
+			return
+		}
+
+		if errors.Is(err, store.ErrInsufficientStock) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Insufficient stock at location"})
+			return
+		}
+
+		if errors.Is(err, store.ErrCapacityExceeded) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location capacity exceeded"})
+			return
+		}
+
+		if errors.Is(err, store.ErrLocationArchived) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+			return
+		}
+
+		if errors.Is(err, store.ErrSerialMismatch) || errors.Is(err, store.ErrKitNotStocked) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		if errors.Is(err, store.ErrSerialUnavailable) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		mh.logger.Printf("Error creating stock movement: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create stock movement"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdMovement})
+}
+
+func (mh *StockMovementHandler) HandleGetMovementsByItem(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	itemID, err := utils.ReadIDParam(r)
+	if err != nil {
+		mh.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return
+	}
+
+	itemOrgID, err := mh.itemStore.GetItemOrgID(*itemID)
+	if err != nil {
+		mh.logger.Printf("Error retrieving item: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+		return
+	}
+
+	if itemOrgID == uuid.Nil {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Item not found"})
+		return
+	}
+
+	if itemOrgID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "Forbidden"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := mh.stockMovementStore.GetMovementsByItem(*itemID, params)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		mh.logger.Printf("Error fetching stock movements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch stock movements"})
+		return
+	}
+
+	totalMovements, err := mh.stockMovementStore.CountMovementsByItem(*itemID)
+	if err != nil {
+		mh.logger.Printf("Error counting stock movements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count stock movements"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalMovements))
+}
+
+func (mh *StockMovementHandler) validateCreateMovementRequest(req *createMovementRequest) error {
+	if req.LocationID == uuid.Nil {
+		return errors.New("location_id is required")
+	}
+
+	switch req.MovementType {
+	case store.MovementTypeReceipt, store.MovementTypeIssue:
+		if req.Quantity <= 0 {
+			return errors.New("quantity must be greater than zero")
+		}
+	case store.MovementTypeAdjustment:
+		if req.Quantity == 0 {
+			return errors.New("quantity cannot be zero")
+		}
+	default:
+		return errors.New("movement_type must be one of receipt, issue or adjustment")
+	}
+
+	if req.UnitCost != nil {
+		if req.MovementType == store.MovementTypeIssue || req.Quantity < 0 {
+			return errors.New("unit_cost only applies to stock coming in")
+		}
+
+		if *req.UnitCost < 0 {
+			return errors.New("unit_cost cannot be negative")
+		}
+	}
+
+	if req.Lot != nil {
+		if req.LotID != nil {
+			return errors.New("provide either lot or lot_id, not both")
+		}
+
+		if req.MovementType == store.MovementTypeIssue || req.Quantity < 0 {
+			return errors.New("lot only applies to stock coming in; use lot_id to take from an existing lot")
+		}
+
+		if req.Lot.LotNumber == "" {
+			return errors.New("lot_number is required")
+		}
+	}
+
+	return nil
+}
+
+// validateSerialNumbers checks that serials, when given, name each of quantity
+// units exactly once. Whether the item needs them is decided by the store.
+func validateSerialNumbers(serials []string, quantity int) error {
+	if len(serials) == 0 {
+		return nil
+	}
+
+	if len(serials) != quantity {
+		return errors.New("serial_numbers must list one serial number per unit")
+	}
+
+	seen := make(map[string]bool, len(serials))
+	for _, serial := range serials {
+		if serial == "" {
+			return errors.New("serial_numbers cannot contain empty values")
+		}
+
+		if seen[serial] {
+			return errors.New("serial_numbers cannot contain duplicates")
+		}
+		seen[serial] = true
+	}
+
+	return nil
+}
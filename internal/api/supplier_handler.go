@@ -0,0 +1,238 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+)
+
+type supplierRequest struct {
+	Name        string  `json:"name"`
+	ContactName *string `json:"contact_name"`
+	Email       *string `json:"email"`
+	Phone       *string `json:"phone"`
+	Address     *string `json:"address"`
+	Notes       *string `json:"notes"`
+	IsActive    *bool   `json:"is_active"`
+}
+
+type SupplierHandler struct {
+	supplierStore store.SupplierStore
+	logger        *log.Logger
+}
+
+func NewSupplierHandler(supplierStore store.SupplierStore, logger *log.Logger) *SupplierHandler {
+	return &SupplierHandler{
+		supplierStore: supplierStore,
+		logger:        logger,
+	}
+}
+
+func (sh *SupplierHandler) HandleCreateSupplier(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	var req supplierRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if req.Name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+		return
+	}
+
+	supplier := &store.Supplier{
+		OrganizationID: user.OrganizationID,
+		Name:           req.Name,
+		ContactName:    req.ContactName,
+		Email:          req.Email,
+		Phone:          req.Phone,
+		Address:        req.Address,
+		Notes:          req.Notes,
+		IsActive:       true,
+	}
+	if req.IsActive != nil {
+		supplier.IsActive = *req.IsActive
+	}
+
+	createdSupplier, err := sh.supplierStore.CreateSupplier(supplier)
+	if err != nil {
+		sh.logger.Printf("Error creating supplier: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create supplier"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdSupplier})
+}
+
+func (sh *SupplierHandler) HandleGetSupplierByID(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	supplier, ok := sh.loadSupplier(w, r, user)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": supplier})
+}
+
+func (sh *SupplierHandler) HandleUpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingSupplier, ok := sh.loadSupplier(w, r, user)
+	if !ok {
+		return
+	}
+
+	var req supplierRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		sh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if req.Name != "" {
+		existingSupplier.Name = req.Name
+	}
+
+	if req.ContactName != nil {
+		existingSupplier.ContactName = req.ContactName
+	}
+
+	if req.Email != nil {
+		existingSupplier.Email = req.Email
+	}
+
+	if req.Phone != nil {
+		existingSupplier.Phone = req.Phone
+	}
+
+	if req.Address != nil {
+		existingSupplier.Address = req.Address
+	}
+
+	if req.Notes != nil {
+		existingSupplier.Notes = req.Notes
+	}
+
+	if req.IsActive != nil {
+		existingSupplier.IsActive = *req.IsActive
+	}
+
+	updatedSupplier, err := sh.supplierStore.UpdateSupplier(existingSupplier)
+	if err != nil {
+		sh.logger.Printf("Error updating supplier: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update supplier"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updatedSupplier})
+}
+
+func (sh *SupplierHandler) HandleDeleteSupplier(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingSupplier, ok := sh.loadSupplier(w, r, user)
+	if !ok {
+		return
+	}
+
+	err := sh.supplierStore.DeleteSupplier(existingSupplier.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Supplier not found"})
+		case errors.Is(err, store.ErrSupplierInUse):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Supplier has purchase orders; deactivate it instead"})
+		default:
+			sh.logger.Printf("Error deleting supplier: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete supplier"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (sh *SupplierHandler) HandleGetSuppliersByOrganization(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := sh.supplierStore.GetSuppliersByOrganization(params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		sh.logger.Printf("Error fetching suppliers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch suppliers"})
+		return
+	}
+
+	totalSuppliers, err := sh.supplierStore.CountSuppliersByOrganization(user.OrganizationID)
+	if err != nil {
+		sh.logger.Printf("Error counting suppliers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count suppliers"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalSuppliers))
+}
+
+func (sh *SupplierHandler) loadSupplier(w http.ResponseWriter, r *http.Request, user *store.User) (*store.Supplier, bool) {
+	supplierID, err := utils.ReadIDParam(r)
+	if err != nil {
+		sh.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return nil, false
+	}
+
+	supplier, err := sh.supplierStore.GetSupplierByID(*supplierID)
+	if err != nil {
+		sh.logger.Printf("Error retrieving supplier: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve supplier"})
+		return nil, false
+	}
+
+	if supplier == nil || supplier.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Supplier not found"})
+		return nil, false
+	}
+
+	return supplier, true
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type createTransferRequest struct {
+	FromLocationID uuid.UUID `json:"from_location_id"`
+	ToLocationID   uuid.UUID `json:"to_location_id"`
+	InTransit      bool      `json:"in_transit"`
+	Reason         *string   `json:"reason"`
+	Lines          []struct {
+		ItemID        uuid.UUID `json:"item_id"`
+		Quantity      float64   `json:"quantity"`
+		Unit          string    `json:"unit"`
+		SerialNumbers []string  `json:"serial_numbers"`
+	} `json:"lines"`
+}
+
+type TransferHandler struct {
+	transferStore store.TransferStore
+	itemStore     store.ItemStore
+	locationStore store.LocationStore
+	unitStore     store.UnitStore
+	logger        *log.Logger
+}
+
+func NewTransferHandler(transferStore store.TransferStore, itemStore store.ItemStore, locationStore store.LocationStore, unitStore store.UnitStore, logger *log.Logger) *TransferHandler {
+	return &TransferHandler{
+		transferStore: transferStore,
+		itemStore:     itemStore,
+		locationStore: locationStore,
+		unitStore:     unitStore,
+		logger:        logger,
+	}
+}
+
+func (th *TransferHandler) HandleCreateTransfer(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	var req createTransferRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		th.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if err := th.validateCreateTransferRequest(&req); err != nil {
+		th.logger.Printf("Validation error: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	for _, locationID := range []uuid.UUID{req.FromLocationID, req.ToLocationID} {
+		location, err := th.locationStore.GetLocationByID(locationID)
+		if err != nil {
+			th.logger.Printf("Error retrieving location: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve location"})
+			return
+		}
+
+		if location == nil || location.OrganizationID != user.OrganizationID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location does not reference a known location"})
+			return
+		}
+
+		if locationID == req.ToLocationID && location.ArchivedAt != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "to_location_id references an archived location"})
+			return
+		}
+	}
+
+	lines := make([]store.TransferLine, 0, len(req.Lines))
+	for _, line := range req.Lines {
+		itemOrgID, err := th.itemStore.GetItemOrgID(line.ItemID)
+		if err != nil {
+			th.logger.Printf("Error retrieving item: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve item"})
+			return
+		}
+
+		if itemOrgID != user.OrganizationID {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "item_id does not reference a known item"})
+			return
+		}
+
+		quantity, ok := baseQuantity(w, th.unitStore, th.logger, line.ItemID, line.Unit, line.Quantity)
+		if !ok {
+			return
+		}
+
+		if err := validateSerialNumbers(line.SerialNumbers, quantity); err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		lines = append(lines, store.TransferLine{
+			ItemID:        line.ItemID,
+			Quantity:      quantity,
+			SerialNumbers: line.SerialNumbers,
+		})
+	}
+
+	transfer := &store.Transfer{
+		OrganizationID: user.OrganizationID,
+		FromLocationID: req.FromLocationID,
+		ToLocationID:   req.ToLocationID,
+		Status:         store.TransferStatusCompleted,
+		Reason:         req.Reason,
+		CreatedBy:      &user.ID,
+		Lines:          lines,
+	}
+
+	if req.InTransit {
+		transfer.Status = store.TransferStatusInTransit
+	}
+
+	createdTransfer, err := th.transferStore.CreateTransfer(transfer)
+	if err != nil {
+		if errors.Is(err, store.ErrInsufficientStock) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Insufficient stock at source location"})
+			return
+		}
+
+		if errors.Is(err, store.ErrCapacityExceeded) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Destination location capacity exceeded"})
+			return
+		}
+
+		if errors.Is(err, store.ErrLocationArchived) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+			return
+		}
+
+		if errors.Is(err, store.ErrSerialMismatch) || errors.Is(err, store.ErrKitNotStocked) {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		if errors.Is(err, store.ErrSerialUnavailable) {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+			return
+		}
+
+		th.logger.Printf("Error creating transfer: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create transfer"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdTransfer})
+}
+
+func (th *TransferHandler) HandleGetTransferByID(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	transferID, err := utils.ReadIDParam(r)
+	if err != nil {
+		th.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return
+	}
+
+	transfer, err := th.transferStore.GetTransferByID(*transferID)
+	if err != nil {
+		th.logger.Printf("Error fetching transfer: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch transfer"})
+		return
+	}
+
+	if transfer == nil || transfer.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Transfer not found"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": transfer})
+}
+
+func (th *TransferHandler) HandleGetTransfersByOrganization(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+
+	page, err := th.transferStore.GetTransfersByOrganization(status, params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		th.logger.Printf("Error fetching transfers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch transfers"})
+		return
+	}
+
+	totalTransfers, err := th.transferStore.CountTransfersByOrganization(status, user.OrganizationID)
+	if err != nil {
+		th.logger.Printf("Error counting transfers: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count transfers"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalTransfers))
+}
+
+func (th *TransferHandler) HandleReceiveTransfer(w http.ResponseWriter, r *http.Request) {
+	th.handleTransition(w, r, th.transferStore.ReceiveTransfer)
+}
+
+func (th *TransferHandler) HandleCancelTransfer(w http.ResponseWriter, r *http.Request) {
+	th.handleTransition(w, r, th.transferStore.CancelTransfer)
+}
+
+func (th *TransferHandler) handleTransition(w http.ResponseWriter, r *http.Request, transition func(id uuid.UUID, userID uuid.UUID) (*store.Transfer, error)) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	transferID, err := utils.ReadIDParam(r)
+	if err != nil {
+		th.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return
+	}
+
+	existingTransfer, err := th.transferStore.GetTransferByID(*transferID)
+	if err != nil {
+		th.logger.Printf("Error retrieving transfer: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve transfer"})
+		return
+	}
+
+	if existingTransfer == nil || existingTransfer.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Transfer not found"})
+		return
+	}
+
+	transfer, err := transition(*transferID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Transfer not found"})
+		case errors.Is(err, store.ErrInvalidStatusTransition):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Transfer is no longer in transit"})
+		case errors.Is(err, store.ErrCapacityExceeded):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location capacity exceeded"})
+		case errors.Is(err, store.ErrLocationArchived):
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+		default:
+			th.logger.Printf("Error updating transfer: %v", err)
+			utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update transfer"})
+		}
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": transfer})
+}
+
+func (th *TransferHandler) validateCreateTransferRequest(req *createTransferRequest) error {
+	if req.FromLocationID == uuid.Nil {
+		return errors.New("from_location_id is required")
+	}
+
+	if req.ToLocationID == uuid.Nil {
+		return errors.New("to_location_id is required")
+	}
+
+	if req.FromLocationID == req.ToLocationID {
+		return errors.New("from_location_id and to_location_id must differ")
+	}
+
+	if len(req.Lines) == 0 {
+		return errors.New("lines cannot be empty")
+	}
+
+	seen := make(map[uuid.UUID]bool, len(req.Lines))
+	for _, line := range req.Lines {
+		if line.ItemID == uuid.Nil {
+			return errors.New("item_id is required for transfer lines")
+		}
+
+		if line.Quantity <= 0 {
+			return errors.New("quantity must be greater than zero for transfer lines")
+		}
+
+		if seen[line.ItemID] {
+			return errors.New("each item may only appear once per transfer")
+		}
+		seen[line.ItemID] = true
+	}
+
+	return nil
+}
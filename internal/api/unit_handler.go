@@ -0,0 +1,181 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type itemUnitRequest struct {
+	Name            string `json:"name"`
+	Factor          int    `json:"factor"`
+	AllowFractional bool   `json:"allow_fractional"`
+}
+
+type UnitHandler struct {
+	unitStore store.UnitStore
+	itemStore store.ItemStore
+	logger    *log.Logger
+}
+
+func NewUnitHandler(unitStore store.UnitStore, itemStore store.ItemStore, logger *log.Logger) *UnitHandler {
+	return &UnitHandler{
+		unitStore: unitStore,
+		itemStore: itemStore,
+		logger:    logger,
+	}
+}
+
+func (uh *UnitHandler) HandleCreateItemUnit(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	item, ok := loadItem(w, r, uh.itemStore, uh.logger, user)
+	if !ok {
+		return
+	}
+
+	var req itemUnitRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		uh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if req.Name == "" {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "name is required"})
+		return
+	}
+
+	if req.Factor <= 0 {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "factor must be a whole number of base units greater than zero"})
+		return
+	}
+
+	if req.Name == item.BaseUnit {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "name is already the item's base unit"})
+		return
+	}
+
+	units, err := uh.unitStore.GetItemUnits(item.ID)
+	if err != nil {
+		uh.logger.Printf("Error fetching units: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch units"})
+		return
+	}
+
+	for _, unit := range units {
+		if unit.Name == req.Name {
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Item already has a unit with this name"})
+			return
+		}
+	}
+
+	unit, err := uh.unitStore.CreateItemUnit(&store.ItemUnit{
+		ItemID:          item.ID,
+		Name:            req.Name,
+		Factor:          req.Factor,
+		AllowFractional: req.AllowFractional,
+	})
+	if errors.Is(err, store.ErrUnitIsBaseUnit) {
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "name is already the item's base unit"})
+		return
+	}
+
+	if err != nil {
+		uh.logger.Printf("Error creating unit: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create unit"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": unit})
+}
+
+func (uh *UnitHandler) HandleGetItemUnits(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	item, ok := loadItem(w, r, uh.itemStore, uh.logger, user)
+	if !ok {
+		return
+	}
+
+	units, err := uh.unitStore.GetItemUnits(item.ID)
+	if err != nil {
+		uh.logger.Printf("Error fetching units: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch units"})
+		return
+	}
+
+	if units == nil {
+		units = []*store.ItemUnit{}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": units, "base_unit": item.BaseUnit, "count": len(units)})
+}
+
+func (uh *UnitHandler) HandleDeleteItemUnit(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	item, ok := loadItem(w, r, uh.itemStore, uh.logger, user)
+	if !ok {
+		return
+	}
+
+	unitID, err := uuid.Parse(chi.URLParam(r, "unitID"))
+	if err != nil {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid unit ID"})
+		return
+	}
+
+	err = uh.unitStore.DeleteItemUnit(item.ID, unitID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Unit not found"})
+		return
+	}
+
+	if err != nil {
+		uh.logger.Printf("Error deleting unit: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to delete unit"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// baseQuantity converts a request quantity given in unit into the item's base
+// units. Quantities the item's units cannot express get a 400 response and
+// ok is false.
+func baseQuantity(w http.ResponseWriter, unitStore store.UnitStore, logger *log.Logger, itemID uuid.UUID, unit string, quantity float64) (int, bool) {
+	converted, err := unitStore.ConvertToBaseUnits(itemID, unit, quantity)
+	switch {
+	case errors.Is(err, store.ErrUnknownUnit), errors.Is(err, store.ErrFractionalQuantity):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return 0, false
+	case err != nil:
+		logger.Printf("Error converting quantity: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to convert quantity"})
+		return 0, false
+	}
+
+	return converted, true
+}
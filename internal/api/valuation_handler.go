@@ -0,0 +1,49 @@
+package api
+
+import (
+	"kabancount/internal/middleware"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+type ValuationHandler struct {
+	valuationStore store.ValuationStore
+	logger         *log.Logger
+}
+
+func NewValuationHandler(valuationStore store.ValuationStore, logger *log.Logger) *ValuationHandler {
+	return &ValuationHandler{
+		valuationStore: valuationStore,
+		logger:         logger,
+	}
+}
+
+func (vh *ValuationHandler) HandleGetValuation(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	asOf := time.Now()
+	if value := r.URL.Query().Get("as_of"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "as_of must be an RFC 3339 timestamp"})
+			return
+		}
+		asOf = parsed
+	}
+
+	report, err := vh.valuationStore.GetValuation(user.OrganizationID, asOf)
+	if err != nil {
+		vh.logger.Printf("Error building valuation report: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to build valuation report"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": report})
+}
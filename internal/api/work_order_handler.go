@@ -0,0 +1,362 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/middleware"
+	"kabancount/internal/pagination"
+	"kabancount/internal/store"
+	"kabancount/internal/utils"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+type createWorkOrderRequest struct {
+	BOMID      uuid.UUID `json:"bom_id"`
+	LocationID uuid.UUID `json:"location_id"`
+	Quantity   float64   `json:"quantity"`
+	Unit       string    `json:"unit"`
+	Notes      *string   `json:"notes"`
+}
+
+type completeWorkOrderRequest struct {
+	SerialNumbers map[uuid.UUID][]string `json:"serial_numbers"`
+}
+
+type WorkOrderHandler struct {
+	workOrderStore store.WorkOrderStore
+	bomStore       store.BOMStore
+	locationStore  store.LocationStore
+	unitStore      store.UnitStore
+	logger         *log.Logger
+}
+
+func NewWorkOrderHandler(workOrderStore store.WorkOrderStore, bomStore store.BOMStore, locationStore store.LocationStore, unitStore store.UnitStore, logger *log.Logger) *WorkOrderHandler {
+	return &WorkOrderHandler{
+		workOrderStore: workOrderStore,
+		bomStore:       bomStore,
+		locationStore:  locationStore,
+		unitStore:      unitStore,
+		logger:         logger,
+	}
+}
+
+func (wh *WorkOrderHandler) HandleCreateWorkOrder(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	var req createWorkOrderRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		wh.logger.Printf("Error decoding request body: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+		return
+	}
+
+	if err := wh.validateCreateWorkOrderRequest(&req); err != nil {
+		wh.logger.Printf("Validation error: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	bom, err := wh.bomStore.GetBOMByID(req.BOMID)
+	if err != nil {
+		wh.logger.Printf("Error retrieving bill of materials: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve bill of materials"})
+		return
+	}
+
+	if bom == nil || bom.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "bom_id does not reference a known bill of materials"})
+		return
+	}
+
+	location, err := wh.locationStore.GetLocationByID(req.LocationID)
+	if err != nil {
+		wh.logger.Printf("Error retrieving location: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve location"})
+		return
+	}
+
+	if location == nil || location.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "location_id does not reference a known location"})
+		return
+	}
+
+	quantity, ok := baseQuantity(w, wh.unitStore, wh.logger, bom.ItemID, req.Unit, req.Quantity)
+	if !ok {
+		return
+	}
+
+	workOrder := &store.WorkOrder{
+		OrganizationID: user.OrganizationID,
+		BOMID:          req.BOMID,
+		LocationID:     req.LocationID,
+		Quantity:       quantity,
+		Notes:          req.Notes,
+		CreatedBy:      &user.ID,
+	}
+
+	createdWorkOrder, err := wh.workOrderStore.CreateWorkOrder(workOrder)
+	if err != nil {
+		wh.logger.Printf("Error creating work order: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to create work order"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": createdWorkOrder})
+}
+
+func (wh *WorkOrderHandler) HandleGetWorkOrderByID(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	workOrder, ok := wh.loadWorkOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": workOrder})
+}
+
+func (wh *WorkOrderHandler) HandleGetWorkOrdersByOrganization(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	params, ok := readPageParams(w, r)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+
+	page, err := wh.workOrderStore.GetWorkOrdersByOrganization(status, params, user.OrganizationID)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		wh.logger.Printf("Error fetching work orders: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch work orders"})
+		return
+	}
+
+	totalWorkOrders, err := wh.workOrderStore.CountWorkOrdersByOrganization(status, user.OrganizationID)
+	if err != nil {
+		wh.logger.Printf("Error counting work orders: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to count work orders"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, pageEnvelope(page, totalWorkOrders))
+}
+
+func (wh *WorkOrderHandler) HandleGetWorkOrderRequirements(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	workOrder, ok := wh.loadWorkOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	requirements, err := wh.workOrderStore.GetWorkOrderRequirements(workOrder.ID)
+	if err != nil {
+		wh.logger.Printf("Error fetching work order requirements: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch work order requirements"})
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": requirements})
+}
+
+func (wh *WorkOrderHandler) HandleReleaseWorkOrder(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingWorkOrder, ok := wh.loadWorkOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	workOrder, err := wh.workOrderStore.ReleaseWorkOrder(existingWorkOrder.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrComponentShortage) {
+			requirements, err := wh.workOrderStore.GetWorkOrderRequirements(existingWorkOrder.ID)
+			if err != nil {
+				wh.logger.Printf("Error fetching work order requirements: %v", err)
+				utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to fetch work order requirements"})
+				return
+			}
+
+			utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Insufficient components at location", "requirements": requirements})
+			return
+		}
+
+		wh.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": workOrder})
+}
+
+func (wh *WorkOrderHandler) HandleCompleteWorkOrder(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingWorkOrder, ok := wh.loadWorkOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	var req completeWorkOrderRequest
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			wh.logger.Printf("Error decoding request body: %v", err)
+			utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid request payload"})
+			return
+		}
+	}
+
+	if err := validateCompleteSerialNumbers(existingWorkOrder, req.SerialNumbers); err != nil {
+		wh.logger.Printf("Validation error: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+		return
+	}
+
+	workOrder, err := wh.workOrderStore.CompleteWorkOrder(existingWorkOrder.ID, req.SerialNumbers, user.ID)
+	if err != nil {
+		wh.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": workOrder})
+}
+
+func (wh *WorkOrderHandler) HandleCancelWorkOrder(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.IsAnonymous() {
+		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "Unauthorized"})
+		return
+	}
+
+	existingWorkOrder, ok := wh.loadWorkOrder(w, r, user)
+	if !ok {
+		return
+	}
+
+	workOrder, err := wh.workOrderStore.CancelWorkOrder(existingWorkOrder.ID)
+	if err != nil {
+		wh.writeTransitionError(w, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": workOrder})
+}
+
+func (wh *WorkOrderHandler) loadWorkOrder(w http.ResponseWriter, r *http.Request, user *store.User) (*store.WorkOrder, bool) {
+	workOrderID, err := utils.ReadIDParam(r)
+	if err != nil {
+		wh.logger.Printf("Error reading ID parameter: %v", err)
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Invalid ID parameter"})
+		return nil, false
+	}
+
+	workOrder, err := wh.workOrderStore.GetWorkOrderByID(*workOrderID)
+	if err != nil {
+		wh.logger.Printf("Error retrieving work order: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to retrieve work order"})
+		return nil, false
+	}
+
+	if workOrder == nil || workOrder.OrganizationID != user.OrganizationID {
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Work order not found"})
+		return nil, false
+	}
+
+	return workOrder, true
+}
+
+func (wh *WorkOrderHandler) writeTransitionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "Work order not found"})
+	case errors.Is(err, store.ErrInvalidStatusTransition):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Work order status does not allow this action"})
+	case errors.Is(err, store.ErrInsufficientStock):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Insufficient components at location"})
+	case errors.Is(err, store.ErrCapacityExceeded):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location capacity exceeded"})
+	case errors.Is(err, store.ErrLocationArchived):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "Location is archived"})
+	case errors.Is(err, store.ErrKitNotStocked):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "Kits cannot be produced; build their components instead"})
+	case errors.Is(err, store.ErrSerialMismatch):
+		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	case errors.Is(err, store.ErrSerialUnavailable):
+		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": err.Error()})
+	default:
+		wh.logger.Printf("Error updating work order: %v", err)
+		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "Failed to update work order"})
+	}
+}
+
+func (wh *WorkOrderHandler) validateCreateWorkOrderRequest(req *createWorkOrderRequest) error {
+	if req.BOMID == uuid.Nil {
+		return errors.New("bom_id is required")
+	}
+
+	if req.LocationID == uuid.Nil {
+		return errors.New("location_id is required")
+	}
+
+	if req.Quantity <= 0 {
+		return errors.New("quantity must be greater than zero")
+	}
+
+	return nil
+}
+
+// validateCompleteSerialNumbers checks that serial numbers are only given for
+// the work order's components and finished item, one per unit moved.
+func validateCompleteSerialNumbers(workOrder *store.WorkOrder, serialNumbers map[uuid.UUID][]string) error {
+	quantities := map[uuid.UUID]int{workOrder.ItemID: workOrder.Quantity}
+	for _, component := range workOrder.Components {
+		quantities[component.ItemID] = component.QuantityRequired
+	}
+
+	for itemID, serials := range serialNumbers {
+		quantity, ok := quantities[itemID]
+		if !ok {
+			return errors.New("serial_numbers references an item the work order does not move")
+		}
+
+		if err := validateSerialNumbers(serials, quantity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
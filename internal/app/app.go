@@ -11,23 +11,42 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 )
 
 type Application struct {
-	Logger              *log.Logger
-	UserHandler         *api.UserHandler
-	OrganizationHandler *api.OrganizationHandler
-	TokenHandler        *api.TokenHandler
-	AuthHandler         *api.AuthHandler
-	ItemHandler         *api.ItemHandler
-	CategoryHandler     *api.CategoryHandler
-	LocationHandler     *api.LocationHandler
-	MiddlewareHandler   middleware.UserMiddleware
-	DB                  *sql.DB
+	Logger               *log.Logger
+	UserHandler          *api.UserHandler
+	OrganizationHandler  *api.OrganizationHandler
+	TokenHandler         *api.TokenHandler
+	AuthHandler          *api.AuthHandler
+	ItemHandler          *api.ItemHandler
+	CategoryHandler      *api.CategoryHandler
+	LocationHandler      *api.LocationHandler
+	StockMovementHandler *api.StockMovementHandler
+	TransferHandler      *api.TransferHandler
+	ReservationHandler   *api.ReservationHandler
+	MiddlewareHandler    middleware.UserMiddleware
+	CycleCountHandler    *api.CycleCountHandler
+	StockAlertHandler    *api.StockAlertHandler
+	SupplierHandler      *api.SupplierHandler
+	PurchaseOrderHandler *api.PurchaseOrderHandler
+	SalesOrderHandler    *api.SalesOrderHandler
+	BOMHandler           *api.BOMHandler
+	WorkOrderHandler     *api.WorkOrderHandler
+	ValuationHandler     *api.ValuationHandler
+	LotHandler           *api.LotHandler
+	SerialNumberHandler  *api.SerialNumberHandler
+	UnitHandler          *api.UnitHandler
+	ProductHandler       *api.ProductHandler
+	KitHandler           *api.KitHandler
+	BarcodeHandler       *api.BarcodeHandler
+	DB                   *sql.DB
+	jobs                 []backgroundJob
 }
 
 func NewApplication() (*Application, error) {
-	_, err := config.Load()
+	cfg, err := config.Load()
 	if err != nil {
 		panic(err)
 	}
@@ -51,28 +70,126 @@ func NewApplication() (*Application, error) {
 	itemStore := store.NewPostgresItemStore(pgDB)
 	categoryStore := store.NewPostgresCategoryStore(pgDB)
 	locationStore := store.NewPostgresLocationStore(pgDB)
+	stockMovementStore := store.NewPostgresStockMovementStore(pgDB)
+	lotStore := store.NewPostgresLotStore(pgDB)
+	transferStore := store.NewPostgresTransferStore(pgDB)
+	reservationStore := store.NewPostgresReservationStore(pgDB)
 
+	cycleCountStore := store.NewPostgresCycleCountStore(pgDB)
+	stockAlertStore := store.NewPostgresStockAlertStore(pgDB)
+	supplierStore := store.NewPostgresSupplierStore(pgDB)
+	purchaseOrderStore := store.NewPostgresPurchaseOrderStore(pgDB)
+	salesOrderStore := store.NewPostgresSalesOrderStore(pgDB)
+	bomStore := store.NewPostgresBOMStore(pgDB)
+	workOrderStore := store.NewPostgresWorkOrderStore(pgDB)
+	valuationStore := store.NewPostgresValuationStore(pgDB)
+	serialNumberStore := store.NewPostgresSerialNumberStore(pgDB)
+	unitStore := store.NewPostgresUnitStore(pgDB)
+	productStore := store.NewPostgresProductStore(pgDB)
+	kitStore := store.NewPostgresKitStore(pgDB)
+	barcodeStore := store.NewPostgresBarcodeStore(pgDB)
 	// our handlers will go here
 	userHandler := api.NewUserHandler(userStore, logger)
 	organizationHandler := api.NewOrganizationHandler(organizationStore, logger)
 	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
 	authHandler := api.NewAuthHandler(organizationStore, userStore, logger)
 	middlewareHandler := middleware.UserMiddleware{UserStore: userStore}
-	itemHandler := api.NewItemHandler(itemStore, logger)
+	itemHandler := api.NewItemHandler(itemStore, categoryStore, locationStore, unitStore, logger)
 	categoryHandler := api.NewCategoryHandler(categoryStore, logger)
 	locationHandler := api.NewLocationHandler(locationStore, logger)
+	stockMovementHandler := api.NewStockMovementHandler(stockMovementStore, itemStore, locationStore, lotStore, unitStore, logger)
+	transferHandler := api.NewTransferHandler(transferStore, itemStore, locationStore, unitStore, logger)
+	reservationHandler := api.NewReservationHandler(reservationStore, itemStore, locationStore, unitStore, logger)
+	cycleCountHandler := api.NewCycleCountHandler(cycleCountStore, locationStore, categoryStore, unitStore, logger)
+	stockAlertHandler := api.NewStockAlertHandler(stockAlertStore, logger)
+	supplierHandler := api.NewSupplierHandler(supplierStore, logger)
+	purchaseOrderHandler := api.NewPurchaseOrderHandler(purchaseOrderStore, supplierStore, itemStore, locationStore, unitStore, logger)
+	salesOrderHandler := api.NewSalesOrderHandler(salesOrderStore, itemStore, locationStore, unitStore, logger)
+	bomHandler := api.NewBOMHandler(bomStore, itemStore, unitStore, logger)
+	workOrderHandler := api.NewWorkOrderHandler(workOrderStore, bomStore, locationStore, unitStore, logger)
+	valuationHandler := api.NewValuationHandler(valuationStore, logger)
+	lotHandler := api.NewLotHandler(lotStore, itemStore, logger)
+	serialNumberHandler := api.NewSerialNumberHandler(serialNumberStore, itemStore, logger)
+	unitHandler := api.NewUnitHandler(unitStore, itemStore, logger)
+	productHandler := api.NewProductHandler(productStore, categoryStore, logger)
+	kitHandler := api.NewKitHandler(kitStore, itemStore, unitStore, logger)
+	barcodeHandler := api.NewBarcodeHandler(barcodeStore, itemStore, unitStore, locationStore, logger)
 
 	app := &Application{
-		Logger:              logger,
-		UserHandler:         userHandler,
-		OrganizationHandler: organizationHandler,
-		TokenHandler:        tokenHandler,
-		AuthHandler:         authHandler,
-		ItemHandler:         itemHandler,
-		CategoryHandler:     categoryHandler,
-		MiddlewareHandler:   middlewareHandler,
-		LocationHandler:     locationHandler,
-		DB:                  pgDB,
+		Logger:               logger,
+		UserHandler:          userHandler,
+		OrganizationHandler:  organizationHandler,
+		TokenHandler:         tokenHandler,
+		AuthHandler:          authHandler,
+		ItemHandler:          itemHandler,
+		CategoryHandler:      categoryHandler,
+		MiddlewareHandler:    middlewareHandler,
+		LocationHandler:      locationHandler,
+		StockMovementHandler: stockMovementHandler,
+		TransferHandler:      transferHandler,
+		ReservationHandler:   reservationHandler,
+		CycleCountHandler:    cycleCountHandler,
+		StockAlertHandler:    stockAlertHandler,
+		SupplierHandler:      supplierHandler,
+		PurchaseOrderHandler: purchaseOrderHandler,
+		SalesOrderHandler:    salesOrderHandler,
+		BOMHandler:           bomHandler,
+		WorkOrderHandler:     workOrderHandler,
+		ValuationHandler:     valuationHandler,
+		LotHandler:           lotHandler,
+		SerialNumberHandler:  serialNumberHandler,
+		UnitHandler:          unitHandler,
+		ProductHandler:       productHandler,
+		KitHandler:           kitHandler,
+		BarcodeHandler:       barcodeHandler,
+		DB:                   pgDB,
+	}
+
+	// our background jobs will go here
+	app.jobs = []backgroundJob{
+		{
+			name:     "reservation sweeper",
+			interval: cfg.Reservation.SweepInterval,
+			run: func() error {
+				expired, err := reservationStore.ExpireReservations(time.Now())
+				if expired > 0 {
+					logger.Printf("Expired %d reservations", expired)
+				}
+				return err
+			},
+		},
+		{
+			name:     "stock alert evaluator",
+			interval: cfg.Alert.EvaluationInterval,
+			run: func() error {
+				raised, resolved, err := stockAlertStore.EvaluateAlerts()
+				if raised > 0 || resolved > 0 {
+					logger.Printf("Raised %d and resolved %d stock alerts", raised, resolved)
+				}
+				return err
+			},
+		},
+		{
+			name:     "trash purge",
+			interval: cfg.Retention.PurgeInterval,
+			run: func() error {
+				before := time.Now().Add(-cfg.Retention.Window)
+
+				items, err := itemStore.PurgeDeletedItems(before)
+				if items > 0 {
+					logger.Printf("Purged %d deleted items", items)
+				}
+				if err != nil {
+					return err
+				}
+
+				categories, err := categoryStore.PurgeDeletedCategories(before)
+				if categories > 0 {
+					logger.Printf("Purged %d deleted categories", categories)
+				}
+				return err
+			},
+		},
 	}
 
 	return app, nil
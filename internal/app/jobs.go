@@ -0,0 +1,32 @@
+package app
+
+import "time"
+
+type backgroundJob struct {
+	name     string
+	interval time.Duration
+	run      func() error
+}
+
+// StartBackgroundJobs launches every registered job on its own ticker. Jobs
+// run for the lifetime of the process; failures are logged and retried on the
+// next tick.
+func (app *Application) StartBackgroundJobs() {
+	for _, job := range app.jobs {
+		if job.interval <= 0 {
+			app.Logger.Printf("Background job %q disabled", job.name)
+			continue
+		}
+
+		go func(job backgroundJob) {
+			ticker := time.NewTicker(job.interval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				if err := job.run(); err != nil {
+					app.Logger.Printf("Background job %q failed: %v", job.name, err)
+				}
+			}
+		}(job)
+	}
+}
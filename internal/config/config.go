@@ -3,17 +3,21 @@ package config
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	AWS      AWSConfig      `mapstructure:"aws"`
-	App      AppConfig      `mapstructure:"app"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	JWT         JWTConfig         `mapstructure:"jwt"`
+	AWS         AWSConfig         `mapstructure:"aws"`
+	App         AppConfig         `mapstructure:"app"`
+	Reservation ReservationConfig `mapstructure:"reservation"`
+	Alert       AlertConfig       `mapstructure:"alert"`
+	Retention   RetentionConfig   `mapstructure:"retention"`
 }
 
 type ServerConfig struct {
@@ -42,6 +46,20 @@ type AppConfig struct {
 	Environment string `mapstructure:"env"`
 }
 
+type ReservationConfig struct {
+	DefaultTTL    time.Duration `mapstructure:"default_ttl"`
+	SweepInterval time.Duration `mapstructure:"sweep_interval"`
+}
+
+type AlertConfig struct {
+	EvaluationInterval time.Duration `mapstructure:"evaluation_interval"`
+}
+
+type RetentionConfig struct {
+	Window        time.Duration `mapstructure:"window"`
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
 var globalConfig *Config
 
 func Load() (*Config, error) {
@@ -82,6 +100,11 @@ func setDefaults() {
 	viper.SetDefault("database.schema", "public")
 	viper.SetDefault("app.env", "local")
 	viper.SetDefault("aws.region", "us-east-1")
+	viper.SetDefault("reservation.default_ttl", "30m")
+	viper.SetDefault("reservation.sweep_interval", "1m")
+	viper.SetDefault("alert.evaluation_interval", "5m")
+	viper.SetDefault("retention.window", "720h")
+	viper.SetDefault("retention.purge_interval", "1h")
 }
 
 func mapEnvVars() {
@@ -105,6 +128,17 @@ func mapEnvVars() {
 
 	// App
 	viper.BindEnv("app.env", "APP_ENV")
+
+	// Reservation
+	viper.BindEnv("reservation.default_ttl", "RESERVATION_DEFAULT_TTL")
+	viper.BindEnv("reservation.sweep_interval", "RESERVATION_SWEEP_INTERVAL")
+
+	// Alert
+	viper.BindEnv("alert.evaluation_interval", "ALERT_EVALUATION_INTERVAL")
+
+	// Retention
+	viper.BindEnv("retention.window", "RETENTION_WINDOW")
+	viper.BindEnv("retention.purge_interval", "RETENTION_PURGE_INTERVAL")
 }
 
 func validateConfig(config *Config) error {
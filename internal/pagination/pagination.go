@@ -1,31 +1,220 @@
 package pagination
 
-type PaginationParams struct {
-	Page     int `json:"page"`
-	PageSize int `json:"page_size"`
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("cursor is not valid for this list")
+
+// Params selects one page of a list: up to Limit rows after Cursor, or
+// before it when the cursor points backwards. A nil Cursor selects the first
+// page.
+type Params struct {
+	Limit  int
+	Cursor *Cursor
+}
+
+// Cursor is a position in a list, given by the sort key and ID of the row it
+// was taken from. Clients see it only as an opaque token.
+type Cursor struct {
+	Sort   string    `json:"s"`
+	Value  string    `json:"v"`
+	ID     uuid.UUID `json:"id"`
+	Before bool      `json:"b,omitempty"`
+}
+
+// Encode returns the cursor as a URL-safe token.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token returned by Encode.
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := &Cursor{}
+	if err := json.Unmarshal(data, cursor); err != nil || cursor.Sort == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// FromRequest reads the limit and cursor query parameters. A missing or
+// malformed limit falls back to DefaultLimit and limits above MaxLimit are
+// capped; a malformed cursor is an error.
+func FromRequest(r *http.Request) (Params, error) {
+	query := r.URL.Query()
+	params := Params{Limit: DefaultLimit}
+
+	if l := query.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err == nil && limit > 0 {
+			params.Limit = min(limit, MaxLimit)
+		}
+	}
+
+	if c := query.Get("cursor"); c != "" {
+		cursor, err := DecodeCursor(c)
+		if err != nil {
+			return Params{}, err
+		}
+		params.Cursor = cursor
+	}
+
+	return params, nil
+}
+
+// Order is the keyset ordering of a list: rows sorted by Column, compared as
+// SQL type Type, with ties broken by IDColumn. Name identifies the ordering
+// in cursors, so that a cursor taken from one ordering is not applied to
+// another. Key returns the sort key of a row, formatted as its SQL value, and
+// its ID. Column must not be null.
+type Order[T any] struct {
+	Name       string
+	Column     string
+	Type       string
+	IDColumn   string
+	Descending bool
+	Key        func(row T) (string, uuid.UUID)
+}
+
+// Newest orders rows newest first by the created_at and id columns of the
+// table aliased alias.
+func Newest[T any](alias string, key func(row T) (time.Time, uuid.UUID)) Order[T] {
+	return Order[T]{
+		Name:       "-created_at",
+		Column:     alias + ".created_at",
+		Type:       "timestamptz",
+		IDColumn:   alias + ".id",
+		Descending: true,
+		Key: func(row T) (string, uuid.UUID) {
+			createdAt, id := key(row)
+			return FormatTime(createdAt), id
+		},
+	}
 }
 
-type PaginatedResponse[T any] struct {
-	Data       []T `json:"data"`
-	Page       int `json:"page"`
-	PageSize   int `json:"page_size"`
-	Total      int `json:"total"`
-	TotalPages int `json:"total_pages"`
+// FormatTime formats a timestamp sort key without losing precision.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
 }
 
-func ValidatePaginationParams(params *PaginationParams) {
-	if params.Page < 1 {
-		params.Page = 1
+// Clause returns the SQL to append to the WHERE clause of a list query for
+// the page p selects: a condition keeping the rows past the cursor, the
+// ORDER BY and a LIMIT one row beyond the page, which NewPage uses to tell
+// whether more rows follow. Placeholders are numbered from len(args)+1 and
+// args is extended with their values. It returns ErrInvalidCursor when the
+// cursor was taken from a different ordering.
+func Clause[T any](p Params, order Order[T], args []any) (string, []any, error) {
+	descending := order.Descending
+	condition := ""
+
+	if p.Cursor != nil {
+		if p.Cursor.Sort != order.Name {
+			return "", nil, ErrInvalidCursor
+		}
+
+		// Paging backwards walks the list in reverse; NewPage restores the
+		// order of the rows.
+		if p.Cursor.Before {
+			descending = !descending
+		}
+
+		comparison := ">"
+		if descending {
+			comparison = "<"
+		}
+
+		args = append(args, p.Cursor.Value, p.Cursor.ID)
+		condition = fmt.Sprintf(" AND (%s, %s) %s ($%d::%s, $%d)",
+			order.Column, order.IDColumn, comparison, len(args)-1, order.Type, len(args))
 	}
-	if params.PageSize < 1 || params.PageSize > 100 {
-		params.PageSize = 10
+
+	args = append(args, p.Limit+1)
+	return fmt.Sprintf("%s%s LIMIT $%d", condition, order.orderBy(descending), len(args)), args, nil
+}
+
+// OrderBy returns the ORDER BY clause of the ordering, for queries that read
+// the whole list.
+func (o Order[T]) OrderBy() string {
+	return o.orderBy(o.Descending)
+}
+
+func (o Order[T]) orderBy(descending bool) string {
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
 	}
+
+	return fmt.Sprintf(" ORDER BY %s %s, %s %s", o.Column, direction, o.IDColumn, direction)
 }
 
-func CalculateOffset(page, pageSize int) int {
-	return (page - 1) * pageSize
+// Page is one page of a list. NextCursor and PrevCursor select the pages
+// after and before it, and are nil at either end of the list.
+type Page[T any] struct {
+	Data       []T
+	Limit      int
+	NextCursor *string
+	PrevCursor *string
 }
 
-func CalculateTotalPages(total, pageSize int) int {
-	return (total + pageSize - 1) / pageSize
+// NewPage builds the page p selects from rows fetched with the clause
+// Clause returned for it.
+func NewPage[T any](p Params, order Order[T], rows []T) *Page[T] {
+	more := len(rows) > p.Limit
+	if more {
+		rows = rows[:p.Limit]
+	}
+
+	backwards := p.Cursor != nil && p.Cursor.Before
+	if backwards {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	if rows == nil {
+		rows = []T{}
+	}
+
+	page := &Page[T]{Data: rows, Limit: p.Limit}
+	if len(rows) == 0 {
+		return page
+	}
+
+	cursor := func(row T, before bool) *string {
+		value, id := order.Key(row)
+		token := Cursor{Sort: order.Name, Value: value, ID: id, Before: before}.Encode()
+		return &token
+	}
+
+	// A page reached through a cursor always has rows on the side it was
+	// reached from.
+	if (backwards && more) || (!backwards && p.Cursor != nil) {
+		page.PrevCursor = cursor(rows[0], true)
+	}
+
+	if (!backwards && more) || backwards {
+		page.NextCursor = cursor(rows[len(rows)-1], false)
+	}
+
+	return page
 }
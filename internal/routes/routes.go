@@ -13,8 +13,8 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173", "https://kabancount.exomercado.dev"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
@@ -45,18 +45,124 @@ func SetupRoutes(app *app.Application) *chi.Mux {
 
 		r.Post("/locations", app.LocationHandler.HandleCreateLocation)
 		r.Get("/locations", app.LocationHandler.HandleGetLocationsByOrganization)
+		r.Get("/locations/{id}", app.LocationHandler.HandleGetLocationByID)
+		r.Put("/locations/{id}", app.LocationHandler.HandleUpdateLocation)
+		r.Delete("/locations/{id}", app.LocationHandler.HandleDeleteLocation)
+		r.Post("/locations/{id}/archive", app.LocationHandler.HandleArchiveLocation)
+		r.Post("/locations/{id}/restore", app.LocationHandler.HandleRestoreLocation)
+		r.Get("/locations/{id}/stock", app.LocationHandler.HandleGetLocationStock)
 
 		r.Post("/items", app.ItemHandler.HandleCreateItem)
 		r.Get("/items", app.ItemHandler.HandleGetItemsByOrganization)
+		r.Post("/items/import", app.ItemHandler.HandleImportItems)
+		r.Get("/items/export", app.ItemHandler.HandleExportItems)
+		r.Get("/items/trash", app.ItemHandler.HandleGetDeletedItems)
 		r.Get("/items/{id}", app.ItemHandler.HandleGetItemByID)
 		r.Put("/items/{id}", app.ItemHandler.HandleUpdateItem)
 		r.Delete("/items/{id}", app.ItemHandler.HandleDeleteItem)
+		r.Post("/items/{id}/restore", app.ItemHandler.HandleRestoreItem)
+
+		r.Post("/items/{id}/movements", app.StockMovementHandler.HandleCreateMovement)
+		r.Get("/items/{id}/movements", app.StockMovementHandler.HandleGetMovementsByItem)
+
+		r.Post("/transfers", app.TransferHandler.HandleCreateTransfer)
+		r.Get("/transfers", app.TransferHandler.HandleGetTransfersByOrganization)
+		r.Get("/transfers/{id}", app.TransferHandler.HandleGetTransferByID)
+		r.Post("/transfers/{id}/receive", app.TransferHandler.HandleReceiveTransfer)
+		r.Post("/transfers/{id}/cancel", app.TransferHandler.HandleCancelTransfer)
+
+		r.Post("/reservations", app.ReservationHandler.HandleCreateReservation)
+		r.Get("/reservations", app.ReservationHandler.HandleGetReservationsByOrganization)
+		r.Get("/reservations/{id}", app.ReservationHandler.HandleGetReservationByID)
+		r.Post("/reservations/{id}/release", app.ReservationHandler.HandleReleaseReservation)
+		r.Post("/reservations/{id}/commit", app.ReservationHandler.HandleCommitReservation)
 
 		r.Post("/categories", app.CategoryHandler.HandleCreateCategory)
 		r.Get("/categories", app.CategoryHandler.HandleGetCategoriesByOrganization)
+		r.Get("/categories/trash", app.CategoryHandler.HandleGetDeletedCategories)
 		r.Get("/categories/{id}", app.CategoryHandler.HandleGetCategoryByID)
 		r.Put("/categories/{id}", app.CategoryHandler.HandleUpdateCategory)
 		r.Delete("/categories/{id}", app.CategoryHandler.HandleDeleteCategory)
+		r.Post("/categories/{id}/restore", app.CategoryHandler.HandleRestoreCategory)
+		r.Get("/categories/tree", app.CategoryHandler.HandleGetCategoryTree)
+		r.Get("/categories/{id}/tree", app.CategoryHandler.HandleGetCategorySubtree)
+		r.Post("/categories/{id}/move", app.CategoryHandler.HandleMoveCategory)
+
+		r.Post("/cycle-counts", app.CycleCountHandler.HandleCreateCycleCount)
+		r.Get("/cycle-counts", app.CycleCountHandler.HandleGetCycleCountsByOrganization)
+		r.Get("/cycle-counts/{id}", app.CycleCountHandler.HandleGetCycleCountByID)
+		r.Post("/cycle-counts/{id}/counts", app.CycleCountHandler.HandleRecordCounts)
+		r.Post("/cycle-counts/{id}/approve", app.CycleCountHandler.HandleApproveCycleCount)
+		r.Post("/cycle-counts/{id}/cancel", app.CycleCountHandler.HandleCancelCycleCount)
+		r.Get("/reports/count-accuracy", app.CycleCountHandler.HandleGetCountAccuracy)
+
+		r.Get("/stock/alerts", app.StockAlertHandler.HandleGetAlertsByOrganization)
+
+		r.Post("/suppliers", app.SupplierHandler.HandleCreateSupplier)
+		r.Get("/suppliers", app.SupplierHandler.HandleGetSuppliersByOrganization)
+		r.Get("/suppliers/{id}", app.SupplierHandler.HandleGetSupplierByID)
+		r.Put("/suppliers/{id}", app.SupplierHandler.HandleUpdateSupplier)
+		r.Delete("/suppliers/{id}", app.SupplierHandler.HandleDeleteSupplier)
+
+		r.Post("/purchase-orders", app.PurchaseOrderHandler.HandleCreatePurchaseOrder)
+		r.Get("/purchase-orders", app.PurchaseOrderHandler.HandleGetPurchaseOrdersByOrganization)
+		r.Get("/purchase-orders/{id}", app.PurchaseOrderHandler.HandleGetPurchaseOrderByID)
+		r.Put("/purchase-orders/{id}", app.PurchaseOrderHandler.HandleUpdatePurchaseOrder)
+		r.Post("/purchase-orders/{id}/send", app.PurchaseOrderHandler.HandleSendPurchaseOrder)
+		r.Post("/purchase-orders/{id}/cancel", app.PurchaseOrderHandler.HandleCancelPurchaseOrder)
+		r.Post("/purchase-orders/{id}/receive", app.PurchaseOrderHandler.HandleReceivePurchaseOrder)
+
+		r.Post("/sales-orders", app.SalesOrderHandler.HandleCreateSalesOrder)
+		r.Get("/sales-orders", app.SalesOrderHandler.HandleGetSalesOrdersByOrganization)
+		r.Get("/sales-orders/{id}", app.SalesOrderHandler.HandleGetSalesOrderByID)
+		r.Put("/sales-orders/{id}", app.SalesOrderHandler.HandleUpdateSalesOrder)
+		r.Post("/sales-orders/{id}/allocate", app.SalesOrderHandler.HandleAllocateSalesOrder)
+		r.Post("/sales-orders/{id}/pick", app.SalesOrderHandler.HandlePickSalesOrder)
+		r.Post("/sales-orders/{id}/pack", app.SalesOrderHandler.HandlePackSalesOrder)
+		r.Post("/sales-orders/{id}/ship", app.SalesOrderHandler.HandleShipSalesOrder)
+		r.Post("/sales-orders/{id}/cancel", app.SalesOrderHandler.HandleCancelSalesOrder)
+
+		r.Post("/boms", app.BOMHandler.HandleCreateBOM)
+		r.Get("/boms", app.BOMHandler.HandleGetBOMsByOrganization)
+		r.Get("/boms/{id}", app.BOMHandler.HandleGetBOMByID)
+		r.Put("/boms/{id}", app.BOMHandler.HandleUpdateBOM)
+		r.Delete("/boms/{id}", app.BOMHandler.HandleDeleteBOM)
+
+		r.Post("/work-orders", app.WorkOrderHandler.HandleCreateWorkOrder)
+		r.Get("/work-orders", app.WorkOrderHandler.HandleGetWorkOrdersByOrganization)
+		r.Get("/work-orders/{id}", app.WorkOrderHandler.HandleGetWorkOrderByID)
+		r.Get("/work-orders/{id}/requirements", app.WorkOrderHandler.HandleGetWorkOrderRequirements)
+		r.Post("/work-orders/{id}/release", app.WorkOrderHandler.HandleReleaseWorkOrder)
+		r.Post("/work-orders/{id}/complete", app.WorkOrderHandler.HandleCompleteWorkOrder)
+		r.Post("/work-orders/{id}/cancel", app.WorkOrderHandler.HandleCancelWorkOrder)
+
+		r.Get("/reports/valuation", app.ValuationHandler.HandleGetValuation)
+
+		r.Get("/lots/expiring", app.LotHandler.HandleGetExpiringLots)
+		r.Get("/items/{id}/lots", app.LotHandler.HandleGetLotsByItem)
+
+		r.Get("/items/{id}/serials", app.SerialNumberHandler.HandleGetSerialNumbersByItem)
+		r.Get("/items/{id}/serials/{serial}", app.SerialNumberHandler.HandleGetSerialNumber)
+
+		r.Get("/items/{id}/units", app.UnitHandler.HandleGetItemUnits)
+		r.Post("/items/{id}/units", app.UnitHandler.HandleCreateItemUnit)
+		r.Delete("/items/{id}/units/{unitID}", app.UnitHandler.HandleDeleteItemUnit)
+
+		r.Post("/products", app.ProductHandler.HandleCreateProduct)
+		r.Get("/products", app.ProductHandler.HandleGetProductsByOrganization)
+		r.Get("/products/{id}", app.ProductHandler.HandleGetProductByID)
+		r.Put("/products/{id}", app.ProductHandler.HandleUpdateProduct)
+		r.Delete("/products/{id}", app.ProductHandler.HandleDeleteProduct)
+		r.Post("/products/{id}/variants", app.ProductHandler.HandleGenerateVariants)
+
+		r.Get("/items/{id}/kit", app.KitHandler.HandleGetKit)
+		r.Put("/items/{id}/kit", app.KitHandler.HandleSetKit)
+		r.Delete("/items/{id}/kit", app.KitHandler.HandleDeleteKit)
+
+		r.Get("/items/{id}/barcodes", app.BarcodeHandler.HandleGetItemBarcodes)
+		r.Post("/items/{id}/barcodes", app.BarcodeHandler.HandleCreateBarcode)
+		r.Delete("/items/{id}/barcodes/{barcodeID}", app.BarcodeHandler.HandleDeleteBarcode)
+		r.Get("/scan/{code}", app.BarcodeHandler.HandleScan)
 
 	})
 
@@ -0,0 +1,355 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	BarcodeTypeEAN13    = "ean13"
+	BarcodeTypeUPCA     = "upca"
+	BarcodeTypeGTIN14   = "gtin14"
+	BarcodeTypeCode128  = "code128"
+	BarcodeTypeInternal = "internal"
+)
+
+var (
+	ErrInvalidBarcode = errors.New("invalid barcode")
+	ErrBarcodeTaken   = errors.New("barcode is already assigned to an item")
+)
+
+// gtinLengths are the digit counts of the GTIN symbologies. Their codes are
+// the same number padded to different lengths, so an EAN-13 with a leading
+// zero identifies the same trade item as the UPC-A without it.
+var gtinLengths = map[string]int{
+	BarcodeTypeEAN13:  13,
+	BarcodeTypeUPCA:   12,
+	BarcodeTypeGTIN14: 14,
+}
+
+// Barcode identifies an item, or a pack of it when Unit names one of the
+// item's alternate units. Scanning it counts one Unit.
+type Barcode struct {
+	ID             uuid.UUID  `json:"id"`
+	OrganizationID uuid.UUID  `json:"organization_id"`
+	ItemID         uuid.UUID  `json:"item_id"`
+	UnitID         *uuid.UUID `json:"unit_id"`
+	Unit           string     `json:"unit"`
+	Code           string     `json:"code"`
+	Symbology      string     `json:"symbology"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// ScanResult is what a scanned barcode resolves to. Factor is the number of
+// base units one scan counts for; stock quantities are in base units.
+type ScanResult struct {
+	Barcode *Barcode    `json:"barcode"`
+	Item    *Item       `json:"item"`
+	Factor  int         `json:"factor"`
+	Stock   []ItemStock `json:"stock"`
+}
+
+type PostgresBarcodeStore struct {
+	db *sql.DB
+}
+
+func NewPostgresBarcodeStore(db *sql.DB) *PostgresBarcodeStore {
+	return &PostgresBarcodeStore{db: db}
+}
+
+type BarcodeStore interface {
+	CreateBarcode(barcode *Barcode) (*Barcode, error)
+	GetItemBarcodes(itemID uuid.UUID) ([]*Barcode, error)
+	DeleteBarcode(itemID, id uuid.UUID) error
+	ScanBarcode(organizationID uuid.UUID, code string, locationID *uuid.UUID) (*ScanResult, error)
+}
+
+// CreateBarcode assigns a barcode to an item. It returns ErrBarcodeTaken when
+// the organization already uses the code, or an equivalent GTIN, for any item.
+// The unique indexes catch a concurrent assignment the lookup misses.
+func (s *PostgresBarcodeStore) CreateBarcode(barcode *Barcode) (*Barcode, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := findBarcode(tx.QueryRow, barcode.OrganizationID, barcode.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil {
+		return nil, ErrBarcodeTaken
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO item_barcodes (organization_id, item_id, unit_id, code, symbology)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`,
+		barcode.OrganizationID,
+		barcode.ItemID,
+		barcode.UnitID,
+		barcode.Code,
+		barcode.Symbology,
+	).Scan(
+		&barcode.ID,
+		&barcode.CreatedAt,
+	)
+	if isUniqueViolation(err, "item_barcodes_organization_id_code_key") || isUniqueViolation(err, "idx_item_barcodes_gtin") {
+		return nil, ErrBarcodeTaken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return barcode, nil
+}
+
+func (s *PostgresBarcodeStore) GetItemBarcodes(itemID uuid.UUID) ([]*Barcode, error) {
+	rows, err := s.db.Query(`
+		SELECT `+barcodeColumns+`
+		FROM item_barcodes b
+		JOIN items i ON i.id = b.item_id
+		LEFT JOIN item_units u ON u.id = b.unit_id
+		WHERE b.item_id = $1
+		ORDER BY b.created_at
+	`, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	barcodes := []*Barcode{}
+	for rows.Next() {
+		barcode, err := scanBarcode(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		barcodes = append(barcodes, barcode)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return barcodes, nil
+}
+
+func (s *PostgresBarcodeStore) DeleteBarcode(itemID, id uuid.UUID) error {
+	result, err := s.db.Exec(`DELETE FROM item_barcodes WHERE id = $1 AND item_id = $2`, id, itemID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ScanBarcode resolves a scanned code to its item and unit along with the
+// item's stock levels, limited to locationID and the locations beneath it
+// when given. It returns nil when the organization has no such barcode or its
+// item is deleted.
+func (s *PostgresBarcodeStore) ScanBarcode(organizationID uuid.UUID, code string, locationID *uuid.UUID) (*ScanResult, error) {
+	barcode, err := findBarcode(s.db.QueryRow, organizationID, code)
+	if err != nil || barcode == nil {
+		return nil, err
+	}
+
+	result := &ScanResult{Barcode: barcode, Item: &Item{}, Factor: 1, Stock: []ItemStock{}}
+	err = s.db.QueryRow(`
+		SELECT i.id, i.organization_id, i.category_id, i.sku, i.name, i.description, i.base_unit, i.is_kit, i.is_active, COALESCE(u.factor, 1)
+		FROM items i
+		LEFT JOIN item_units u ON u.id = $2
+		WHERE i.id = $1 AND i.deleted_at IS NULL
+	`, barcode.ItemID, barcode.UnitID).Scan(
+		&result.Item.ID,
+		&result.Item.OrganizationID,
+		&result.Item.CategoryID,
+		&result.Item.SKU,
+		&result.Item.Name,
+		&result.Item.Description,
+		&result.Item.BaseUnit,
+		&result.Item.IsKit,
+		&result.Item.IsActive,
+		&result.Factor,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM locations WHERE id = $2
+			UNION ALL
+			SELECT l.id FROM locations l JOIN subtree t ON l.parent_id = t.id
+		)
+		SELECT id, location_id, item_id, quantity_physical, quantity_available, quantity_reserved, reorder_level, max_stock_level, last_counted_at, updated_at, version
+		FROM stock_levels
+		WHERE item_id = $1 AND ($2::uuid IS NULL OR location_id IN (SELECT id FROM subtree))
+		ORDER BY location_id
+	`, barcode.ItemID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stock ItemStock
+		err := rows.Scan(
+			&stock.ID,
+			&stock.LocationID,
+			&stock.ItemID,
+			&stock.QuantityPhysical,
+			&stock.QuantityAvailable,
+			&stock.QuantityReserved,
+			&stock.ReorderLevel,
+			&stock.MaxStockLevel,
+			&stock.LastCountedAt,
+			&stock.UpdatedAt,
+			&stock.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.Stock = append(result.Stock, stock)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+const barcodeColumns = `b.id, b.organization_id, b.item_id, b.unit_id, COALESCE(u.name, i.base_unit), b.code, b.symbology, b.created_at`
+
+func scanBarcode(scan func(dest ...any) error) (*Barcode, error) {
+	barcode := &Barcode{}
+	err := scan(
+		&barcode.ID,
+		&barcode.OrganizationID,
+		&barcode.ItemID,
+		&barcode.UnitID,
+		&barcode.Unit,
+		&barcode.Code,
+		&barcode.Symbology,
+		&barcode.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return barcode, nil
+}
+
+// findBarcode looks up code among an organization's barcodes. A numeric code
+// of GTIN length also matches GTIN barcodes that encode the same number at a
+// different length. It returns nil when nothing matches.
+func findBarcode(queryRow func(query string, args ...any) *sql.Row, organizationID uuid.UUID, code string) (*Barcode, error) {
+	barcode, err := scanBarcode(queryRow(`
+		SELECT `+barcodeColumns+`
+		FROM item_barcodes b
+		JOIN items i ON i.id = b.item_id
+		LEFT JOIN item_units u ON u.id = b.unit_id
+		WHERE b.organization_id = $1
+			AND (b.code = $2 OR ($3 AND b.symbology IN ($4, $5, $6) AND LPAD(b.code, 14, '0') = LPAD($2, 14, '0')))
+		ORDER BY b.code = $2 DESC
+		LIMIT 1
+	`, organizationID, code, isGTIN(code), BarcodeTypeEAN13, BarcodeTypeUPCA, BarcodeTypeGTIN14).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return barcode, nil
+}
+
+// ValidateBarcode checks that code is well formed for its symbology. GTIN
+// codes (EAN-13, UPC-A and GTIN-14) must have the right number of digits and
+// a valid check digit; Code 128 and internal codes must be printable ASCII.
+func ValidateBarcode(symbology, code string) error {
+	if length, ok := gtinLengths[symbology]; ok {
+		if len(code) != length || !isDigits(code) {
+			return fmt.Errorf("%w: %s codes are %d digits", ErrInvalidBarcode, symbology, length)
+		}
+
+		if gtinCheckDigit(code[:length-1]) != code[length-1] {
+			return fmt.Errorf("%w: check digit of %s does not match", ErrInvalidBarcode, code)
+		}
+
+		return nil
+	}
+
+	switch symbology {
+	case BarcodeTypeCode128, BarcodeTypeInternal:
+		if code == "" || len(code) > 80 {
+			return fmt.Errorf("%w: %s codes are 1 to 80 characters", ErrInvalidBarcode, symbology)
+		}
+
+		for _, c := range code {
+			if c < ' ' || c > '~' || (c == ' ' && symbology == BarcodeTypeInternal) {
+				return fmt.Errorf("%w: %s codes must be printable ASCII", ErrInvalidBarcode, symbology)
+			}
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: symbology must be one of ean13, upca, gtin14, code128 or internal", ErrInvalidBarcode)
+	}
+}
+
+// gtinCheckDigit computes the GS1 mod-10 check digit for the digits of a
+// GTIN without its check digit. Weights alternate 3 and 1 from the right.
+func gtinCheckDigit(digits string) byte {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		weight := 1
+		if (len(digits)-1-i)%2 == 0 {
+			weight = 3
+		}
+		sum += int(digits[i]-'0') * weight
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isGTIN(code string) bool {
+	return len(code) >= 12 && len(code) <= 14 && isDigits(code)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return s != ""
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBarcode(t *testing.T) {
+	tests := []struct {
+		name      string
+		symbology string
+		code      string
+		wantErr   bool
+	}{
+		{name: "Valid EAN-13", symbology: BarcodeTypeEAN13, code: "4006381333931"},
+		{name: "Valid UPC-A", symbology: BarcodeTypeUPCA, code: "036000291452"},
+		{name: "Valid GTIN-14", symbology: BarcodeTypeGTIN14, code: "10036000291459"},
+		{name: "Wrong check digit", symbology: BarcodeTypeEAN13, code: "4006381333932", wantErr: true},
+		{name: "Wrong length", symbology: BarcodeTypeUPCA, code: "4006381333931", wantErr: true},
+		{name: "Non-numeric GTIN", symbology: BarcodeTypeEAN13, code: "40063813339A1", wantErr: true},
+		{name: "Code 128", symbology: BarcodeTypeCode128, code: "PALLET 0042"},
+		{name: "Internal code with space", symbology: BarcodeTypeInternal, code: "BIN 7", wantErr: true},
+		{name: "Unknown symbology", symbology: "qr", code: "abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateBarcode(tt.symbology, tt.code)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidBarcode)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestScanBarcode(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	barcodes := NewPostgresBarcodeStore(db)
+
+	unit, err := NewPostgresUnitStore(db).CreateItemUnit(&ItemUnit{ItemID: item.ID, Name: "case", Factor: 12})
+	require.NoError(t, err)
+
+	_, err = barcodes.CreateBarcode(&Barcode{OrganizationID: item.OrganizationID, ItemID: item.ID, Code: "036000291452", Symbology: BarcodeTypeUPCA})
+	require.NoError(t, err)
+
+	_, err = barcodes.CreateBarcode(&Barcode{OrganizationID: item.OrganizationID, ItemID: item.ID, UnitID: &unit.ID, Code: "10036000291459", Symbology: BarcodeTypeGTIN14})
+	require.NoError(t, err)
+
+	_, err = barcodes.CreateBarcode(&Barcode{OrganizationID: item.OrganizationID, ItemID: item.ID, Code: "0036000291452", Symbology: BarcodeTypeEAN13})
+	assert.ErrorIs(t, err, ErrBarcodeTaken)
+
+	// The index holds equivalent GTINs apart even without the lookup.
+	_, err = db.Exec(`
+		INSERT INTO item_barcodes (organization_id, item_id, code, symbology)
+		VALUES ($1, $2, '0036000291452', $3)
+	`, item.OrganizationID, item.ID, BarcodeTypeEAN13)
+	assert.True(t, isUniqueViolation(err, "idx_item_barcodes_gtin"))
+
+	result, err := barcodes.ScanBarcode(item.OrganizationID, "0036000291452", &location.ID)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, item.ID, result.Item.ID)
+	assert.Equal(t, 1, result.Factor)
+	require.Len(t, result.Stock, 1)
+	assert.Equal(t, 10, result.Stock[0].QuantityAvailable)
+
+	result, err = barcodes.ScanBarcode(item.OrganizationID, "10036000291459", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "case", result.Barcode.Unit)
+	assert.Equal(t, 12, result.Factor)
+
+	result, err = barcodes.ScanBarcode(item.OrganizationID, "4006381333931", nil)
+	require.NoError(t, err)
+	assert.Nil(t, result)
+}
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/pagination"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrBOMInUse = errors.New("bill of materials has work orders")
+
+type BOM struct {
+	ID             uuid.UUID      `json:"id"`
+	OrganizationID uuid.UUID      `json:"organization_id"`
+	ItemID         uuid.UUID      `json:"item_id"`
+	Notes          *string        `json:"notes"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	Components     []BOMComponent `json:"components"`
+}
+
+// BOMComponent is the quantity of ItemID consumed to build one unit of the
+// BOM's finished item.
+type BOMComponent struct {
+	ID       uuid.UUID `json:"id"`
+	BOMID    uuid.UUID `json:"bom_id"`
+	ItemID   uuid.UUID `json:"item_id"`
+	Quantity int       `json:"quantity"`
+}
+
+type PostgresBOMStore struct {
+	db *sql.DB
+}
+
+func NewPostgresBOMStore(db *sql.DB) *PostgresBOMStore {
+	return &PostgresBOMStore{db: db}
+}
+
+type BOMStore interface {
+	CreateBOM(bom *BOM) (*BOM, error)
+	GetBOMByID(id uuid.UUID) (*BOM, error)
+	UpdateBOM(bom *BOM) (*BOM, error)
+	DeleteBOM(id uuid.UUID) error
+	GetBOMsByOrganization(params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*BOM], error)
+	CountBOMsByOrganization(organizationID uuid.UUID) (int, error)
+}
+
+func (s *PostgresBOMStore) CreateBOM(bom *BOM) (*BOM, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO boms (organization_id, item_id, notes)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`
+
+	err = tx.QueryRow(query, bom.OrganizationID, bom.ItemID, bom.Notes).Scan(
+		&bom.ID,
+		&bom.CreatedAt,
+		&bom.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertBOMComponents(tx, bom)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return bom, nil
+}
+
+func (s *PostgresBOMStore) GetBOMByID(id uuid.UUID) (*BOM, error) {
+	query := bomSelect + `
+		WHERE b.id = $1
+	`
+
+	bom, err := scanBOM(s.db.QueryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bom, nil
+}
+
+// UpdateBOM replaces the notes and component list of a BOM. Work orders keep
+// the components they were created with.
+func (s *PostgresBOMStore) UpdateBOM(bom *BOM) (*BOM, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		UPDATE boms
+		SET notes = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING created_at, updated_at
+	`, bom.Notes, bom.ID).Scan(&bom.CreatedAt, &bom.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM bom_components WHERE bom_id = $1`, bom.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertBOMComponents(tx, bom)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return bom, nil
+}
+
+func (s *PostgresBOMStore) DeleteBOM(id uuid.UUID) error {
+	var inUse bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM work_orders WHERE bom_id = $1)`, id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+
+	if inUse {
+		return ErrBOMInUse
+	}
+
+	query := `
+		DELETE FROM boms
+		WHERE id = $1
+	`
+
+	result, err := s.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// bomOrder lists bills of materials newest first.
+var bomOrder = pagination.Newest("b", func(bom *BOM) (time.Time, uuid.UUID) { return bom.CreatedAt, bom.ID })
+
+func (s *PostgresBOMStore) GetBOMsByOrganization(params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*BOM], error) {
+	pageClause, args, err := pagination.Clause(params, bomOrder, []any{organizationID})
+	if err != nil {
+		return nil, err
+	}
+
+	query := bomSelect + `
+		WHERE b.organization_id = $1` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var boms []*BOM
+	for rows.Next() {
+		bom, err := scanBOM(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		boms = append(boms, bom)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, bomOrder, boms), nil
+}
+
+func (s *PostgresBOMStore) CountBOMsByOrganization(organizationID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM boms
+		WHERE organization_id = $1
+	`
+
+	var count int
+	err := s.db.QueryRow(query, organizationID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func insertBOMComponents(tx *sql.Tx, bom *BOM) error {
+	for i := range bom.Components {
+		component := &bom.Components[i]
+		component.BOMID = bom.ID
+
+		err := tx.QueryRow(`
+			INSERT INTO bom_components (bom_id, item_id, quantity)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, component.BOMID, component.ItemID, component.Quantity).Scan(&component.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const bomSelect = `
+	SELECT b.id, b.organization_id, b.item_id, b.notes, b.created_at, b.updated_at,
+		COALESCE((
+			SELECT JSON_AGG(
+				JSON_BUILD_OBJECT(
+					'id', c.id,
+					'bom_id', c.bom_id,
+					'item_id', c.item_id,
+					'quantity', c.quantity
+				) ORDER BY c.id
+			)
+			FROM bom_components c
+			WHERE c.bom_id = b.id
+		), '[]') AS components
+	FROM boms b
+`
+
+func scanBOM(scan func(dest ...any) error) (*BOM, error) {
+	bom := &BOM{}
+	var componentsJSON []byte
+	err := scan(
+		&bom.ID,
+		&bom.OrganizationID,
+		&bom.ItemID,
+		&bom.Notes,
+		&bom.CreatedAt,
+		&bom.UpdatedAt,
+		&componentsJSON,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(componentsJSON, &bom.Components); err != nil {
+		return nil, err
+	}
+
+	return bom, nil
+}
@@ -2,20 +2,58 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kabancount/internal/pagination"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+var (
+	ErrCategoryHasChildren = errors.New("category has child categories")
+	ErrCategoryHasProducts = errors.New("category has products")
+	ErrCategoryItemsInUse  = errors.New("category has items in use")
+	ErrInvalidCategoryTree = errors.New("category cannot be moved beneath itself")
+	ErrCategoryDeleted     = errors.New("category is deleted")
+	ErrCategoryNameTaken   = errors.New("category name is already in use")
+	ErrInvalidAttributes   = errors.New("attributes do not match the category")
+)
+
+const (
+	AttributeTypeText    = "text"
+	AttributeTypeNumber  = "number"
+	AttributeTypeEnum    = "enum"
+	AttributeTypeBoolean = "boolean"
+	AttributeTypeDate    = "date"
+)
+
 type Category struct {
-	ID             uuid.UUID `json:"id"`
-	Name           string    `json:"name"`
-	Description    *string   `json:"description"`
-	OrganizationID uuid.UUID `json:"organization_id"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             uuid.UUID           `json:"id"`
+	Name           string              `json:"name"`
+	Description    *string             `json:"description"`
+	OrganizationID uuid.UUID           `json:"organization_id"`
+	ParentID       *uuid.UUID          `json:"parent_id"`
+	Attributes     []CategoryAttribute `json:"attributes"`
+	Children       []*Category         `json:"children,omitempty"`
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+	DeletedAt      *time.Time          `json:"deleted_at,omitempty"`
 }
 
+// CategoryAttribute defines a custom attribute that items in a category carry.
+// Options lists the allowed values of an enum attribute.
+type CategoryAttribute struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Options  []string `json:"options,omitempty"`
+}
+
+const categoryColumns = `id, name, description, organization_id, parent_id, attribute_schema, created_at, updated_at, deleted_at`
+
 type PostgresCategoryStore struct {
 	db *sql.DB
 }
@@ -29,22 +67,39 @@ type CategoryStore interface {
 	GetCategoryByID(id uuid.UUID) (*Category, error)
 	UpdateCategory(category *Category) (*Category, error)
 	DeleteCategory(id uuid.UUID) error
-	GetCategoryByOrganization(page, pageSize int, organizationID uuid.UUID) ([]*Category, error)
+	RestoreCategory(organizationID, id uuid.UUID) (*Category, error)
+	PurgeDeletedCategories(before time.Time) (int, error)
+	MoveCategory(id uuid.UUID, parentID *uuid.UUID) (*Category, error)
+	GetCategoryTree(organizationID uuid.UUID, rootID *uuid.UUID) ([]*Category, error)
+	GetCategoryByOrganization(params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Category], error)
 	CountCategoriesByOrganization(organizationID uuid.UUID) (int, error)
+	GetDeletedCategories(params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Category], error)
+	CountDeletedCategories(organizationID uuid.UUID) (int, error)
 }
 
 func (s *PostgresCategoryStore) CreateCategory(category *Category) (*Category, error) {
+	if category.Attributes == nil {
+		category.Attributes = []CategoryAttribute{}
+	}
+
+	attributesJSON, err := json.Marshal(category.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
-		INSERT INTO categories (name, description, organization_id)
-		VALUES ($1, $2, $3)
+		INSERT INTO categories (name, description, organization_id, parent_id, attribute_schema)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at, updated_at
 	`
 
-	err := s.db.QueryRow(
+	err = s.db.QueryRow(
 		query,
 		category.Name,
 		category.Description,
 		category.OrganizationID,
+		category.ParentID,
+		attributesJSON,
 	).Scan(
 		&category.ID,
 		&category.CreatedAt,
@@ -59,21 +114,12 @@ func (s *PostgresCategoryStore) CreateCategory(category *Category) (*Category, e
 
 func (s *PostgresCategoryStore) GetCategoryByID(id uuid.UUID) (*Category, error) {
 	query := `
-		SELECT id, name, description, organization_id, created_at, updated_at
+		SELECT ` + categoryColumns + `
 		FROM categories
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	category := &Category{}
-	err := s.db.QueryRow(query, id).Scan(
-		&category.ID,
-		&category.Name,
-		&category.Description,
-		&category.OrganizationID,
-		&category.CreatedAt,
-		&category.UpdatedAt,
-	)
-
+	category, err := scanCategory(s.db.QueryRow(query, id).Scan)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -85,18 +131,27 @@ func (s *PostgresCategoryStore) GetCategoryByID(id uuid.UUID) (*Category, error)
 	return category, nil
 }
 
+// UpdateCategory saves a category and its attribute schema. Items already in
+// the category are validated against a changed schema the next time they are
+// saved.
 func (s *PostgresCategoryStore) UpdateCategory(category *Category) (*Category, error) {
+	attributesJSON, err := json.Marshal(category.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
 	query := `
 		UPDATE categories
-		SET name = $1, description = $2, updated_at = NOW()
-		WHERE id = $3
+		SET name = $1, description = $2, attribute_schema = $3, updated_at = NOW()
+		WHERE id = $4 AND deleted_at IS NULL
 		RETURNING updated_at
 	`
 
-	err := s.db.QueryRow(
+	err = s.db.QueryRow(
 		query,
 		category.Name,
 		category.Description,
+		attributesJSON,
 		category.ID,
 	).Scan(&category.UpdatedAt)
 	if err != nil {
@@ -106,28 +161,262 @@ func (s *PostgresCategoryStore) UpdateCategory(category *Category) (*Category, e
 	return category, nil
 }
 
+// DeleteCategory moves a category and the items filed under it to the
+// trash, from which RestoreCategory brings them back until they are purged.
+// It returns ErrCategoryHasChildren while other categories sit beneath it,
+// ErrCategoryHasProducts while products are filed under it,
+// ErrCategoryItemsInUse while any of its items has stock or open documents,
+// and sql.ErrNoRows when the category does not exist or is already deleted.
 func (s *PostgresCategoryStore) DeleteCategory(id uuid.UUID) error {
-	query := `
-		DELETE FROM categories
-		WHERE id = $1
-	`
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasChildren, hasProducts bool
+	err = tx.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM categories WHERE parent_id = $1 AND deleted_at IS NULL),
+			EXISTS (SELECT 1 FROM products WHERE category_id = $1)
+	`, id).Scan(&hasChildren, &hasProducts)
+	if err != nil {
+		return err
+	}
+
+	if hasChildren {
+		return ErrCategoryHasChildren
+	}
+
+	if hasProducts {
+		return ErrCategoryHasProducts
+	}
 
-	_, err := s.db.Exec(query, id)
-	return err
+	// As in DeleteItem, locking the items holds off new rows referring to
+	// them until the check and the delete are done.
+	_, err = tx.Exec(`SELECT 1 FROM items WHERE category_id = $1 AND deleted_at IS NULL FOR UPDATE`, id)
+	if err != nil {
+		return err
+	}
+
+	var inUse bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM items i
+			WHERE i.category_id = $1 AND i.deleted_at IS NULL AND `+itemInUse+`
+		)
+	`, id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+
+	if inUse {
+		return ErrCategoryItemsInUse
+	}
+
+	var deletedAt time.Time
+	err = tx.QueryRow(`
+		UPDATE categories
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING deleted_at
+	`, id).Scan(&deletedAt)
+	if err != nil {
+		return err
+	}
+
+	// Items deleted along with the category share its deleted_at, which is
+	// how RestoreCategory tells them from items deleted on their own.
+	_, err = tx.Exec(`
+		UPDATE items
+		SET deleted_at = $2, updated_at = NOW()
+		WHERE category_id = $1 AND deleted_at IS NULL
+	`, id, deletedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (s *PostgresCategoryStore) GetCategoryByOrganization(page, pageSize int, organizationID uuid.UUID) ([]*Category, error) {
-	query := `
-		SELECT id, name, description, organization_id, created_at, updated_at
-		FROM categories
-		WHERE organization_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
-	`
+// RestoreCategory takes a deleted category of the organization out of the
+// trash together with the items deleted along with it. It returns
+// ErrCategoryDeleted while its parent is deleted, ErrCategoryNameTaken or
+// ErrItemNameTaken when a live category or item has taken a name in the
+// meantime, and sql.ErrNoRows when there is no such deleted category.
+func (s *PostgresCategoryStore) RestoreCategory(organizationID, id uuid.UUID) (*Category, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	var parentDeleted, nameTaken, itemNameTaken bool
+	err = tx.QueryRow(`
+		SELECT c.deleted_at,
+			EXISTS (SELECT 1 FROM categories p WHERE p.id = c.parent_id AND p.deleted_at IS NOT NULL),
+			EXISTS (
+				SELECT 1 FROM categories o
+				WHERE o.organization_id = c.organization_id AND o.parent_id IS NOT DISTINCT FROM c.parent_id
+					AND o.name = c.name AND o.deleted_at IS NULL
+			),
+			EXISTS (
+				SELECT 1 FROM items i
+				JOIN items o ON o.organization_id = i.organization_id AND o.name = i.name AND o.deleted_at IS NULL
+				WHERE i.category_id = c.id AND i.deleted_at = c.deleted_at
+			)
+		FROM categories c
+		WHERE c.id = $1 AND c.organization_id = $2 AND c.deleted_at IS NOT NULL
+		FOR UPDATE OF c
+	`, id, organizationID).Scan(&deletedAt, &parentDeleted, &nameTaken, &itemNameTaken)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case parentDeleted:
+		return nil, fmt.Errorf("%w: restore its parent first", ErrCategoryDeleted)
+	case nameTaken:
+		return nil, ErrCategoryNameTaken
+	case itemNameTaken:
+		return nil, ErrItemNameTaken
+	}
 
-	offset := page * pageSize
+	_, err = tx.Exec(`
+		UPDATE items
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE category_id = $1 AND deleted_at = $2
+	`, id, deletedAt)
+	if err != nil {
+		return nil, err
+	}
 
-	rows, err := s.db.Query(query, organizationID, pageSize, offset)
+	_, err = tx.Exec(`UPDATE categories SET deleted_at = NULL, updated_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCategoryByID(id)
+}
+
+// PurgeDeletedCategories permanently removes categories deleted before
+// before, once no items, products or child categories remain under them.
+// Their items are purged first by PurgeDeletedItems.
+func (s *PostgresCategoryStore) PurgeDeletedCategories(before time.Time) (int, error) {
+	purged := 0
+
+	// Each pass removes the lowest level of a deleted subtree, freeing its
+	// parents for the next.
+	for {
+		result, err := s.db.Exec(`
+			DELETE FROM categories c
+			WHERE c.deleted_at < $1
+				AND NOT EXISTS (SELECT 1 FROM categories ch WHERE ch.parent_id = c.id)
+				AND NOT EXISTS (SELECT 1 FROM items i WHERE i.category_id = c.id)
+				AND NOT EXISTS (SELECT 1 FROM products p WHERE p.category_id = c.id)
+		`, before)
+		if err != nil {
+			return purged, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return purged, err
+		}
+
+		if rowsAffected == 0 {
+			return purged, nil
+		}
+
+		purged += int(rowsAffected)
+	}
+}
+
+// MoveCategory places a category beneath parentID, or at the top level when
+// parentID is nil, taking its descendants along. It returns
+// ErrInvalidCategoryTree when parentID is the category itself or one of its
+// descendants, and sql.ErrNoRows when the category does not exist.
+func (s *PostgresCategoryStore) MoveCategory(id uuid.UUID, parentID *uuid.UUID) (*Category, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var organizationID uuid.UUID
+	err = tx.QueryRow(`SELECT organization_id FROM categories WHERE id = $1`, id).Scan(&organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockTree(tx, "categories", organizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID != nil {
+		var cyclic bool
+		err := tx.QueryRow(`
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE id = $1
+				UNION ALL
+				SELECT c.id FROM categories c JOIN subtree t ON c.parent_id = t.id
+			)
+			SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+		`, id, *parentID).Scan(&cyclic)
+		if err != nil {
+			return nil, err
+		}
+
+		if cyclic {
+			return nil, ErrInvalidCategoryTree
+		}
+	}
+
+	result, err := tx.Exec(`UPDATE categories SET parent_id = $1, updated_at = NOW() WHERE id = $2`, parentID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCategoryByID(id)
+}
+
+// GetCategoryTree returns an organization's categories nested under their
+// parents, siblings ordered by name. With a rootID it returns only that
+// category and its descendants.
+func (s *PostgresCategoryStore) GetCategoryTree(organizationID uuid.UUID, rootID *uuid.UUID) ([]*Category, error) {
+	rows, err := s.db.Query(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM categories
+			WHERE organization_id = $1 AND (id = $2 OR ($2 IS NULL AND parent_id IS NULL)) AND deleted_at IS NULL
+			UNION ALL
+			SELECT c.id FROM categories c JOIN tree t ON c.parent_id = t.id WHERE c.deleted_at IS NULL
+		)
+		SELECT `+categoryColumns+`
+		FROM categories
+		WHERE id IN (SELECT id FROM tree)
+		ORDER BY name
+	`, organizationID, rootID)
 	if err != nil {
 		return nil, err
 	}
@@ -135,15 +424,7 @@ func (s *PostgresCategoryStore) GetCategoryByOrganization(page, pageSize int, or
 
 	var categories []*Category
 	for rows.Next() {
-		category := &Category{}
-		err := rows.Scan(
-			&category.ID,
-			&category.Name,
-			&category.Description,
-			&category.OrganizationID,
-			&category.CreatedAt,
-			&category.UpdatedAt,
-		)
+		category, err := scanCategory(rows.Scan)
 		if err != nil {
 			return nil, err
 		}
@@ -154,21 +435,213 @@ func (s *PostgresCategoryStore) GetCategoryByOrganization(page, pageSize int, or
 		return nil, err
 	}
 
-	return categories, nil
+	byID := make(map[uuid.UUID]*Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	roots := []*Category{}
+	for _, category := range categories {
+		if category.ParentID == nil || (rootID != nil && category.ID == *rootID) {
+			roots = append(roots, category)
+			continue
+		}
+
+		parent := byID[*category.ParentID]
+		parent.Children = append(parent.Children, category)
+	}
+
+	return roots, nil
+}
+
+// categoryOrder lists categories newest first.
+var categoryOrder = pagination.Newest("categories", func(category *Category) (time.Time, uuid.UUID) { return category.CreatedAt, category.ID })
+
+func (s *PostgresCategoryStore) GetCategoryByOrganization(params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Category], error) {
+	return s.getCategoryPage(params, categoryOrder, organizationID, false)
 }
 
 func (s *PostgresCategoryStore) CountCategoriesByOrganization(organizationID uuid.UUID) (int, error) {
+	return s.countCategories(organizationID, false)
+}
+
+// deletedCategoryOrder lists the trash most recently deleted first.
+var deletedCategoryOrder = pagination.Order[*Category]{
+	Name:       "-deleted_at",
+	Column:     "deleted_at",
+	Type:       "timestamptz",
+	IDColumn:   "id",
+	Descending: true,
+	Key: func(category *Category) (string, uuid.UUID) {
+		return pagination.FormatTime(*category.DeletedAt), category.ID
+	},
+}
+
+// GetDeletedCategories lists the organization's categories in the trash.
+func (s *PostgresCategoryStore) GetDeletedCategories(params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Category], error) {
+	return s.getCategoryPage(params, deletedCategoryOrder, organizationID, true)
+}
+
+func (s *PostgresCategoryStore) CountDeletedCategories(organizationID uuid.UUID) (int, error) {
+	return s.countCategories(organizationID, true)
+}
+
+func (s *PostgresCategoryStore) getCategoryPage(params pagination.Params, order pagination.Order[*Category], organizationID uuid.UUID, deleted bool) (*pagination.Page[*Category], error) {
+	pageClause, args, err := pagination.Clause(params, order, []any{organizationID, deleted})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + categoryColumns + `
+		FROM categories
+		WHERE organization_id = $1 AND (deleted_at IS NOT NULL) = $2` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []*Category
+	for rows.Next() {
+		category, err := scanCategory(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, order, categories), nil
+}
+
+func (s *PostgresCategoryStore) countCategories(organizationID uuid.UUID, deleted bool) (int, error) {
 	query := `
 		SELECT COUNT(*)
 		FROM categories
-		WHERE organization_id = $1
+		WHERE organization_id = $1 AND (deleted_at IS NOT NULL) = $2
 	`
 
 	var count int
-	err := s.db.QueryRow(query, organizationID).Scan(&count)
+	err := s.db.QueryRow(query, organizationID, deleted).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
 
 	return count, nil
 }
+
+// scanCategory reads a row selected with categoryColumns.
+func scanCategory(scan func(dest ...any) error) (*Category, error) {
+	category := &Category{}
+	var attributesJSON []byte
+	err := scan(
+		&category.ID,
+		&category.Name,
+		&category.Description,
+		&category.OrganizationID,
+		&category.ParentID,
+		&attributesJSON,
+		&category.CreatedAt,
+		&category.UpdatedAt,
+		&category.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(attributesJSON, &category.Attributes); err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// ValidateAttributeSchema checks that every attribute has a unique name and a
+// known type, and that enum attributes list their options.
+func ValidateAttributeSchema(attributes []CategoryAttribute) error {
+	seen := make(map[string]bool, len(attributes))
+	for _, attribute := range attributes {
+		if attribute.Name == "" {
+			return errors.New("attribute name is required")
+		}
+
+		if seen[attribute.Name] {
+			return fmt.Errorf("attribute %s is defined more than once", attribute.Name)
+		}
+		seen[attribute.Name] = true
+
+		switch attribute.Type {
+		case AttributeTypeText, AttributeTypeNumber, AttributeTypeBoolean, AttributeTypeDate:
+			if len(attribute.Options) > 0 {
+				return fmt.Errorf("attribute %s: only enum attributes take options", attribute.Name)
+			}
+		case AttributeTypeEnum:
+			if len(attribute.Options) == 0 {
+				return fmt.Errorf("attribute %s: enum attributes need at least one option", attribute.Name)
+			}
+		default:
+			return fmt.Errorf("attribute %s: type must be one of text, number, enum, boolean or date", attribute.Name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateAttributes checks item attribute values against a category's
+// attribute schema. Every required attribute must be present, no attribute
+// outside the schema may be set, and each value must match its type; dates
+// are written as YYYY-MM-DD.
+func ValidateAttributes(schema []CategoryAttribute, values map[string]any) error {
+	defined := make(map[string]CategoryAttribute, len(schema))
+	for _, attribute := range schema {
+		defined[attribute.Name] = attribute
+
+		if value, ok := values[attribute.Name]; attribute.Required && (!ok || value == nil) {
+			return fmt.Errorf("attribute %s is required", attribute.Name)
+		}
+	}
+
+	for name, value := range values {
+		attribute, ok := defined[name]
+		if !ok {
+			return fmt.Errorf("attribute %s is not defined for the category", name)
+		}
+
+		if value == nil {
+			continue
+		}
+
+		valid := false
+		switch attribute.Type {
+		case AttributeTypeText:
+			_, valid = value.(string)
+		case AttributeTypeNumber:
+			_, valid = value.(float64)
+		case AttributeTypeBoolean:
+			_, valid = value.(bool)
+		case AttributeTypeEnum:
+			text, ok := value.(string)
+			valid = ok && slices.Contains(attribute.Options, text)
+		case AttributeTypeDate:
+			text, ok := value.(string)
+			if ok {
+				_, err := time.Parse(time.DateOnly, text)
+				valid = err == nil
+			}
+		}
+
+		if !valid {
+			if attribute.Type == AttributeTypeEnum {
+				return fmt.Errorf("attribute %s must be one of %v", name, attribute.Options)
+			}
+			return fmt.Errorf("attribute %s must be a %s", name, attribute.Type)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"kabancount/internal/pagination"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAttributes(t *testing.T) {
+	schema := []CategoryAttribute{
+		{Name: "voltage", Type: AttributeTypeNumber, Required: true},
+		{Name: "plug", Type: AttributeTypeEnum, Options: []string{"EU", "UK"}},
+		{Name: "released", Type: AttributeTypeDate},
+		{Name: "wireless", Type: AttributeTypeBoolean},
+	}
+
+	tests := []struct {
+		name    string
+		values  map[string]any
+		wantErr bool
+	}{
+		{
+			name:   "Valid values",
+			values: map[string]any{"voltage": 230.0, "plug": "EU", "released": "2024-03-01", "wireless": true},
+		},
+		{
+			name:    "Missing required attribute",
+			values:  map[string]any{"plug": "EU"},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown attribute",
+			values:  map[string]any{"voltage": 230.0, "colour": "red"},
+			wantErr: true,
+		},
+		{
+			name:    "Wrong type",
+			values:  map[string]any{"voltage": "230"},
+			wantErr: true,
+		},
+		{
+			name:    "Enum value outside options",
+			values:  map[string]any{"voltage": 230.0, "plug": "US"},
+			wantErr: true,
+		},
+		{
+			name:    "Malformed date",
+			values:  map[string]any{"voltage": 230.0, "released": "01/03/2024"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAttributes(schema, tt.values)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestMoveCategory(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, _ := seedItemAndLocation(t, db)
+	categories := NewPostgresCategoryStore(db)
+
+	child, err := categories.CreateCategory(&Category{Name: "Child", OrganizationID: item.OrganizationID, ParentID: &item.CategoryID})
+	require.NoError(t, err)
+
+	grandchild, err := categories.CreateCategory(&Category{Name: "Grandchild", OrganizationID: item.OrganizationID, ParentID: &child.ID})
+	require.NoError(t, err)
+
+	_, err = categories.MoveCategory(item.CategoryID, &grandchild.ID)
+	assert.ErrorIs(t, err, ErrInvalidCategoryTree)
+
+	assert.ErrorIs(t, categories.DeleteCategory(child.ID), ErrCategoryHasChildren)
+
+	tree, err := categories.GetCategoryTree(item.OrganizationID, nil)
+	require.NoError(t, err)
+	require.Len(t, tree, 1)
+	require.Len(t, tree[0].Children, 1)
+	assert.Equal(t, grandchild.ID, tree[0].Children[0].Children[0].ID)
+
+	items := NewPostgresItemStore(db)
+	_, err = items.CreateItem(&Item{
+		OrganizationID: item.OrganizationID,
+		CategoryID:     grandchild.ID,
+		Name:           "Nested Item",
+		UnitPrice:      100,
+		CostPrice:      50,
+		IsActive:       true,
+	})
+	require.NoError(t, err)
+
+	count, err := items.CountItemsByOrganization(item.OrganizationID, ItemFilter{CategoryID: &item.CategoryID})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = items.CountItemsByOrganization(item.OrganizationID, ItemFilter{CategoryID: &item.CategoryID, IncludeDescendants: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	moved, err := categories.MoveCategory(grandchild.ID, nil)
+	require.NoError(t, err)
+	assert.Nil(t, moved.ParentID)
+
+	count, err = items.CountItemsByOrganization(item.OrganizationID, ItemFilter{CategoryID: &item.CategoryID, IncludeDescendants: true})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// Moving two siblings beneath each other at once must not form a cycle.
+	results := make(chan error, 2)
+	go func() {
+		_, err := categories.MoveCategory(child.ID, &grandchild.ID)
+		results <- err
+	}()
+	go func() {
+		_, err := categories.MoveCategory(grandchild.ID, &child.ID)
+		results <- err
+	}()
+
+	invalid := 0
+	for range 2 {
+		err := <-results
+		if errors.Is(err, ErrInvalidCategoryTree) {
+			invalid++
+			continue
+		}
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, invalid)
+}
+
+func TestSoftDeleteCategory(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	categories := NewPostgresCategoryStore(db)
+	items := NewPostgresItemStore(db)
+
+	// The item still holds stock, so the category cannot take it to the trash.
+	assert.ErrorIs(t, categories.DeleteCategory(item.CategoryID), ErrCategoryItemsInUse)
+
+	_, err := NewPostgresStockMovementStore(db).CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeIssue,
+		Quantity:     -10,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, categories.DeleteCategory(item.CategoryID))
+	assert.ErrorIs(t, categories.DeleteCategory(item.CategoryID), sql.ErrNoRows)
+
+	deletedItem, err := items.GetItemByID(item.ID)
+	require.NoError(t, err)
+	assert.Nil(t, deletedItem)
+
+	trash, err := items.GetItemsByOrganization(pagination.Params{Limit: 10}, item.OrganizationID, ItemFilter{Deleted: true})
+	require.NoError(t, err)
+	require.Len(t, trash.Data, 1)
+	assert.NotNil(t, trash.Data[0].DeletedAt)
+
+	_, err = items.RestoreItem(item.OrganizationID, item.ID)
+	assert.ErrorIs(t, err, ErrCategoryDeleted)
+
+	restored, err := categories.RestoreCategory(item.OrganizationID, item.CategoryID)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+
+	restoredItem, err := items.GetItemByID(item.ID)
+	require.NoError(t, err)
+	require.NotNil(t, restoredItem)
+
+	require.NoError(t, categories.DeleteCategory(item.CategoryID))
+
+	purged, err := items.PurgeDeletedItems(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	purged, err = categories.PurgeDeletedCategories(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	_, err = categories.RestoreCategory(item.OrganizationID, item.CategoryID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,494 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/pagination"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CycleCountStatusOpen      = "open"
+	CycleCountStatusApproved  = "approved"
+	CycleCountStatusCancelled = "cancelled"
+)
+
+var ErrUnknownCountLine = errors.New("item is not part of the cycle count")
+
+type CycleCount struct {
+	ID             uuid.UUID        `json:"id"`
+	OrganizationID uuid.UUID        `json:"organization_id"`
+	LocationID     uuid.UUID        `json:"location_id"`
+	CategoryID     *uuid.UUID       `json:"category_id"`
+	Status         string           `json:"status"`
+	CreatedBy      *uuid.UUID       `json:"created_by"`
+	ApprovedBy     *uuid.UUID       `json:"approved_by"`
+	ApprovedAt     *time.Time       `json:"approved_at"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	Lines          []CycleCountLine `json:"lines,omitempty"`
+}
+
+type CycleCountLine struct {
+	ID               uuid.UUID  `json:"id"`
+	CycleCountID     uuid.UUID  `json:"cycle_count_id"`
+	ItemID           uuid.UUID  `json:"item_id"`
+	ExpectedQuantity int        `json:"expected_quantity"`
+	CountedQuantity  *int       `json:"counted_quantity"`
+	Variance         *int       `json:"variance"`
+	CountedBy        *uuid.UUID `json:"counted_by"`
+	CountedAt        *time.Time `json:"counted_at"`
+}
+
+type LocationCountAccuracy struct {
+	LocationID       uuid.UUID `json:"location_id"`
+	LinesCounted     int       `json:"lines_counted"`
+	LinesAccurate    int       `json:"lines_accurate"`
+	Accuracy         float64   `json:"accuracy"`
+	AbsoluteVariance int       `json:"absolute_variance"`
+	LastApprovedAt   time.Time `json:"last_approved_at"`
+}
+
+type PostgresCycleCountStore struct {
+	db *sql.DB
+}
+
+func NewPostgresCycleCountStore(db *sql.DB) *PostgresCycleCountStore {
+	return &PostgresCycleCountStore{db: db}
+}
+
+type CycleCountStore interface {
+	CreateCycleCount(cycleCount *CycleCount) (*CycleCount, error)
+	GetCycleCountByID(id uuid.UUID) (*CycleCount, error)
+	GetCycleCountsByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*CycleCount], error)
+	CountCycleCountsByOrganization(status string, organizationID uuid.UUID) (int, error)
+	RecordCounts(id uuid.UUID, lines []CycleCountLine, userID uuid.UUID) (*CycleCount, error)
+	ApproveCycleCount(id uuid.UUID, userID uuid.UUID) (*CycleCount, error)
+	CancelCycleCount(id uuid.UUID) (*CycleCount, error)
+	GetCountAccuracyByOrganization(organizationID uuid.UUID) ([]*LocationCountAccuracy, error)
+}
+
+// CreateCycleCount opens a session and snapshots every item stocked at the
+// location, optionally narrowed to one category, as a line to be counted.
+func (s *PostgresCycleCountStore) CreateCycleCount(cycleCount *CycleCount) (*CycleCount, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO cycle_counts (organization_id, location_id, category_id, status, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at, updated_at
+	`
+
+	err = tx.QueryRow(
+		query,
+		cycleCount.OrganizationID,
+		cycleCount.LocationID,
+		cycleCount.CategoryID,
+		CycleCountStatusOpen,
+		cycleCount.CreatedBy,
+	).Scan(
+		&cycleCount.ID,
+		&cycleCount.Status,
+		&cycleCount.CreatedAt,
+		&cycleCount.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO cycle_count_lines (cycle_count_id, item_id, expected_quantity)
+		SELECT $1, s.item_id, s.quantity_physical
+		FROM stock_levels s
+		INNER JOIN items i ON i.id = s.item_id
+		WHERE s.location_id = $2 AND i.organization_id = $3 AND ($4::uuid IS NULL OR i.category_id = $4) AND i.deleted_at IS NULL
+	`, cycleCount.ID, cycleCount.LocationID, cycleCount.OrganizationID, cycleCount.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := getCycleCount(tx.QueryRow, cycleCount.ID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (s *PostgresCycleCountStore) GetCycleCountByID(id uuid.UUID) (*CycleCount, error) {
+	return getCycleCount(s.db.QueryRow, id, false)
+}
+
+// cycleCountOrder lists cycle counts newest first.
+var cycleCountOrder = pagination.Newest("cycle_counts", func(cycleCount *CycleCount) (time.Time, uuid.UUID) { return cycleCount.CreatedAt, cycleCount.ID })
+
+func (s *PostgresCycleCountStore) GetCycleCountsByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*CycleCount], error) {
+	pageClause, args, err := pagination.Clause(params, cycleCountOrder, []any{organizationID, status})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, organization_id, location_id, category_id, status, created_by, approved_by, approved_at, created_at, updated_at
+		FROM cycle_counts
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2)` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cycleCounts []*CycleCount
+	for rows.Next() {
+		cycleCount := &CycleCount{}
+		err := rows.Scan(
+			&cycleCount.ID,
+			&cycleCount.OrganizationID,
+			&cycleCount.LocationID,
+			&cycleCount.CategoryID,
+			&cycleCount.Status,
+			&cycleCount.CreatedBy,
+			&cycleCount.ApprovedBy,
+			&cycleCount.ApprovedAt,
+			&cycleCount.CreatedAt,
+			&cycleCount.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		cycleCounts = append(cycleCounts, cycleCount)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, cycleCountOrder, cycleCounts), nil
+}
+
+func (s *PostgresCycleCountStore) CountCycleCountsByOrganization(status string, organizationID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM cycle_counts
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2)
+	`
+
+	var count int
+	err := s.db.QueryRow(query, organizationID, status).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// RecordCounts stores counted quantities for lines of an open session. The
+// expected quantity is refreshed from stock_levels at the same moment so the
+// variance reflects stock on hand when the count was taken.
+func (s *PostgresCycleCountStore) RecordCounts(id uuid.UUID, lines []CycleCountLine, userID uuid.UUID) (*CycleCount, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cycleCount, err := getCycleCount(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if cycleCount == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if cycleCount.Status != CycleCountStatusOpen {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	for _, line := range lines {
+		result, err := tx.Exec(`
+			UPDATE cycle_count_lines l
+			SET counted_quantity = $1,
+				counted_by = $2,
+				counted_at = NOW(),
+				expected_quantity = COALESCE((
+					SELECT quantity_physical
+					FROM stock_levels
+					WHERE item_id = l.item_id AND location_id = $3
+				), 0)
+			WHERE l.cycle_count_id = $4 AND l.item_id = $5
+		`, line.CountedQuantity, userID, cycleCount.LocationID, id, line.ItemID)
+		if err != nil {
+			return nil, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+
+		if rowsAffected == 0 {
+			return nil, ErrUnknownCountLine
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE cycle_counts SET updated_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := getCycleCount(tx.QueryRow, id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// ApproveCycleCount posts the variance recorded for every counted line as an
+// adjustment and stamps last_counted_at. The variance is taken against stock
+// when the count was recorded, so movements posted since are kept. Lines that
+// were never counted are left untouched.
+func (s *PostgresCycleCountStore) ApproveCycleCount(id uuid.UUID, userID uuid.UUID) (*CycleCount, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cycleCount, err := getCycleCount(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if cycleCount == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if cycleCount.Status != CycleCountStatusOpen {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	for _, line := range cycleCount.Lines {
+		if line.CountedQuantity == nil {
+			continue
+		}
+
+		_, err := tx.Exec(`
+			SELECT 1
+			FROM stock_levels
+			WHERE item_id = $1 AND location_id = $2
+			FOR UPDATE
+		`, line.ItemID, cycleCount.LocationID)
+		if err != nil {
+			return nil, err
+		}
+
+		if delta := *line.CountedQuantity - line.ExpectedQuantity; delta != 0 {
+			err := postMovement(tx, &StockMovement{
+				ItemID:        line.ItemID,
+				LocationID:    cycleCount.LocationID,
+				MovementType:  MovementTypeAdjustment,
+				Quantity:      delta,
+				ReferenceType: stringPtr(ReferenceTypeCycleCount),
+				ReferenceID:   &cycleCount.ID,
+				Reason:        stringPtr("cycle count variance"),
+				CreatedBy:     &userID,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = tx.Exec(`
+			UPDATE stock_levels
+			SET last_counted_at = $1, version = version + 1, updated_at = NOW()
+			WHERE item_id = $2 AND location_id = $3
+		`, line.CountedAt, line.ItemID, cycleCount.LocationID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE cycle_counts
+		SET status = $1, approved_by = $2, approved_at = NOW(), updated_at = NOW()
+		WHERE id = $3
+	`, CycleCountStatusApproved, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	approved, err := getCycleCount(tx.QueryRow, id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return approved, nil
+}
+
+func (s *PostgresCycleCountStore) CancelCycleCount(id uuid.UUID) (*CycleCount, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	cycleCount, err := getCycleCount(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if cycleCount == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if cycleCount.Status != CycleCountStatusOpen {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	err = tx.QueryRow(`
+		UPDATE cycle_counts
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, updated_at
+	`, CycleCountStatusCancelled, id).Scan(&cycleCount.Status, &cycleCount.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return cycleCount, nil
+}
+
+// GetCountAccuracyByOrganization summarises approved counts per location. A
+// line is accurate when its counted quantity matched the expected quantity.
+func (s *PostgresCycleCountStore) GetCountAccuracyByOrganization(organizationID uuid.UUID) ([]*LocationCountAccuracy, error) {
+	query := `
+		SELECT c.location_id,
+			COUNT(*) AS lines_counted,
+			COUNT(*) FILTER (WHERE l.counted_quantity = l.expected_quantity) AS lines_accurate,
+			COALESCE(SUM(ABS(l.counted_quantity - l.expected_quantity)), 0) AS absolute_variance,
+			MAX(c.approved_at) AS last_approved_at
+		FROM cycle_counts c
+		INNER JOIN cycle_count_lines l ON l.cycle_count_id = c.id
+		WHERE c.organization_id = $1 AND c.status = $2 AND l.counted_quantity IS NOT NULL
+		GROUP BY c.location_id
+		ORDER BY c.location_id
+	`
+
+	rows, err := s.db.Query(query, organizationID, CycleCountStatusApproved)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var report []*LocationCountAccuracy
+	for rows.Next() {
+		accuracy := &LocationCountAccuracy{}
+		err := rows.Scan(
+			&accuracy.LocationID,
+			&accuracy.LinesCounted,
+			&accuracy.LinesAccurate,
+			&accuracy.AbsoluteVariance,
+			&accuracy.LastApprovedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if accuracy.LinesCounted > 0 {
+			accuracy.Accuracy = float64(accuracy.LinesAccurate) / float64(accuracy.LinesCounted)
+		}
+		report = append(report, accuracy)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func getCycleCount(queryRow func(query string, args ...any) *sql.Row, id uuid.UUID, forUpdate bool) (*CycleCount, error) {
+	query := `
+		SELECT c.id, c.organization_id, c.location_id, c.category_id, c.status, c.created_by, c.approved_by, c.approved_at, c.created_at, c.updated_at,
+			COALESCE((
+				SELECT JSON_AGG(
+					JSON_BUILD_OBJECT(
+						'id', l.id,
+						'cycle_count_id', l.cycle_count_id,
+						'item_id', l.item_id,
+						'expected_quantity', l.expected_quantity,
+						'counted_quantity', l.counted_quantity,
+						'variance', l.counted_quantity - l.expected_quantity,
+						'counted_by', l.counted_by,
+						'counted_at', l.counted_at
+					) ORDER BY l.item_id
+				)
+				FROM cycle_count_lines l
+				WHERE l.cycle_count_id = c.id
+			), '[]') AS lines
+		FROM cycle_counts c
+		WHERE c.id = $1
+	`
+	if forUpdate {
+		query += " FOR UPDATE OF c"
+	}
+
+	cycleCount := &CycleCount{}
+	var linesJSON []byte
+	err := queryRow(query, id).Scan(
+		&cycleCount.ID,
+		&cycleCount.OrganizationID,
+		&cycleCount.LocationID,
+		&cycleCount.CategoryID,
+		&cycleCount.Status,
+		&cycleCount.CreatedBy,
+		&cycleCount.ApprovedBy,
+		&cycleCount.ApprovedAt,
+		&cycleCount.CreatedAt,
+		&cycleCount.UpdatedAt,
+		&linesJSON,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(linesJSON, &cycleCount.Lines); err != nil {
+		return nil, err
+	}
+
+	return cycleCount, nil
+}
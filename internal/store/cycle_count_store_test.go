@@ -0,0 +1,70 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCycleCounts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	user := seedUser(t, db, item.OrganizationID)
+	counts := NewPostgresCycleCountStore(db)
+
+	cycleCount, err := counts.CreateCycleCount(&CycleCount{OrganizationID: item.OrganizationID, LocationID: location.ID})
+	require.NoError(t, err)
+	require.Len(t, cycleCount.Lines, 1)
+	assert.Equal(t, 10, cycleCount.Lines[0].ExpectedQuantity)
+
+	counted := 7
+	_, err = counts.RecordCounts(cycleCount.ID, []CycleCountLine{{ItemID: uuid.New(), CountedQuantity: &counted}}, user.ID)
+	assert.ErrorIs(t, err, ErrUnknownCountLine)
+
+	// Stock moving between the snapshot and the count is reflected in the
+	// expected quantity the variance is taken against.
+	_, err = NewPostgresStockMovementStore(db).CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeIssue,
+		Quantity:     -2,
+	})
+	require.NoError(t, err)
+
+	cycleCount, err = counts.RecordCounts(cycleCount.ID, []CycleCountLine{{ItemID: item.ID, CountedQuantity: &counted}}, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 8, cycleCount.Lines[0].ExpectedQuantity)
+	require.NotNil(t, cycleCount.Lines[0].Variance)
+	assert.Equal(t, -1, *cycleCount.Lines[0].Variance)
+
+	// Stock moving between the count and its approval is kept: approval
+	// posts the recorded variance, not the count over current stock.
+	_, err = NewPostgresStockMovementStore(db).CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeIssue,
+		Quantity:     -3,
+	})
+	require.NoError(t, err)
+
+	cycleCount, err = counts.ApproveCycleCount(cycleCount.ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, CycleCountStatusApproved, cycleCount.Status)
+
+	physical, _ := readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 4, physical)
+
+	_, err = counts.CancelCycleCount(cycleCount.ID)
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+	accuracy, err := counts.GetCountAccuracyByOrganization(item.OrganizationID)
+	require.NoError(t, err)
+	require.Len(t, accuracy, 1)
+	assert.Equal(t, 1, accuracy[0].LinesCounted)
+	assert.Equal(t, 0, accuracy[0].LinesAccurate)
+	assert.Equal(t, 1, accuracy[0].AbsoluteVariance)
+}
@@ -1,60 +1,263 @@
 package store
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"kabancount/internal/pagination"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+var ErrVersionConflict = errors.New("item or its stock levels were modified concurrently")
+
+var ErrItemHasStock = errors.New("item has stock on hand")
+
+var ErrItemInUse = errors.New("item has stock, active reservations or open orders")
+
+var ErrBaseUnitInUse = errors.New("base unit cannot change while the item has stock or alternate units")
+
 type Item struct {
-	ID             uuid.UUID   `json:"id"`
-	SKU            *string     `json:"sku"`
-	OrganizationID uuid.UUID   `json:"organization_id"`
-	CategoryID     uuid.UUID   `json:"category_id"`
-	Name           string      `json:"name"`
-	Description    *string     `json:"description"`
-	Color          *string     `json:"color"`
-	Weight         *float64    `json:"weight"`
-	Length         *float64    `json:"length"`
-	Width          *float64    `json:"width"`
-	Height         *float64    `json:"height"`
-	UnitPrice      int         `json:"unit_price"`
-	CostPrice      int         `json:"cost_price"`
-	IsActive       bool        `json:"is_active"`
-	CreatedAt      time.Time   `json:"created_at"`
-	UpdatedAt      time.Time   `json:"updated_at"`
-	Stock          []ItemStock `json:"stock,omitempty"`
+	ID             uuid.UUID         `json:"id"`
+	SKU            *string           `json:"sku"`
+	OrganizationID uuid.UUID         `json:"organization_id"`
+	CategoryID     uuid.UUID         `json:"category_id"`
+	Name           string            `json:"name"`
+	Description    *string           `json:"description"`
+	Color          *string           `json:"color"`
+	Weight         *float64          `json:"weight"`
+	Length         *float64          `json:"length"`
+	Width          *float64          `json:"width"`
+	Height         *float64          `json:"height"`
+	UnitPrice      int               `json:"unit_price"`
+	CostPrice      int               `json:"cost_price"`
+	IsActive       bool              `json:"is_active"`
+	TrackSerials   bool              `json:"track_serials"`
+	IsKit          bool              `json:"is_kit"`
+	BaseUnit       string            `json:"base_unit"`
+	ProductID      *uuid.UUID        `json:"product_id,omitempty"`
+	OptionValues   map[string]string `json:"option_values,omitempty"`
+	Attributes     map[string]any    `json:"attributes"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	DeletedAt      *time.Time        `json:"deleted_at,omitempty"`
+	Stock          []ItemStock       `json:"stock,omitempty"`
 }
 
 type ItemStock struct {
-	ID                uuid.UUID `json:"id"`
-	LocationID        uuid.UUID `json:"location_id"`
-	ItemID            uuid.UUID `json:"item_id"`
-	QuantityPhysical  int       `json:"quantity_physical"`
-	QuantityAvailable int       `json:"quantity_available"`
-	QuantityReserved  int       `json:"quantity_reserved"`
-	ReorderLevel      int       `json:"reorder_level"`
-	MaxStockLevel     int       `json:"max_stock_level"`
-	LastCountedAt     time.Time `json:"last_counted_at"`
-	UpdatedAt         time.Time `json:"updated_at"`
-	Version           int       `json:"version"`
+	ID                uuid.UUID  `json:"id"`
+	LocationID        uuid.UUID  `json:"location_id"`
+	ItemID            uuid.UUID  `json:"item_id"`
+	QuantityPhysical  int        `json:"quantity_physical"`
+	QuantityAvailable int        `json:"quantity_available"`
+	QuantityReserved  int        `json:"quantity_reserved"`
+	ReorderLevel      int        `json:"reorder_level"`
+	MaxStockLevel     int        `json:"max_stock_level"`
+	LastCountedAt     *time.Time `json:"last_counted_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+	Version           int        `json:"version"`
+
+	// Unit names the unit QuantityAvailable is given in on input. Stock is
+	// always stored and returned in base units.
+	Unit string `json:"unit,omitempty"`
+}
+
+// ETag identifies the state of an item and its stock levels. It changes
+// whenever the item row is updated or any stock level version is bumped.
+func (item *Item) ETag() string {
+	stock := make([]string, 0, len(item.Stock))
+	for _, s := range item.Stock {
+		stock = append(stock, fmt.Sprintf("%s:%d", s.LocationID, s.Version))
+	}
+	sort.Strings(stock)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|%s", item.ID, item.UpdatedAt.UnixMicro(), strings.Join(stock, ","))
+
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16])
 }
 
-type ItemStockMovement struct {
-	ID            uuid.UUID `json:"id"`
-	ItemID        uuid.UUID `json:"item_id"`
-	LocationID    uuid.UUID `json:"location_id"`
-	MovementType  string    `json:"movement_type"`
-	Quantity      int       `json:"quantity"`
-	ReferenceType string    `json:"reference_type"`
-	ReferenceID   uuid.UUID `json:"reference_id"`
-	Reason        *string   `json:"reason"`
-	CreatedAt     time.Time `json:"created_at"`
-	CreatedBy     uuid.UUID `json:"created_by"`
-	BatchID       *string   `json:"batch_id"`
-	UpdatedAt     time.Time `json:"updated_at"`
+var ErrInvalidItemSort = errors.New("sort must be one of name, sku, unit_price, cost_price, created_at or updated_at, or deleted_at in the trash, optionally prefixed with - for descending order")
+
+// itemSortColumns are the columns item listings can be sorted by, with the
+// SQL type and value of each as a cursor key. Items without a SKU sort as an
+// empty one.
+var itemSortColumns = map[string]struct {
+	column  string
+	sqlType string
+	key     func(item *Item) string
+}{
+	"name": {"i.name", "text", func(item *Item) string { return item.Name }},
+	"sku": {"COALESCE(i.sku, '')", "text", func(item *Item) string {
+		if item.SKU == nil {
+			return ""
+		}
+		return *item.SKU
+	}},
+	"unit_price": {"i.unit_price", "integer", func(item *Item) string { return strconv.Itoa(item.UnitPrice) }},
+	"cost_price": {"i.cost_price", "integer", func(item *Item) string { return strconv.Itoa(item.CostPrice) }},
+	"created_at": {"i.created_at", "timestamptz", func(item *Item) string { return pagination.FormatTime(item.CreatedAt) }},
+	"updated_at": {"i.updated_at", "timestamptz", func(item *Item) string { return pagination.FormatTime(item.UpdatedAt) }},
+	"deleted_at": {"i.deleted_at", "timestamptz", func(item *Item) string { return pagination.FormatTime(*item.DeletedAt) }},
+}
+
+// ItemFilter narrows item listings. Search matches items whose name, SKU or
+// description contains it, ignoring case. CategoryID keeps the items filed
+// directly under a category, or anywhere beneath it with IncludeDescendants.
+// IsActive keeps active or inactive items only, and MinPrice and MaxPrice
+// bound the unit price. LocationID keeps items stocked at a location or any
+// location beneath it, and LowStock items whose available stock is at or
+// below its reorder level, at that location when one is given. Attributes
+// matches items whose custom attributes hold the given values, written as
+// text. Deleted lists the items in the trash in place of live ones.
+//
+// Sort names a column from itemSortColumns, prefixed with - for descending
+// order. It orders listings and is ignored by counts.
+type ItemFilter struct {
+	Search             string
+	CategoryID         *uuid.UUID
+	IncludeDescendants bool
+	IsActive           *bool
+	MinPrice           *int
+	MaxPrice           *int
+	LocationID         *uuid.UUID
+	LowStock           bool
+	Attributes         map[string]string
+	Deleted            bool
+	Sort               string
+}
+
+// where returns the conditions of f as SQL to append to a WHERE clause on
+// items aliased i, with placeholders numbered from len(args)+1, and args
+// extended with their values.
+func (f ItemFilter) where(args []any) (string, []any) {
+	names := make([]string, 0, len(f.Attributes))
+	for name := range f.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var clause strings.Builder
+	if f.Deleted {
+		clause.WriteString(" AND i.deleted_at IS NOT NULL")
+	} else {
+		clause.WriteString(" AND i.deleted_at IS NULL")
+	}
+
+	if f.Search != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.Search) + "%"
+		args = append(args, pattern)
+		fmt.Fprintf(&clause, " AND (i.name ILIKE $%[1]d OR i.sku ILIKE $%[1]d OR i.description ILIKE $%[1]d)", len(args))
+	}
+
+	if f.CategoryID != nil {
+		args = append(args, *f.CategoryID)
+		if f.IncludeDescendants {
+			fmt.Fprintf(&clause, ` AND i.category_id IN (
+				WITH RECURSIVE subtree AS (
+					SELECT id FROM categories WHERE id = $%d
+					UNION ALL
+					SELECT c.id FROM categories c JOIN subtree t ON c.parent_id = t.id
+				)
+				SELECT id FROM subtree
+			)`, len(args))
+		} else {
+			fmt.Fprintf(&clause, " AND i.category_id = $%d", len(args))
+		}
+	}
+
+	if f.IsActive != nil {
+		args = append(args, *f.IsActive)
+		fmt.Fprintf(&clause, " AND i.is_active = $%d", len(args))
+	}
+
+	if f.MinPrice != nil {
+		args = append(args, *f.MinPrice)
+		fmt.Fprintf(&clause, " AND i.unit_price >= $%d", len(args))
+	}
+
+	if f.MaxPrice != nil {
+		args = append(args, *f.MaxPrice)
+		fmt.Fprintf(&clause, " AND i.unit_price <= $%d", len(args))
+	}
+
+	var stockConditions []string
+	if f.LocationID != nil {
+		args = append(args, *f.LocationID)
+		stockConditions = append(stockConditions, fmt.Sprintf(`sl.location_id IN (
+				WITH RECURSIVE subtree AS (
+					SELECT id FROM locations WHERE id = $%d
+					UNION ALL
+					SELECT l.id FROM locations l JOIN subtree t ON l.parent_id = t.id
+				)
+				SELECT id FROM subtree
+			)`, len(args)))
+	}
+
+	if f.LowStock {
+		stockConditions = append(stockConditions, "sl.quantity_available <= sl.reorder_level AND sl.reorder_level > 0")
+	}
+
+	if len(stockConditions) > 0 {
+		fmt.Fprintf(&clause, " AND EXISTS (SELECT 1 FROM stock_levels sl WHERE sl.item_id = i.id AND %s)", strings.Join(stockConditions, " AND "))
+	}
+
+	// Containment can use the GIN index on attributes. A value that reads
+	// as a number or boolean also matches attributes stored with that type.
+	for _, name := range names {
+		value := f.Attributes[name]
+		args = append(args, name)
+		key := len(args)
+
+		args = append(args, value)
+		matches := []string{fmt.Sprintf("i.attributes @> jsonb_build_object($%d::text, $%d::text)", key, len(args))}
+
+		if number, err := strconv.ParseFloat(value, 64); err == nil && json.Valid([]byte(value)) {
+			args = append(args, number)
+			matches = append(matches, fmt.Sprintf("i.attributes @> jsonb_build_object($%d::text, $%d::numeric)", key, len(args)))
+		}
+
+		if value == "true" || value == "false" {
+			args = append(args, value == "true")
+			matches = append(matches, fmt.Sprintf("i.attributes @> jsonb_build_object($%d::text, $%d::boolean)", key, len(args)))
+		}
+
+		fmt.Fprintf(&clause, " AND (%s)", strings.Join(matches, " OR "))
+	}
+
+	return clause.String(), args
+}
+
+// order returns the ordering for f.Sort, or for defaultSort when it is empty.
+// Ties are broken by ID so pages do not overlap.
+func (f ItemFilter) order(defaultSort string) (pagination.Order[*Item], error) {
+	sortBy := f.Sort
+	if sortBy == "" {
+		sortBy = defaultSort
+	}
+
+	name, descending := strings.CutPrefix(sortBy, "-")
+	column, ok := itemSortColumns[name]
+	if !ok || (name == "deleted_at" && !f.Deleted) {
+		return pagination.Order[*Item]{}, ErrInvalidItemSort
+	}
+
+	return pagination.Order[*Item]{
+		Name:       sortBy,
+		Column:     column.column,
+		Type:       column.sqlType,
+		IDColumn:   "i.id",
+		Descending: descending,
+		Key: func(item *Item) (string, uuid.UUID) {
+			return column.key(item), item.ID
+		},
+	}, nil
 }
 
 type PostgresItemStore struct {
@@ -67,11 +270,16 @@ func NewPostgresItemStore(db *sql.DB) *PostgresItemStore {
 
 type ItemStore interface {
 	CreateItem(item *Item) (*Item, error)
+	ImportItems(items []*Item) ([]*Item, error)
+	GetTakenItemNames(organizationID uuid.UUID, names []string) (map[string]bool, error)
 	GetItemByID(id uuid.UUID) (*Item, error)
-	UpdateItem(item *Item) (*Item, error)
+	UpdateItem(item *Item, ifMatch string) (*Item, error)
 	DeleteItem(id uuid.UUID) error
-	GetItemsByOrganization(page, pageSize int, organizationID uuid.UUID) ([]*Item, error)
-	CountItemsByOrganization(organizationID uuid.UUID) (int, error)
+	RestoreItem(organizationID, id uuid.UUID) (*Item, error)
+	PurgeDeletedItems(before time.Time) (int, error)
+	GetItemsByOrganization(params pagination.Params, organizationID uuid.UUID, filter ItemFilter) (*pagination.Page[*Item], error)
+	CountItemsByOrganization(organizationID uuid.UUID, filter ItemFilter) (int, error)
+	ExportItems(organizationID uuid.UUID, filter ItemFilter, fn func(item *Item) error) error
 	GetItemOrgID(id uuid.UUID) (uuid.UUID, error)
 }
 
@@ -82,13 +290,103 @@ func (s *PostgresItemStore) CreateItem(item *Item) (*Item, error) {
 	}
 	defer tx.Rollback()
 
+	err = insertItem(tx, item)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// ItemImportError is the error ImportItems returns for the item it failed on,
+// Index being its position in the items given.
+type ItemImportError struct {
+	Index int
+	Name  string
+	Err   error
+}
+
+func (e *ItemImportError) Error() string {
+	return fmt.Sprintf("item %s: %v", e.Name, e.Err)
+}
+
+func (e *ItemImportError) Unwrap() error {
+	return e.Err
+}
+
+// ImportItems creates items in one transaction, so either all of them are
+// created or, on the first error, none are. That error is an
+// *ItemImportError.
+func (s *PostgresItemStore) ImportItems(items []*Item) ([]*Item, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i, item := range items {
+		err := insertItem(tx, item)
+		if err != nil {
+			return nil, &ItemImportError{Index: i, Name: item.Name, Err: err}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// GetTakenItemNames returns which of names are already used by live items of
+// the organization.
+func (s *PostgresItemStore) GetTakenItemNames(organizationID uuid.UUID, names []string) (map[string]bool, error) {
+	rows, err := s.db.Query(`SELECT name FROM items WHERE organization_id = $1 AND name = ANY($2) AND deleted_at IS NULL`, organizationID, names)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taken := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		taken[name] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return taken, nil
+}
+
+// insertItem inserts an item and receives its initial stock.
+func insertItem(tx *sql.Tx, item *Item) error {
+	if item.Attributes == nil {
+		item.Attributes = map[string]any{}
+	}
+
+	attributesJSON, err := json.Marshal(item.Attributes)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO items (sku, organization_id, category_id, name, description, color, weight, length, width, height, unit_price, cost_price, is_active)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		INSERT INTO items (sku, organization_id, category_id, name, description, color, weight, length, width, height, unit_price, cost_price, is_active, track_serials, base_unit, attributes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 		RETURNING id, created_at, updated_at
 	`
 
-	err = s.db.QueryRow(
+	err = tx.QueryRow(
 		query,
 		item.SKU,
 		item.OrganizationID,
@@ -103,55 +401,40 @@ func (s *PostgresItemStore) CreateItem(item *Item) (*Item, error) {
 		item.UnitPrice,
 		item.CostPrice,
 		item.IsActive,
+		item.TrackSerials,
+		item.BaseUnit,
+		attributesJSON,
 	).Scan(
 		&item.ID,
 		&item.CreatedAt,
 		&item.UpdatedAt,
 	)
+	if isUniqueViolation(err, "items_organization_name_key") {
+		return fmt.Errorf("%w: %s", ErrItemNameTaken, item.Name)
+	}
+
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	for i := range item.Stock {
+		item.Stock[i].Version = 0
 
-		query := `
-			INSERT INTO stock_levels (location_id, item_id, quantity_physical, quantity_available, quantity_reserved, reorder_level, max_stock_level, last_counted_at, version)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-			RETURNING id, updated_at`
-		err := s.db.QueryRow(
-			query,
-			item.Stock[i].LocationID,
-			item.ID,
-			item.Stock[i].QuantityAvailable,
-			item.Stock[i].QuantityAvailable,
-			item.Stock[i].QuantityReserved,
-			item.Stock[i].ReorderLevel,
-			item.Stock[i].MaxStockLevel,
-			item.Stock[i].LastCountedAt,
-			1, // initial version
-		).Scan(
-			&item.Stock[i].ID,
-			&item.Stock[i].UpdatedAt,
-		)
+		err := setItemStock(tx, item.ID, &item.Stock[i], MovementTypeReceipt)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return nil, err
-	}
-
-	return item, nil
+	return nil
 }
 
 func (s *PostgresItemStore) GetItemByID(id uuid.UUID) (*Item, error) {
 	item := &Item{}
-	var stockLevelJSON []byte
+	var optionValuesJSON, attributesJSON, stockLevelJSON []byte
 	query := `
-		SELECT i.id, i.sku, i.organization_id, i.category_id, i.name, i.description, i.color, i.weight, i.length, i.width, i.height, i.unit_price, i.cost_price, i.is_active, i.created_at, i.updated_at,
-		COALESCE(ARRAY_AGG(
+		SELECT i.id, i.sku, i.organization_id, i.category_id, i.name, i.description, i.color, i.weight, i.length, i.width, i.height, i.unit_price, i.cost_price, i.is_active, i.track_serials, i.is_kit, i.base_unit, i.product_id, i.option_values, i.attributes, i.created_at, i.updated_at,
+		COALESCE(JSON_AGG(
 			JSON_BUILD_OBJECT(
 				'id', s.id,
 				'location_id', s.location_id,
@@ -164,11 +447,12 @@ func (s *PostgresItemStore) GetItemByID(id uuid.UUID) (*Item, error) {
 				'last_counted_at', s.last_counted_at,
 				'updated_at', s.updated_at,
 				'version', s.version
-			)
-		) FILTER (WHERE s.id IS NOT NULL), '{}') AS stock_levels
+			) ORDER BY s.location_id
+		) FILTER (WHERE s.id IS NOT NULL), '[]') AS stock_levels
 		FROM items i
 		LEFT JOIN stock_levels s ON i.id = s.item_id
-		WHERE id = $1
+		WHERE i.id = $1 AND i.deleted_at IS NULL
+		GROUP BY i.id
 	`
 	err := s.db.QueryRow(query, id).Scan(
 		&item.ID,
@@ -185,6 +469,12 @@ func (s *PostgresItemStore) GetItemByID(id uuid.UUID) (*Item, error) {
 		&item.UnitPrice,
 		&item.CostPrice,
 		&item.IsActive,
+		&item.TrackSerials,
+		&item.IsKit,
+		&item.BaseUnit,
+		&item.ProductID,
+		&optionValuesJSON,
+		&attributesJSON,
 		&item.CreatedAt,
 		&item.UpdatedAt,
 		&stockLevelJSON,
@@ -197,49 +487,30 @@ func (s *PostgresItemStore) GetItemByID(id uuid.UUID) (*Item, error) {
 		return nil, err
 	}
 
+	if optionValuesJSON != nil {
+		if err := json.Unmarshal(optionValuesJSON, &item.OptionValues); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := json.Unmarshal(attributesJSON, &item.Attributes); err != nil {
+		return nil, err
+	}
+
 	if err := json.Unmarshal(stockLevelJSON, &item.Stock); err != nil {
 		return nil, err
 	}
 
-	// stockQuery := `
-	// 	SELECT id, location_id, item_id, quantity_physical, quantity_available, quantity_reserved, reorder_level, max_stock_level, last_counted_at, updated_at, version
-	// 	FROM stock_levels
-	// 	WHERE item_id = $1
-	// `
-	//
-	// rows, err := s.db.Query(stockQuery, item.ID)
-	// if err != nil {
-	// 	return nil, err
-	// }
-	//
-	// for rows.Next() {
-	// 	var stock ItemStock
-	// 	err := rows.Scan(
-	// 		&stock.ID,
-	// 		&stock.LocationID,
-	// 		&stock.ItemID,
-	// 		&stock.QuantityPhysical,
-	// 		&stock.QuantityAvailable,
-	// 		&stock.QuantityReserved,
-	// 		&stock.ReorderLevel,
-	// 		&stock.MaxStockLevel,
-	// 		&stock.LastCountedAt,
-	// 		&stock.UpdatedAt,
-	// 		&stock.Version,
-	// 	)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	item.Stock = append(item.Stock, stock)
-	// }
-	// if err = rows.Err(); err != nil {
-	// 	return nil, err
-	// }
-	//
 	return item, nil
 }
 
-func (s *PostgresItemStore) UpdateItem(item *Item) (*Item, error) {
+// UpdateItem updates an item and sets its stock at each location it lists,
+// drawing locations it leaves out down to zero. ifMatch is the ETag of the
+// state the update was based on, or "*" to apply it regardless; the check is
+// made against the item and its stock levels locked inside the transaction,
+// and fails with ErrVersionConflict when another request changed either
+// first. Stock entries without a version take that of the locked row.
+func (s *PostgresItemStore) UpdateItem(item *Item, ifMatch string) (*Item, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return nil, err
@@ -247,14 +518,122 @@ func (s *PostgresItemStore) UpdateItem(item *Item) (*Item, error) {
 
 	defer tx.Rollback()
 
+	// Locking the item row first queues concurrent updates of the item
+	// behind each other, so a stock level one of them creates is seen by
+	// the next.
+	current := &Item{ID: item.ID}
+	var trackSerials bool
+	err = tx.QueryRow(`
+		SELECT updated_at, track_serials, base_unit
+		FROM items
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, item.ID).Scan(&current.UpdatedAt, &trackSerials, &current.BaseUnit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT location_id, quantity_physical, version
+		FROM stock_levels
+		WHERE item_id = $1
+		ORDER BY location_id
+		FOR UPDATE
+	`, item.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var stock ItemStock
+		if err := rows.Scan(&stock.LocationID, &stock.QuantityPhysical, &stock.Version); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		current.Stock = append(current.Stock, stock)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if ifMatch != "*" && ifMatch != current.ETag() {
+		return nil, ErrVersionConflict
+	}
+
+	versions := make(map[uuid.UUID]int, len(current.Stock))
+	hasStock := false
+	for _, stock := range current.Stock {
+		versions[stock.LocationID] = stock.Version
+		hasStock = hasStock || stock.QuantityPhysical != 0
+	}
+
+	for i := range item.Stock {
+		if item.Stock[i].Version == 0 {
+			item.Stock[i].Version = versions[item.Stock[i].LocationID]
+		}
+	}
+
+	// Serial tracking can only start from an empty shelf, otherwise stock
+	// already on hand would have no serial numbers to issue against.
+	if item.TrackSerials && !trackSerials && hasStock {
+		return nil, ErrItemHasStock
+	}
+
+	// Kit movements name no serial numbers, so kit components stay
+	// untracked.
+	if item.TrackSerials && !trackSerials {
+		var isComponent bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM kit_components WHERE item_id = $1)`, item.ID).Scan(&isComponent)
+		if err != nil {
+			return nil, err
+		}
+
+		if isComponent {
+			return nil, ErrSerializedKit
+		}
+	}
+
+	// Stock and alternate unit factors are counted in the base unit, so it
+	// can only be renamed while there are neither. This also keeps the new
+	// name from colliding with an alternate unit's.
+	if item.BaseUnit != current.BaseUnit {
+		var hasUnits bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM item_units WHERE item_id = $1)`, item.ID).Scan(&hasUnits)
+		if err != nil {
+			return nil, err
+		}
+
+		if hasStock || hasUnits {
+			return nil, ErrBaseUnitInUse
+		}
+	}
+
+	if item.Attributes == nil {
+		item.Attributes = map[string]any{}
+	}
+
+	attributesJSON, err := json.Marshal(item.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Changing a variant's price overrides its product's; setting it back to
+	// the product's price makes the variant follow the product again.
 	query := `
 		UPDATE items
-		SET sku = $1, organization_id = $2, category_id = $3, name = $4, description = $5, color = $6, weight = $7, length = $8, width = $9, height = $10, unit_price = $11, cost_price = $12, is_active = $13, updated_at = $14
-		WHERE id = $15
+		SET sku = $1, organization_id = $2, category_id = $3, name = $4, description = $5, color = $6, weight = $7, length = $8, width = $9, height = $10, unit_price = $11, cost_price = $12, is_active = $13, track_serials = $14, base_unit = $15, attributes = $16, updated_at = $17,
+			unit_price_override = CASE
+				WHEN product_id IS NULL THEN NULL
+				WHEN unit_price = $11 THEN unit_price_override
+				WHEN $11 = (SELECT p.unit_price FROM products p WHERE p.id = items.product_id) THEN NULL
+				ELSE $11
+			END
+		WHERE id = $18
 		RETURNING created_at, updated_at
 	`
 
-	err = s.db.QueryRow(
+	err = tx.QueryRow(
 		query,
 		item.SKU,
 		item.OrganizationID,
@@ -269,6 +648,9 @@ func (s *PostgresItemStore) UpdateItem(item *Item) (*Item, error) {
 		item.UnitPrice,
 		item.CostPrice,
 		item.IsActive,
+		item.TrackSerials,
+		item.BaseUnit,
+		attributesJSON,
 		time.Now(),
 		item.ID,
 	).Scan(
@@ -280,34 +662,45 @@ func (s *PostgresItemStore) UpdateItem(item *Item) (*Item, error) {
 		return nil, err
 	}
 
-	_, err = tx.Exec(`
-		DELETE FROM stock_levels
-		WHERE item_id = $1
-	`, item.ID)
-	if err != nil {
-		return nil, err
+	keep := make(map[uuid.UUID]bool, len(item.Stock))
+	for i := range item.Stock {
+		keep[item.Stock[i].LocationID] = true
+
+		err := setItemStock(tx, item.ID, &item.Stock[i], MovementTypeAdjustment)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	for i := range item.Stock {
-		query := `
-			INSERT INTO stock_levels (location_id, item_id, quantity_physical, quantity_available, quantity_reserved, reorder_level, max_stock_level, last_counted_at, version)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-			RETURNING id, updated_at`
-		err := s.db.QueryRow(
-			query,
-			item.Stock[i].LocationID,
-			item.ID,
-			item.Stock[i].QuantityPhysical,
-			item.Stock[i].QuantityAvailable,
-			item.Stock[i].QuantityReserved,
-			item.Stock[i].ReorderLevel,
-			item.Stock[i].MaxStockLevel,
-			item.Stock[i].LastCountedAt,
-			1, // initial version
-		).Scan(
-			&item.Stock[i].ID,
-			&item.Stock[i].UpdatedAt,
-		)
+	// Locations dropped from the payload are drawn down to zero through the
+	// ledger before their stock_levels row is removed.
+	dropped := map[uuid.UUID]int{}
+	for _, stock := range current.Stock {
+		if !keep[stock.LocationID] {
+			dropped[stock.LocationID] = stock.QuantityPhysical
+		}
+	}
+
+	for locationID, physical := range dropped {
+		if physical != 0 {
+			err := postMovement(tx, &StockMovement{
+				ItemID:        item.ID,
+				LocationID:    locationID,
+				MovementType:  MovementTypeAdjustment,
+				Quantity:      -physical,
+				ReferenceType: stringPtr(ReferenceTypeItem),
+				ReferenceID:   &item.ID,
+				Reason:        stringPtr("location removed from item"),
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = tx.Exec(`
+			DELETE FROM stock_levels
+			WHERE item_id = $1 AND location_id = $2
+		`, item.ID, locationID)
 		if err != nil {
 			return nil, err
 		}
@@ -321,32 +714,307 @@ func (s *PostgresItemStore) UpdateItem(item *Item) (*Item, error) {
 	return item, nil
 }
 
+// setItemStock brings the stock_levels row for stock.LocationID in line with
+// the requested quantity_available, recording the difference as a movement of
+// movementType, and reloads the row into stock. stock.Version must match the
+// row's current version (zero for a row that does not exist yet), otherwise
+// ErrVersionConflict is returned.
+func setItemStock(tx *sql.Tx, itemID uuid.UUID, stock *ItemStock, movementType string) error {
+	var physical, reserved, version int
+	err := tx.QueryRow(`
+		SELECT quantity_physical, quantity_reserved, version
+		FROM stock_levels
+		WHERE item_id = $1 AND location_id = $2
+		FOR UPDATE
+	`, itemID, stock.LocationID).Scan(&physical, &reserved, &version)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if stock.Version != version {
+		return ErrVersionConflict
+	}
+
+	delta := stock.QuantityAvailable + reserved - physical
+
+	if err == sql.ErrNoRows {
+		// A movement may have stocked the location since the row was found
+		// missing; that is a change the caller has not seen.
+		var result sql.Result
+		result, err = tx.Exec(`
+			INSERT INTO stock_levels (location_id, item_id, quantity_physical, quantity_available, reorder_level, max_stock_level)
+			VALUES ($1, $2, 0, 0, $3, $4)
+			ON CONFLICT (location_id, item_id) DO NOTHING
+		`, stock.LocationID, itemID, stock.ReorderLevel, stock.MaxStockLevel)
+		if err == nil {
+			var inserted int64
+			inserted, err = result.RowsAffected()
+			if err == nil && inserted == 0 {
+				return ErrVersionConflict
+			}
+		}
+	} else {
+		// postMovement bumps the version when quantities change, so only a
+		// settings-only edit needs its own increment.
+		bump := 0
+		if delta == 0 {
+			bump = 1
+		}
+		_, err = tx.Exec(`
+			UPDATE stock_levels
+			SET reorder_level = $1, max_stock_level = $2, version = version + $3, updated_at = NOW()
+			WHERE item_id = $4 AND location_id = $5
+		`, stock.ReorderLevel, stock.MaxStockLevel, bump, itemID, stock.LocationID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if delta != 0 {
+		err := postMovement(tx, &StockMovement{
+			ItemID:        itemID,
+			LocationID:    stock.LocationID,
+			MovementType:  movementType,
+			Quantity:      delta,
+			ReferenceType: stringPtr(ReferenceTypeItem),
+			ReferenceID:   &itemID,
+			Reason:        stringPtr("item stock update"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.QueryRow(`
+		SELECT id, item_id, quantity_physical, quantity_available, quantity_reserved, reorder_level, max_stock_level, last_counted_at, updated_at, version
+		FROM stock_levels
+		WHERE item_id = $1 AND location_id = $2
+	`, itemID, stock.LocationID).Scan(
+		&stock.ID,
+		&stock.ItemID,
+		&stock.QuantityPhysical,
+		&stock.QuantityAvailable,
+		&stock.QuantityReserved,
+		&stock.ReorderLevel,
+		&stock.MaxStockLevel,
+		&stock.LastCountedAt,
+		&stock.UpdatedAt,
+		&stock.Version,
+	)
+}
+
+// itemInUse holds for the item aliased i while it has stock on hand or
+// reserved, active reservations, or lines on orders, transfers or work orders
+// that are still open.
+const itemInUse = `(
+	EXISTS (SELECT 1 FROM stock_levels s WHERE s.item_id = i.id AND (s.quantity_physical <> 0 OR s.quantity_reserved <> 0))
+	OR EXISTS (SELECT 1 FROM reservations r WHERE r.item_id = i.id AND r.status = '` + ReservationStatusActive + `')
+	OR EXISTS (
+		SELECT 1 FROM sales_order_lines l JOIN sales_orders o ON o.id = l.sales_order_id
+		WHERE l.item_id = i.id AND o.status NOT IN ('` + SalesOrderStatusShipped + `', '` + SalesOrderStatusCancelled + `')
+	)
+	OR EXISTS (
+		SELECT 1 FROM purchase_order_lines l JOIN purchase_orders o ON o.id = l.purchase_order_id
+		WHERE l.item_id = i.id AND o.status NOT IN ('` + PurchaseOrderStatusReceived + `', '` + PurchaseOrderStatusCancelled + `')
+	)
+	OR EXISTS (
+		SELECT 1 FROM transfer_lines l JOIN transfers t ON t.id = l.transfer_id
+		WHERE l.item_id = i.id AND t.status = '` + TransferStatusInTransit + `'
+	)
+	OR EXISTS (
+		SELECT 1 FROM work_orders o
+		WHERE o.status IN ('` + WorkOrderStatusDraft + `', '` + WorkOrderStatusReleased + `')
+			AND (o.item_id = i.id OR EXISTS (SELECT 1 FROM work_order_components c WHERE c.work_order_id = o.id AND c.item_id = i.id))
+	)
+)`
+
+// DeleteItem moves an item to the trash. Its stock levels and history are
+// kept until PurgeDeletedItems removes it for good, and RestoreItem brings it
+// back until then. It returns ErrItemInUse while the item has stock or open
+// documents, and sql.ErrNoRows when the item does not exist or is already
+// deleted.
 func (s *PostgresItemStore) DeleteItem(id uuid.UUID) error {
-	query := `
-		DELETE FROM items
-		WHERE id = $1
-	`
-	result, err := s.db.Exec(query, id)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the item holds off new rows referring to it until the check
+	// and the delete are done.
+	var inUse bool
+	err = tx.QueryRow(`
+		SELECT `+itemInUse+`
+		FROM items i
+		WHERE i.id = $1 AND i.deleted_at IS NULL
+		FOR UPDATE
+	`, id).Scan(&inUse)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if inUse {
+		return ErrItemInUse
+	}
+
+	_, err = tx.Exec(`UPDATE items SET deleted_at = NOW(), updated_at = NOW() WHERE id = $1`, id)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	return tx.Commit()
+}
+
+// RestoreItem takes a deleted item of the organization out of the trash. It
+// returns ErrCategoryDeleted while the item's category is deleted,
+// ErrItemNameTaken when a live item has taken its name in the meantime,
+// ErrVariantExists when its product has a live variant with the same option
+// values, and sql.ErrNoRows when there is no such deleted item.
+func (s *PostgresItemStore) RestoreItem(organizationID, id uuid.UUID) (*Item, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var categoryDeleted, nameTaken bool
+	err = tx.QueryRow(`
+		SELECT c.deleted_at IS NOT NULL,
+			EXISTS (
+				SELECT 1 FROM items o
+				WHERE o.organization_id = i.organization_id AND o.name = i.name AND o.deleted_at IS NULL
+			)
+		FROM items i
+		JOIN categories c ON c.id = i.category_id
+		WHERE i.id = $1 AND i.organization_id = $2 AND i.deleted_at IS NOT NULL
+		FOR UPDATE OF i
+	`, id, organizationID).Scan(&categoryDeleted, &nameTaken)
+	if err != nil {
+		return nil, err
+	}
+
+	if categoryDeleted {
+		return nil, fmt.Errorf("%w: restore the item's category first", ErrCategoryDeleted)
+	}
+
+	if nameTaken {
+		return nil, ErrItemNameTaken
+	}
+
+	_, err = tx.Exec(`UPDATE items SET deleted_at = NULL, updated_at = NOW() WHERE id = $1`, id)
+	if isUniqueViolation(err, "idx_items_product_options") {
+		return nil, ErrVariantExists
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
 	}
 
-	return err
+	return s.GetItemByID(id)
 }
 
-func (s *PostgresItemStore) GetItemsByOrganization(page, pageSize int, organizationID uuid.UUID) ([]*Item, error) {
-	query := `
-		SELECT i.*,
-			COALESCE(s.stock_levels, '{}') AS stock_levels
+// PurgeDeletedItems permanently removes items deleted before before, along
+// with their stock levels and history. Items still used as kit components,
+// or still holding stock or open documents, are kept until they no longer
+// are.
+func (s *PostgresItemStore) PurgeDeletedItems(before time.Time) (int, error) {
+	result, err := s.db.Exec(`
+		DELETE FROM items i
+		WHERE i.deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM kit_components k WHERE k.item_id = i.id)
+			AND NOT `+itemInUse, before)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(purged), nil
+}
+
+func (s *PostgresItemStore) GetItemsByOrganization(params pagination.Params, organizationID uuid.UUID, filter ItemFilter) (*pagination.Page[*Item], error) {
+	filterClause, args := filter.where([]any{organizationID})
+
+	order, err := filter.order("-created_at")
+	if err != nil {
+		return nil, err
+	}
+
+	pageClause, args, err := pagination.Clause(params, order, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(itemListQuery+filterClause+pageClause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var items []*Item
+	for rows.Next() {
+		item, err := scanItemRow(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, order, items), nil
+}
+
+// ExportItems calls fn with each item of the organization matching filter,
+// ordered by name unless filter sorts otherwise, reading them one row at a
+// time rather than collecting them first. It stops at the first error fn
+// returns.
+func (s *PostgresItemStore) ExportItems(organizationID uuid.UUID, filter ItemFilter, fn func(item *Item) error) error {
+	filterClause, args := filter.where([]any{organizationID})
+
+	order, err := filter.order("name")
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.Query(itemListQuery+filterClause+order.OrderBy(), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanItemRow(rows.Scan)
+		if err != nil {
+			return err
+		}
+
+		err = fn(item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// itemListQuery selects items with their stock levels for scanItemRow. Callers
+// append further conditions on items aliased i.
+const itemListQuery = `
+		SELECT i.id, i.sku, i.organization_id, i.category_id, i.name, i.description, i.color, i.weight, i.length, i.width, i.height, i.unit_price, i.cost_price, i.is_active, i.track_serials, i.is_kit, i.base_unit, i.product_id, i.option_values, i.attributes, i.created_at, i.updated_at, i.deleted_at,
+			COALESCE(s.stock_levels, '[]') AS stock_levels
 		FROM items i
 		LEFT JOIN (
 			SELECT item_id,
@@ -368,68 +1036,67 @@ func (s *PostgresItemStore) GetItemsByOrganization(page, pageSize int, organizat
 			FROM stock_levels
 			GROUP BY item_id
 		) s ON i.id = s.item_id
-		WHERE i.organization_id = $1
-		ORDER BY i.created_at DESC
-		LIMIT $2 OFFSET $3
-	`
-	offset := page * pageSize
+		WHERE i.organization_id = $1`
 
-	rows, err := s.db.Query(query, organizationID, pageSize, offset)
+func scanItemRow(scan func(dest ...any) error) (*Item, error) {
+	item := &Item{}
+	var optionValuesJSON, attributesJSON, stockLevelJSON []byte
+	err := scan(
+		&item.ID,
+		&item.SKU,
+		&item.OrganizationID,
+		&item.CategoryID,
+		&item.Name,
+		&item.Description,
+		&item.Color,
+		&item.Weight,
+		&item.Length,
+		&item.Width,
+		&item.Height,
+		&item.UnitPrice,
+		&item.CostPrice,
+		&item.IsActive,
+		&item.TrackSerials,
+		&item.IsKit,
+		&item.BaseUnit,
+		&item.ProductID,
+		&optionValuesJSON,
+		&attributesJSON,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+		&item.DeletedAt,
+		&stockLevelJSON,
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
-
-	var items []*Item
-	for rows.Next() {
-		item := &Item{}
-		var stockLevelJSON []byte
-		err := rows.Scan(
-			&item.ID,
-			&item.SKU,
-			&item.OrganizationID,
-			&item.CategoryID,
-			&item.Name,
-			&item.Description,
-			&item.Color,
-			&item.Weight,
-			&item.Length,
-			&item.Width,
-			&item.Height,
-			&item.UnitPrice,
-			&item.CostPrice,
-			&item.IsActive,
-			&item.CreatedAt,
-			&item.UpdatedAt,
-			&stockLevelJSON,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		if err := json.Unmarshal(stockLevelJSON, &item.Stock); err != nil {
+	if optionValuesJSON != nil {
+		if err := json.Unmarshal(optionValuesJSON, &item.OptionValues); err != nil {
 			return nil, err
 		}
+	}
 
-		items = append(items, item)
+	if err := json.Unmarshal(attributesJSON, &item.Attributes); err != nil {
+		return nil, err
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := json.Unmarshal(stockLevelJSON, &item.Stock); err != nil {
 		return nil, err
 	}
 
-	return items, nil
+	return item, nil
 }
 
-func (s *PostgresItemStore) CountItemsByOrganization(organizationID uuid.UUID) (int, error) {
+func (s *PostgresItemStore) CountItemsByOrganization(organizationID uuid.UUID, filter ItemFilter) (int, error) {
+	filterClause, args := filter.where([]any{organizationID})
 	query := `
 		SELECT COUNT(*)
-		FROM items
-		WHERE organization_id = $1
+		FROM items i
+		WHERE i.organization_id = $1` + filterClause + `
 	`
 	var count int
-	err := s.db.QueryRow(query, organizationID).Scan(&count)
+	err := s.db.QueryRow(query, args...).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
@@ -441,7 +1108,7 @@ func (s *PostgresItemStore) GetItemOrgID(id uuid.UUID) (uuid.UUID, error) {
 	query := `
 		SELECT organization_id
 		FROM items
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 	err := s.db.QueryRow(query, id).Scan(&orgID)
 	if err != nil {
@@ -0,0 +1,289 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"kabancount/internal/pagination"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportItems(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	items := NewPostgresItemStore(db)
+
+	newItem := func(name string) *Item {
+		return &Item{
+			OrganizationID: item.OrganizationID,
+			CategoryID:     item.CategoryID,
+			Name:           name,
+			UnitPrice:      100,
+			IsActive:       true,
+			BaseUnit:       DefaultBaseUnit,
+			Stock:          []ItemStock{{LocationID: location.ID, QuantityAvailable: 5}},
+		}
+	}
+
+	imported, err := items.ImportItems([]*Item{newItem("Imported A"), newItem("Imported B")})
+	require.NoError(t, err)
+	assert.Len(t, imported, 2)
+
+	taken, err := items.GetTakenItemNames(item.OrganizationID, []string{"Imported A", "Imported C", "Ledger Item"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"Imported A": true, "Ledger Item": true}, taken)
+
+	_, err = items.ImportItems([]*Item{newItem("Imported C"), newItem("Imported A")})
+	assert.ErrorIs(t, err, ErrItemNameTaken)
+
+	var importErr *ItemImportError
+	require.ErrorAs(t, err, &importErr)
+	assert.Equal(t, 1, importErr.Index)
+
+	taken, err = items.GetTakenItemNames(item.OrganizationID, []string{"Imported C"})
+	require.NoError(t, err)
+	assert.Empty(t, taken)
+}
+
+func TestDeleteItemInUse(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	items := NewPostgresItemStore(db)
+
+	assert.ErrorIs(t, items.DeleteItem(item.ID), ErrItemInUse)
+
+	_, err := NewPostgresStockMovementStore(db).CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeIssue,
+		Quantity:     -10,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, items.DeleteItem(item.ID))
+	assert.ErrorIs(t, items.DeleteItem(item.ID), sql.ErrNoRows)
+}
+
+func TestExportItems(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, _ := seedItemAndLocation(t, db)
+	items := NewPostgresItemStore(db)
+
+	_, err := items.CreateItem(&Item{
+		OrganizationID: item.OrganizationID,
+		CategoryID:     item.CategoryID,
+		Name:           "Retired Item",
+		UnitPrice:      100,
+		BaseUnit:       DefaultBaseUnit,
+	})
+	require.NoError(t, err)
+
+	var names []string
+	err = items.ExportItems(item.OrganizationID, ItemFilter{}, func(exported *Item) error {
+		names = append(names, exported.Name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ledger Item", "Retired Item"}, names)
+
+	active := true
+	var exported []*Item
+	err = items.ExportItems(item.OrganizationID, ItemFilter{IsActive: &active}, func(item *Item) error {
+		exported = append(exported, item)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, exported, 1)
+	require.Len(t, exported[0].Stock, 1)
+	assert.Equal(t, 10, exported[0].Stock[0].QuantityPhysical)
+}
+
+func TestGetItemsByOrganizationFilters(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	items := NewPostgresItemStore(db)
+
+	sku := "CHEAP_1"
+	_, err := items.CreateItem(&Item{
+		OrganizationID: item.OrganizationID,
+		CategoryID:     item.CategoryID,
+		SKU:            &sku,
+		Name:           "Bargain Widget",
+		UnitPrice:      10,
+		IsActive:       true,
+		BaseUnit:       DefaultBaseUnit,
+		Stock:          []ItemStock{{LocationID: location.ID, QuantityAvailable: 2, ReorderLevel: 5}},
+		Attributes:     map[string]any{"voltage": 230.0, "cordless": true, "finish": "matte"},
+	})
+	require.NoError(t, err)
+
+	maxPrice := 50
+	tests := []struct {
+		name      string
+		filter    ItemFilter
+		wantNames []string
+	}{
+		{name: "Search by SKU", filter: ItemFilter{Search: "cheap_"}, wantNames: []string{"Bargain Widget"}},
+		{name: "Search treats wildcards literally", filter: ItemFilter{Search: "%"}, wantNames: nil},
+		{name: "Price range", filter: ItemFilter{MaxPrice: &maxPrice}, wantNames: []string{"Bargain Widget"}},
+		{name: "Low stock at location", filter: ItemFilter{LocationID: &location.ID, LowStock: true}, wantNames: []string{"Bargain Widget"}},
+		{name: "Text attribute", filter: ItemFilter{Attributes: map[string]string{"finish": "matte"}}, wantNames: []string{"Bargain Widget"}},
+		{name: "Number and boolean attributes", filter: ItemFilter{Attributes: map[string]string{"voltage": "230", "cordless": "true"}}, wantNames: []string{"Bargain Widget"}},
+		{name: "Attribute mismatch", filter: ItemFilter{Attributes: map[string]string{"voltage": "110"}}, wantNames: nil},
+		{name: "Sorted by price descending", filter: ItemFilter{Sort: "-unit_price"}, wantNames: []string{"Ledger Item", "Bargain Widget"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := items.GetItemsByOrganization(pagination.Params{Limit: 10}, item.OrganizationID, tt.filter)
+			require.NoError(t, err)
+
+			var names []string
+			for _, item := range found.Data {
+				names = append(names, item.Name)
+			}
+			assert.Equal(t, tt.wantNames, names)
+
+			count, err := items.CountItemsByOrganization(item.OrganizationID, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.wantNames), count)
+		})
+	}
+
+	_, err = items.GetItemsByOrganization(pagination.Params{Limit: 10}, item.OrganizationID, ItemFilter{Sort: "password"})
+	assert.ErrorIs(t, err, ErrInvalidItemSort)
+}
+
+func TestGetItemsByOrganizationPages(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, _ := seedItemAndLocation(t, db)
+	items := NewPostgresItemStore(db)
+
+	for _, name := range []string{"Item B", "Item C"} {
+		_, err := items.CreateItem(&Item{
+			OrganizationID: item.OrganizationID,
+			CategoryID:     item.CategoryID,
+			Name:           name,
+			IsActive:       true,
+			BaseUnit:       DefaultBaseUnit,
+		})
+		require.NoError(t, err)
+	}
+
+	names := func(page *pagination.Page[*Item]) []string {
+		var names []string
+		for _, item := range page.Data {
+			names = append(names, item.Name)
+		}
+		return names
+	}
+
+	filter := ItemFilter{Sort: "name"}
+	first, err := items.GetItemsByOrganization(pagination.Params{Limit: 2}, item.OrganizationID, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Item B", "Item C"}, names(first))
+	assert.Nil(t, first.PrevCursor)
+	require.NotNil(t, first.NextCursor)
+
+	cursor, err := pagination.DecodeCursor(*first.NextCursor)
+	require.NoError(t, err)
+
+	second, err := items.GetItemsByOrganization(pagination.Params{Limit: 2, Cursor: cursor}, item.OrganizationID, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ledger Item"}, names(second))
+	assert.Nil(t, second.NextCursor)
+	require.NotNil(t, second.PrevCursor)
+
+	cursor, err = pagination.DecodeCursor(*second.PrevCursor)
+	require.NoError(t, err)
+
+	back, err := items.GetItemsByOrganization(pagination.Params{Limit: 2, Cursor: cursor}, item.OrganizationID, filter)
+	require.NoError(t, err)
+	assert.Equal(t, names(first), names(back))
+	assert.Nil(t, back.PrevCursor)
+
+	_, err = items.GetItemsByOrganization(pagination.Params{Limit: 2, Cursor: cursor}, item.OrganizationID, ItemFilter{})
+	assert.ErrorIs(t, err, pagination.ErrInvalidCursor)
+}
+
+func TestUpdateItemVersionConflicts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	items := NewPostgresItemStore(db)
+
+	overflow, err := NewPostgresLocationStore(db).CreateLocation(&Location{Name: "Overflow", OrganizationID: item.OrganizationID})
+	require.NoError(t, err)
+
+	current, err := items.GetItemByID(item.ID)
+	require.NoError(t, err)
+
+	// Two updates from the same ETag both stock a new location; one wins and
+	// the other conflicts instead of colliding on the new stock level.
+	errs := make(chan error, 2)
+	for _, quantity := range []int{3, 5} {
+		go func() {
+			update := *current
+			update.Stock = []ItemStock{{LocationID: location.ID, QuantityAvailable: 10}, {LocationID: overflow.ID, QuantityAvailable: quantity}}
+			_, err := items.UpdateItem(&update, current.ETag())
+			errs <- err
+		}()
+	}
+
+	conflicts := 0
+	for range 2 {
+		err := <-errs
+		if errors.Is(err, ErrVersionConflict) {
+			conflicts++
+			continue
+		}
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, conflicts)
+
+	// A movement at a location the update leaves out still invalidates the
+	// ETag it was based on.
+	current, err = items.GetItemByID(item.ID)
+	require.NoError(t, err)
+
+	_, err = NewPostgresStockMovementStore(db).CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   overflow.ID,
+		MovementType: MovementTypeReceipt,
+		Quantity:     1,
+	})
+	require.NoError(t, err)
+
+	update := *current
+	update.Stock = []ItemStock{{LocationID: location.ID, QuantityAvailable: 10}}
+	_, err = items.UpdateItem(&update, current.ETag())
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	physical, _ := readStockLevel(t, db, item.ID, overflow.ID)
+	assert.NotZero(t, physical)
+
+	current, err = items.GetItemByID(item.ID)
+	require.NoError(t, err)
+
+	update = *current
+	update.Stock = []ItemStock{{LocationID: location.ID, QuantityAvailable: 10}}
+	updated, err := items.UpdateItem(&update, current.ETag())
+	require.NoError(t, err)
+	assert.Len(t, updated.Stock, 1)
+
+	physical, _ = readStockLevel(t, db, item.ID, overflow.ID)
+	assert.Zero(t, physical)
+}
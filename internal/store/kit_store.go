@@ -0,0 +1,335 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrKitNotStocked = errors.New("kits hold no stock of their own")
+	ErrNestedKit     = errors.New("kits cannot contain other kits")
+	ErrKitInUse      = errors.New("kit has open reservations or allocated sales orders")
+	ErrSerializedKit = errors.New("kit components cannot be serial-tracked")
+)
+
+// kitMovementTypes are the movement types that can be posted against a kit.
+// Each takes stock out or holds it back, so it can be carried by the
+// components instead.
+var kitMovementTypes = map[string]bool{
+	MovementTypeIssue:   true,
+	MovementTypeReserve: true,
+	MovementTypeRelease: true,
+	MovementTypeCommit:  true,
+	MovementTypeConsume: true,
+}
+
+// Kit is an item sold as a bundle of other items. It has no stock of its own;
+// its availability at a location is the number of complete sets its
+// components' available stock can make up.
+type Kit struct {
+	ItemID       uuid.UUID         `json:"item_id"`
+	Components   []KitComponent    `json:"components"`
+	Availability []KitAvailability `json:"availability"`
+}
+
+// KitComponent is the quantity of ItemID that goes into one unit of the kit.
+type KitComponent struct {
+	ID        uuid.UUID `json:"id"`
+	KitItemID uuid.UUID `json:"kit_item_id"`
+	ItemID    uuid.UUID `json:"item_id"`
+	Quantity  int       `json:"quantity"`
+}
+
+type KitAvailability struct {
+	LocationID        uuid.UUID `json:"location_id"`
+	QuantityAvailable int       `json:"quantity_available"`
+}
+
+type PostgresKitStore struct {
+	db *sql.DB
+}
+
+func NewPostgresKitStore(db *sql.DB) *PostgresKitStore {
+	return &PostgresKitStore{db: db}
+}
+
+type KitStore interface {
+	SetKit(kit *Kit) (*Kit, error)
+	GetKit(itemID uuid.UUID) (*Kit, error)
+	DeleteKit(itemID uuid.UUID) error
+}
+
+// SetKit makes kit.ItemID a kit of the given components, replacing any
+// components it had. The item must not hold stock, must not itself be a
+// component of another kit, and none of its components may be kits or
+// serial-tracked, since a kit movement names no serial numbers. A kit with
+// open reservations or allocated sales orders cannot be changed.
+func (s *PostgresKitStore) SetKit(kit *Kit) (*Kit, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var hasStock, isComponent bool
+	err = tx.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM stock_levels WHERE item_id = $1 AND (quantity_physical <> 0 OR quantity_reserved <> 0)),
+			EXISTS (SELECT 1 FROM kit_components WHERE item_id = $1)
+		FROM items
+		WHERE id = $1
+		FOR UPDATE
+	`, kit.ItemID).Scan(&hasStock, &isComponent)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasStock {
+		return nil, ErrItemHasStock
+	}
+
+	if isComponent {
+		return nil, ErrNestedKit
+	}
+
+	for _, component := range kit.Components {
+		// The share lock holds off serial tracking being turned on for the
+		// component until the kit is saved.
+		var isKit, trackSerials bool
+		err := tx.QueryRow(`SELECT is_kit, track_serials FROM items WHERE id = $1 FOR SHARE`, component.ItemID).Scan(&isKit, &trackSerials)
+		if err != nil {
+			return nil, err
+		}
+
+		if isKit {
+			return nil, ErrNestedKit
+		}
+
+		if trackSerials {
+			return nil, ErrSerializedKit
+		}
+	}
+
+	err = checkKitNotInUse(tx, kit.ItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM kit_components WHERE kit_item_id = $1`, kit.ItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range kit.Components {
+		component := &kit.Components[i]
+		component.KitItemID = kit.ItemID
+
+		err := tx.QueryRow(`
+			INSERT INTO kit_components (kit_item_id, item_id, quantity)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, component.KitItemID, component.ItemID, component.Quantity).Scan(&component.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE items SET is_kit = TRUE, updated_at = NOW() WHERE id = $1`, kit.ItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetKit(kit.ItemID)
+}
+
+// GetKit returns the components of a kit and the number of kits each location
+// can supply. Locations missing any component are left out. It returns nil
+// when the item is not a kit.
+func (s *PostgresKitStore) GetKit(itemID uuid.UUID) (*Kit, error) {
+	components, err := getKitComponents(s.db.Query, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(components) == 0 {
+		return nil, nil
+	}
+
+	kit := &Kit{ItemID: itemID, Components: components, Availability: []KitAvailability{}}
+
+	availabilityRows, err := s.db.Query(`
+		SELECT s.location_id, MIN(GREATEST(s.quantity_available, 0) / c.quantity)
+		FROM kit_components c
+		JOIN stock_levels s ON s.item_id = c.item_id
+		WHERE c.kit_item_id = $1
+		GROUP BY s.location_id
+		HAVING COUNT(*) = $2
+		ORDER BY s.location_id
+	`, itemID, len(kit.Components))
+	if err != nil {
+		return nil, err
+	}
+	defer availabilityRows.Close()
+
+	for availabilityRows.Next() {
+		var availability KitAvailability
+		err := availabilityRows.Scan(&availability.LocationID, &availability.QuantityAvailable)
+		if err != nil {
+			return nil, err
+		}
+		kit.Availability = append(kit.Availability, availability)
+	}
+
+	if err = availabilityRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return kit, nil
+}
+
+// DeleteKit turns a kit back into an ordinary item. It returns sql.ErrNoRows
+// when the item is not a kit.
+func (s *PostgresKitStore) DeleteKit(itemID uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkKitNotInUse(tx, itemID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE items SET is_kit = FALSE, updated_at = NOW() WHERE id = $1 AND is_kit`, itemID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`DELETE FROM kit_components WHERE kit_item_id = $1`, itemID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkKitNotInUse returns ErrKitInUse while stock is held for the kit, since
+// releasing it later must unwind the same components.
+func checkKitNotInUse(tx *sql.Tx, itemID uuid.UUID) error {
+	var inUse bool
+	err := tx.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM reservations WHERE item_id = $1 AND status = $2)
+			OR EXISTS (
+				SELECT 1
+				FROM sales_order_lines l
+				JOIN sales_orders o ON o.id = l.sales_order_id
+				WHERE l.item_id = $1 AND o.status IN ($3, $4, $5)
+			)
+	`, itemID, ReservationStatusActive, SalesOrderStatusAllocated, SalesOrderStatusPicked, SalesOrderStatusPacked).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+
+	if inUse {
+		return ErrKitInUse
+	}
+
+	return nil
+}
+
+func getKitComponents(query func(query string, args ...any) (*sql.Rows, error), itemID uuid.UUID) ([]KitComponent, error) {
+	rows, err := query(`
+		SELECT id, kit_item_id, item_id, quantity
+		FROM kit_components
+		WHERE kit_item_id = $1
+		ORDER BY id
+	`, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var components []KitComponent
+	for rows.Next() {
+		var component KitComponent
+		err := rows.Scan(&component.ID, &component.KitItemID, &component.ItemID, &component.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		components = append(components, component)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return components, nil
+}
+
+// postKitMovement posts a movement of a kit as one movement per component,
+// scaled by the component quantity and tagged with the kit. The components
+// share the movement's batch, and movement carries the combined cost.
+func postKitMovement(tx *sql.Tx, movement *StockMovement, components []KitComponent) error {
+	if !kitMovementTypes[movement.MovementType] || movement.LotID != nil || len(movement.SerialNumbers) > 0 {
+		return ErrKitNotStocked
+	}
+
+	if movement.BatchID == nil {
+		batchID := uuid.New()
+		movement.BatchID = &batchID
+	}
+
+	var totalCost *int
+	for _, component := range components {
+		entry := &StockMovement{
+			ItemID:        component.ItemID,
+			LocationID:    movement.LocationID,
+			MovementType:  movement.MovementType,
+			Quantity:      movement.Quantity * component.Quantity,
+			ReferenceType: movement.ReferenceType,
+			ReferenceID:   movement.ReferenceID,
+			Reason:        movement.Reason,
+			CreatedBy:     movement.CreatedBy,
+			BatchID:       movement.BatchID,
+			KitItemID:     &movement.ItemID,
+		}
+
+		err := postMovement(tx, entry)
+		if err != nil {
+			return err
+		}
+
+		if entry.TotalCost != nil {
+			if totalCost == nil {
+				totalCost = new(int)
+			}
+			*totalCost += *entry.TotalCost
+		}
+
+		movement.CreatedAt = entry.CreatedAt
+		movement.UpdatedAt = entry.UpdatedAt
+		movement.Components = append(movement.Components, entry)
+	}
+
+	movement.TotalCost = totalCost
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKitMovements(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	component, location := seedItemAndLocation(t, db)
+
+	kitItem, err := NewPostgresItemStore(db).CreateItem(&Item{
+		OrganizationID: component.OrganizationID,
+		CategoryID:     component.CategoryID,
+		Name:           "Ledger Kit",
+		UnitPrice:      300,
+		CostPrice:      100,
+		IsActive:       true,
+		BaseUnit:       DefaultBaseUnit,
+	})
+	require.NoError(t, err)
+
+	kits := NewPostgresKitStore(db)
+	kit, err := kits.SetKit(&Kit{
+		ItemID:     kitItem.ID,
+		Components: []KitComponent{{ItemID: component.ID, Quantity: 2}},
+	})
+	require.NoError(t, err)
+	require.Len(t, kit.Availability, 1)
+	assert.Equal(t, 5, kit.Availability[0].QuantityAvailable)
+
+	movements := NewPostgresStockMovementStore(db)
+
+	_, err = movements.CreateMovement(&StockMovement{
+		ItemID:       kitItem.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeReceipt,
+		Quantity:     1,
+	})
+	assert.ErrorIs(t, err, ErrKitNotStocked)
+
+	issued, err := movements.CreateMovement(&StockMovement{
+		ItemID:       kitItem.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeIssue,
+		Quantity:     -2,
+	})
+	require.NoError(t, err)
+	require.Len(t, issued.Components, 1)
+	assert.Equal(t, -4, issued.Components[0].Quantity)
+	assert.Equal(t, kitItem.ID, *issued.Components[0].KitItemID)
+
+	kit, err = kits.GetKit(kitItem.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, kit.Availability[0].QuantityAvailable)
+
+	_, err = kits.SetKit(&Kit{
+		ItemID:     component.ID,
+		Components: []KitComponent{{ItemID: kitItem.ID, Quantity: 1}},
+	})
+	assert.ErrorIs(t, err, ErrItemHasStock)
+
+	serialized, err := NewPostgresItemStore(db).CreateItem(&Item{
+		OrganizationID: component.OrganizationID,
+		CategoryID:     component.CategoryID,
+		Name:           "Ledger Scanner",
+		UnitPrice:      100,
+		CostPrice:      40,
+		IsActive:       true,
+		TrackSerials:   true,
+		BaseUnit:       DefaultBaseUnit,
+	})
+	require.NoError(t, err)
+
+	_, err = kits.SetKit(&Kit{
+		ItemID:     kitItem.ID,
+		Components: []KitComponent{{ItemID: component.ID, Quantity: 2}, {ItemID: serialized.ID, Quantity: 1}},
+	})
+	assert.ErrorIs(t, err, ErrSerializedKit)
+}
@@ -2,18 +2,66 @@ package store
 
 import (
 	"database/sql"
+	"errors"
+	"kabancount/internal/pagination"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	LocationTypeWarehouse = "warehouse"
+	LocationTypeZone      = "zone"
+	LocationTypeAisle     = "aisle"
+	LocationTypeBin       = "bin"
+)
+
+var (
+	ErrCapacityExceeded    = errors.New("location capacity exceeded")
+	ErrLocationHasStock    = errors.New("location still holds stock")
+	ErrLocationHasChildren = errors.New("location has child locations")
+	ErrLocationHasHistory  = errors.New("location is referenced by stock movements or documents")
+	ErrLocationArchived    = errors.New("location is archived")
+	ErrInvalidLocationTree = errors.New("location does not fit the location tree")
+)
+
+// locationTypeRank orders location types from the outermost container in.
+// A location may only sit inside a location of a lower rank.
+var locationTypeRank = map[string]int{
+	LocationTypeWarehouse: 0,
+	LocationTypeZone:      1,
+	LocationTypeAisle:     2,
+	LocationTypeBin:       3,
+}
+
 type Location struct {
-	ID             uuid.UUID `json:"id"`
-	OrganizationID uuid.UUID `json:"organization_id"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description,omitempty"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             uuid.UUID  `json:"id"`
+	OrganizationID uuid.UUID  `json:"organization_id"`
+	ParentID       *uuid.UUID `json:"parent_id"`
+	Name           string     `json:"name"`
+	Description    string     `json:"description,omitempty"`
+	LocationType   string     `json:"location_type"`
+	Capacity       *int       `json:"capacity"`
+	ArchivedAt     *time.Time `json:"archived_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// LocationStock is the stock held at a location and all of its descendants,
+// summed per item.
+type LocationStock struct {
+	LocationID       uuid.UUID           `json:"location_id"`
+	Capacity         *int                `json:"capacity"`
+	QuantityPhysical int                 `json:"quantity_physical"`
+	Items            []LocationStockItem `json:"items"`
+}
+
+type LocationStockItem struct {
+	ItemID            uuid.UUID `json:"item_id"`
+	QuantityPhysical  int       `json:"quantity_physical"`
+	QuantityAvailable int       `json:"quantity_available"`
+	QuantityReserved  int       `json:"quantity_reserved"`
+	Locations         int       `json:"locations"`
 }
 
 type PostgresLocationStore struct {
@@ -26,20 +74,47 @@ func NewPostgresLocationStore(db *sql.DB) *PostgresLocationStore {
 
 type LocationStore interface {
 	CreateLocation(location *Location) (*Location, error)
-	GetLocationsByOrganization(organizationID uuid.UUID) ([]Location, error)
+	GetLocationByID(id uuid.UUID) (*Location, error)
+	GetLocationsByOrganization(params pagination.Params, organizationID uuid.UUID, includeArchived bool) (*pagination.Page[Location], error)
+	GetAllLocations(organizationID uuid.UUID, includeArchived bool) ([]Location, error)
+	CountLocationsByOrganization(organizationID uuid.UUID, includeArchived bool) (int, error)
+	UpdateLocation(location *Location) (*Location, error)
+	DeleteLocation(id uuid.UUID) error
+	ArchiveLocation(id uuid.UUID) (*Location, error)
+	RestoreLocation(id uuid.UUID) (*Location, error)
+	GetLocationStock(id uuid.UUID) (*LocationStock, error)
+}
+
+// ValidLocationType reports whether locationType is a known location type.
+func ValidLocationType(locationType string) bool {
+	_, ok := locationTypeRank[locationType]
+	return ok
+}
+
+// CanContain reports whether a location of childType may be placed inside a
+// location of parentType.
+func CanContain(parentType, childType string) bool {
+	return locationTypeRank[parentType] < locationTypeRank[childType]
 }
 
 func (s *PostgresLocationStore) CreateLocation(location *Location) (*Location, error) {
+	if location.LocationType == "" {
+		location.LocationType = LocationTypeWarehouse
+	}
+
 	query := `
-		INSERT INTO locations (organization_id, name, description)
-		VALUES ($1, $2, $3)
+		INSERT INTO locations (organization_id, parent_id, name, description, location_type, capacity)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id, created_at, updated_at
 	`
 	row := s.db.QueryRow(
 		query,
 		location.OrganizationID,
+		location.ParentID,
 		location.Name,
 		location.Description,
+		location.LocationType,
+		location.Capacity,
 	)
 
 	err := row.Scan(&location.ID, &location.CreatedAt, &location.UpdatedAt)
@@ -50,13 +125,88 @@ func (s *PostgresLocationStore) CreateLocation(location *Location) (*Location, e
 	return location, nil
 }
 
-func (s *PostgresLocationStore) GetLocationsByOrganization(organizationID uuid.UUID) ([]Location, error) {
+func (s *PostgresLocationStore) GetLocationByID(id uuid.UUID) (*Location, error) {
+	query := `
+		SELECT id, organization_id, parent_id, name, description, location_type, capacity, archived_at, created_at, updated_at
+		FROM locations
+		WHERE id = $1
+	`
+
+	location := &Location{}
+	err := s.db.QueryRow(query, id).Scan(
+		&location.ID,
+		&location.OrganizationID,
+		&location.ParentID,
+		&location.Name,
+		&location.Description,
+		&location.LocationType,
+		&location.Capacity,
+		&location.ArchivedAt,
+		&location.CreatedAt,
+		&location.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+// locationOrder lists locations newest first.
+var locationOrder = pagination.Newest("locations", func(location Location) (time.Time, uuid.UUID) { return location.CreatedAt, location.ID })
+
+func (s *PostgresLocationStore) GetLocationsByOrganization(params pagination.Params, organizationID uuid.UUID, includeArchived bool) (*pagination.Page[Location], error) {
+	pageClause, args, err := pagination.Clause(params, locationOrder, []any{organizationID, includeArchived})
+	if err != nil {
+		return nil, err
+	}
+
+	locations, err := s.queryLocations(`
+		SELECT `+locationColumns+`
+		FROM locations
+		WHERE organization_id = $1 AND ($2 OR archived_at IS NULL)`+pageClause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, locationOrder, locations), nil
+}
+
+// GetAllLocations returns every location of the organization, in no
+// particular order.
+func (s *PostgresLocationStore) GetAllLocations(organizationID uuid.UUID, includeArchived bool) ([]Location, error) {
+	return s.queryLocations(`
+		SELECT `+locationColumns+`
+		FROM locations
+		WHERE organization_id = $1 AND ($2 OR archived_at IS NULL)
+	`, organizationID, includeArchived)
+}
+
+func (s *PostgresLocationStore) CountLocationsByOrganization(organizationID uuid.UUID, includeArchived bool) (int, error) {
 	query := `
-		SELECT id, organization_id, name, description, created_at, updated_at
+		SELECT COUNT(*)
 		FROM locations
-		WHERE organization_id = $1
+		WHERE organization_id = $1 AND ($2 OR archived_at IS NULL)
 	`
-	rows, err := s.db.Query(query, organizationID)
+
+	var count int
+	err := s.db.QueryRow(query, organizationID, includeArchived).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+const locationColumns = `id, organization_id, parent_id, name, description, location_type, capacity, archived_at, created_at, updated_at`
+
+func (s *PostgresLocationStore) queryLocations(query string, args ...any) ([]Location, error) {
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -69,8 +219,12 @@ func (s *PostgresLocationStore) GetLocationsByOrganization(organizationID uuid.U
 		if err := rows.Scan(
 			&location.ID,
 			&location.OrganizationID,
+			&location.ParentID,
 			&location.Name,
 			&location.Description,
+			&location.LocationType,
+			&location.Capacity,
+			&location.ArchivedAt,
 			&location.CreatedAt,
 			&location.UpdatedAt,
 		); err != nil {
@@ -86,3 +240,343 @@ func (s *PostgresLocationStore) GetLocationsByOrganization(organizationID uuid.U
 
 	return locations, nil
 }
+
+// UpdateLocation saves a location's details and position in the tree. Moving
+// a location under itself or one of its descendants, or changing its type so
+// that a child no longer fits inside it, returns ErrInvalidLocationTree. A
+// capacity below the stock already held, or a move that takes a parent past
+// its capacity, returns ErrCapacityExceeded.
+func (s *PostgresLocationStore) UpdateLocation(location *Location) (*Location, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = lockTree(tx, "locations", location.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if location.ParentID != nil {
+		var cyclic bool
+		err := tx.QueryRow(`
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM locations WHERE id = $1
+				UNION ALL
+				SELECT l.id FROM locations l JOIN subtree t ON l.parent_id = t.id
+			)
+			SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+		`, location.ID, *location.ParentID).Scan(&cyclic)
+		if err != nil {
+			return nil, err
+		}
+
+		if cyclic {
+			return nil, ErrInvalidLocationTree
+		}
+	}
+
+	rows, err := tx.Query(`SELECT location_type FROM locations WHERE parent_id = $1`, location.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var childTypes []string
+	for rows.Next() {
+		var childType string
+		if err := rows.Scan(&childType); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		childTypes = append(childTypes, childType)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, childType := range childTypes {
+		if !CanContain(location.LocationType, childType) {
+			return nil, ErrInvalidLocationTree
+		}
+	}
+
+	err = tx.QueryRow(`
+		UPDATE locations
+		SET parent_id = $1, name = $2, description = $3, location_type = $4, capacity = $5, updated_at = NOW()
+		WHERE id = $6
+		RETURNING archived_at, created_at, updated_at
+	`,
+		location.ParentID,
+		location.Name,
+		location.Description,
+		location.LocationType,
+		location.Capacity,
+		location.ID,
+	).Scan(
+		&location.ArchivedAt,
+		&location.CreatedAt,
+		&location.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkCapacity(tx, location.ID, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+// DeleteLocation removes a location that has no child locations, no stock on
+// hand or reserved, and has never appeared on a stock movement or document.
+// Locations with stock or history can be archived instead, which keeps the
+// ledger intact.
+func (s *PostgresLocationStore) DeleteLocation(id uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hasChildren, hasStock, hasHistory bool
+	err = tx.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM locations WHERE parent_id = $1),
+			EXISTS (SELECT 1 FROM stock_levels WHERE location_id = $1 AND (quantity_physical <> 0 OR quantity_reserved <> 0)),
+			EXISTS (SELECT 1 FROM stock_movements WHERE location_id = $1)
+				OR EXISTS (SELECT 1 FROM transfers WHERE from_location_id = $1 OR to_location_id = $1)
+				OR EXISTS (SELECT 1 FROM reservations WHERE location_id = $1)
+				OR EXISTS (SELECT 1 FROM cycle_counts WHERE location_id = $1)
+				OR EXISTS (SELECT 1 FROM sales_order_lines WHERE location_id = $1)
+				OR EXISTS (SELECT 1 FROM work_orders WHERE location_id = $1)
+	`, id).Scan(&hasChildren, &hasStock, &hasHistory)
+	if err != nil {
+		return err
+	}
+
+	if hasChildren {
+		return ErrLocationHasChildren
+	}
+
+	if hasStock {
+		return ErrLocationHasStock
+	}
+
+	if hasHistory {
+		return ErrLocationHasHistory
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM locations
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// ArchiveLocation archives a location and everything beneath it. Archived
+// locations keep their stock but can no longer be allocated from or be the
+// destination of a transfer.
+func (s *PostgresLocationStore) ArchiveLocation(id uuid.UUID) (*Location, error) {
+	return s.setArchived(id, true)
+}
+
+// RestoreLocation brings an archived location and everything beneath it back
+// into use.
+func (s *PostgresLocationStore) RestoreLocation(id uuid.UUID) (*Location, error) {
+	return s.setArchived(id, false)
+}
+
+func (s *PostgresLocationStore) setArchived(id uuid.UUID, archived bool) (*Location, error) {
+	result, err := s.db.Exec(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM locations WHERE id = $1
+			UNION ALL
+			SELECT l.id FROM locations l JOIN subtree t ON l.parent_id = t.id
+		)
+		UPDATE locations
+		SET archived_at = CASE WHEN $2 THEN COALESCE(archived_at, NOW()) END, updated_at = NOW()
+		WHERE id IN (SELECT id FROM subtree)
+	`, id, archived)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return s.GetLocationByID(id)
+}
+
+// GetLocationStock sums the stock_levels of a location and every location
+// beneath it per item.
+func (s *PostgresLocationStore) GetLocationStock(id uuid.UUID) (*LocationStock, error) {
+	stock := &LocationStock{LocationID: id, Items: []LocationStockItem{}}
+	err := s.db.QueryRow(`SELECT capacity FROM locations WHERE id = $1`, id).Scan(&stock.Capacity)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM locations WHERE id = $1
+			UNION ALL
+			SELECT l.id FROM locations l JOIN subtree t ON l.parent_id = t.id
+		)
+		SELECT s.item_id, SUM(s.quantity_physical), SUM(s.quantity_available), SUM(s.quantity_reserved), COUNT(*)
+		FROM stock_levels s
+		JOIN subtree t ON t.id = s.location_id
+		GROUP BY s.item_id
+		ORDER BY s.item_id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item LocationStockItem
+		err := rows.Scan(
+			&item.ItemID,
+			&item.QuantityPhysical,
+			&item.QuantityAvailable,
+			&item.QuantityReserved,
+			&item.Locations,
+		)
+		if err != nil {
+			return nil, err
+		}
+		stock.QuantityPhysical += item.QuantityPhysical
+		stock.Items = append(stock.Items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stock, nil
+}
+
+// lockTree serializes changes to the shape of one organization's tree in
+// table for the rest of tx, so a cycle check sees every move committed before
+// it and none can slip in between the check and the update.
+func lockTree(tx *sql.Tx, table string, organizationID uuid.UUID) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, table+":"+organizationID.String())
+	return err
+}
+
+// checkLocationActive returns ErrLocationArchived when locationID has been
+// archived.
+func checkLocationActive(tx *sql.Tx, locationID uuid.UUID) error {
+	var archived bool
+	err := tx.QueryRow(`SELECT archived_at IS NOT NULL FROM locations WHERE id = $1`, locationID).Scan(&archived)
+	if err != nil {
+		return err
+	}
+
+	if archived {
+		return ErrLocationArchived
+	}
+
+	return nil
+}
+
+// checkCapacity returns ErrCapacityExceeded when adding quantity units at
+// locationID would take the location, or any location above it, past its
+// capacity. Capacity counts every unit stocked in a location's subtree.
+//
+// The capacity-bearing locations on the way up are locked first, in ID order,
+// so concurrent receipts into the same subtree are summed one after the other
+// instead of each passing against the same total.
+func checkCapacity(tx *sql.Tx, locationID uuid.UUID, quantity int) error {
+	rows, err := tx.Query(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM locations WHERE id = $1
+			UNION ALL
+			SELECT l.id, l.parent_id FROM locations l JOIN ancestors a ON l.id = a.parent_id
+		)
+		SELECT l.id
+		FROM locations l
+		JOIN ancestors a ON a.id = l.id
+		WHERE l.capacity IS NOT NULL
+		ORDER BY l.id
+		FOR NO KEY UPDATE OF l
+	`, locationID)
+	if err != nil {
+		return err
+	}
+
+	locked := 0
+	for rows.Next() {
+		locked++
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if locked == 0 {
+		return nil
+	}
+
+	var exceeded bool
+	err = tx.QueryRow(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id, capacity FROM locations WHERE id = $1
+			UNION ALL
+			SELECT l.id, l.parent_id, l.capacity FROM locations l JOIN ancestors a ON l.id = a.parent_id
+		), subtree AS (
+			SELECT id AS root_id, id AS location_id FROM ancestors WHERE capacity IS NOT NULL
+			UNION ALL
+			SELECT t.root_id, l.id FROM locations l JOIN subtree t ON l.parent_id = t.location_id
+		)
+		SELECT EXISTS (
+			SELECT 1
+			FROM ancestors a
+			JOIN subtree t ON t.root_id = a.id
+			LEFT JOIN stock_levels s ON s.location_id = t.location_id
+			GROUP BY a.id, a.capacity
+			HAVING COALESCE(SUM(s.quantity_physical), 0) + $2 > a.capacity
+		)
+	`, locationID, quantity).Scan(&exceeded)
+	if err != nil {
+		return err
+	}
+
+	if exceeded {
+		return ErrCapacityExceeded
+	}
+
+	return nil
+}
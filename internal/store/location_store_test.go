@@ -0,0 +1,251 @@
+package store
+
+import (
+	"errors"
+	"kabancount/internal/pagination"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteAndArchiveLocation(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	locations := NewPostgresLocationStore(db)
+
+	bin, err := locations.CreateLocation(&Location{
+		OrganizationID: location.OrganizationID,
+		ParentID:       &location.ID,
+		Name:           "Bin 1",
+		LocationType:   LocationTypeBin,
+	})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, locations.DeleteLocation(location.ID), ErrLocationHasChildren)
+
+	_, err = locations.UpdateLocation(&Location{
+		ID:             location.ID,
+		OrganizationID: location.OrganizationID,
+		ParentID:       &bin.ID,
+		Name:           location.Name,
+		LocationType:   LocationTypeWarehouse,
+	})
+	assert.ErrorIs(t, err, ErrInvalidLocationTree)
+
+	require.NoError(t, locations.DeleteLocation(bin.ID))
+	assert.ErrorIs(t, locations.DeleteLocation(location.ID), ErrLocationHasStock)
+
+	archived, err := locations.ArchiveLocation(location.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, archived.ArchivedAt)
+
+	active, err := locations.GetLocationsByOrganization(pagination.Params{Limit: 10}, location.OrganizationID, false)
+	require.NoError(t, err)
+	assert.Empty(t, active.Data)
+
+	_, err = NewPostgresStockMovementStore(db).CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeReserve,
+		Quantity:     1,
+	})
+	assert.ErrorIs(t, err, ErrLocationArchived)
+
+	_, err = NewPostgresStockMovementStore(db).CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeReceipt,
+		Quantity:     1,
+	})
+	assert.ErrorIs(t, err, ErrLocationArchived)
+
+	// Stock already at the archived location can still leave it.
+	_, err = NewPostgresStockMovementStore(db).CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeIssue,
+		Quantity:     -2,
+	})
+	require.NoError(t, err)
+
+	overflow, err := locations.CreateLocation(&Location{
+		OrganizationID: location.OrganizationID,
+		Name:           "Overflow",
+		LocationType:   LocationTypeWarehouse,
+	})
+	require.NoError(t, err)
+
+	transfers := NewPostgresTransferStore(db)
+	transfer, err := transfers.CreateTransfer(&Transfer{
+		OrganizationID: location.OrganizationID,
+		FromLocationID: location.ID,
+		ToLocationID:   overflow.ID,
+		Lines:          []TransferLine{{ItemID: item.ID, Quantity: 3}},
+	})
+	require.NoError(t, err)
+
+	physical, _ := readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 5, physical)
+
+	// Cancelling hands the stock back to the archived source.
+	user := seedUser(t, db, location.OrganizationID)
+	_, err = transfers.CancelTransfer(transfer.ID, user.ID)
+	require.NoError(t, err)
+
+	physical, _ = readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 8, physical)
+
+	_, err = transfers.CreateTransfer(&Transfer{
+		OrganizationID: location.OrganizationID,
+		FromLocationID: location.ID,
+		ToLocationID:   overflow.ID,
+		Status:         TransferStatusCompleted,
+		Lines:          []TransferLine{{ItemID: item.ID, Quantity: 3}},
+	})
+	require.NoError(t, err)
+
+	// The archived location cannot take the stock back in.
+	inbound, err := transfers.CreateTransfer(&Transfer{
+		OrganizationID: location.OrganizationID,
+		FromLocationID: overflow.ID,
+		ToLocationID:   location.ID,
+		Lines:          []TransferLine{{ItemID: item.ID, Quantity: 1}},
+	})
+	require.NoError(t, err)
+
+	_, err = transfers.ReceiveTransfer(inbound.ID, user.ID)
+	assert.ErrorIs(t, err, ErrLocationArchived)
+
+	restored, err := locations.RestoreLocation(location.ID)
+	require.NoError(t, err)
+	assert.Nil(t, restored.ArchivedAt)
+}
+
+func TestLocationCapacity(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Main holds 10 units of the seeded item.
+	item, warehouse := seedItemAndLocation(t, db)
+	_, err := db.Exec(`UPDATE locations SET capacity = 20 WHERE id = $1`, warehouse.ID)
+	require.NoError(t, err)
+
+	locations := NewPostgresLocationStore(db)
+	zone, err := locations.CreateLocation(&Location{
+		OrganizationID: warehouse.OrganizationID,
+		ParentID:       &warehouse.ID,
+		Name:           "Zone A",
+		LocationType:   LocationTypeZone,
+	})
+	require.NoError(t, err)
+
+	binCapacity := 5
+	bin, err := locations.CreateLocation(&Location{
+		OrganizationID: warehouse.OrganizationID,
+		ParentID:       &zone.ID,
+		Name:           "Bin A1",
+		LocationType:   LocationTypeBin,
+		Capacity:       &binCapacity,
+	})
+	require.NoError(t, err)
+
+	movements := NewPostgresStockMovementStore(db)
+	receive := func(locationID uuid.UUID, quantity int) error {
+		_, err := movements.CreateMovement(&StockMovement{
+			ItemID:       item.ID,
+			LocationID:   locationID,
+			MovementType: MovementTypeReceipt,
+			Quantity:     quantity,
+		})
+		return err
+	}
+
+	assert.ErrorIs(t, receive(bin.ID, 6), ErrCapacityExceeded)
+	require.NoError(t, receive(bin.ID, 5))
+
+	// The zone has no capacity of its own but counts towards the warehouse.
+	assert.ErrorIs(t, receive(zone.ID, 6), ErrCapacityExceeded)
+	require.NoError(t, receive(zone.ID, 3))
+
+	stock, err := locations.GetLocationStock(warehouse.ID)
+	require.NoError(t, err)
+	require.Len(t, stock.Items, 1)
+	assert.Equal(t, 18, stock.Items[0].QuantityPhysical)
+
+	physical, _ := readStockLevel(t, db, item.ID, zone.ID)
+	assert.Equal(t, 3, physical)
+
+	// Two concurrent receipts that each fit on their own cannot both land.
+	results := make(chan error, 2)
+	for range 2 {
+		go func() { results <- receive(zone.ID, 2) }()
+	}
+
+	exceeded := 0
+	for range 2 {
+		err := <-results
+		if errors.Is(err, ErrCapacityExceeded) {
+			exceeded++
+			continue
+		}
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, exceeded)
+
+	stock, err = locations.GetLocationStock(warehouse.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 20, stock.Items[0].QuantityPhysical)
+
+	// Capacity cannot drop below what the bin already holds.
+	binCapacity = 4
+	bin.Capacity = &binCapacity
+	_, err = locations.UpdateLocation(bin)
+	assert.ErrorIs(t, err, ErrCapacityExceeded)
+}
+
+func TestDeleteLocationWithHistory(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, warehouse := seedItemAndLocation(t, db)
+	locations := NewPostgresLocationStore(db)
+	bin, err := locations.CreateLocation(&Location{
+		OrganizationID: warehouse.OrganizationID,
+		ParentID:       &warehouse.ID,
+		Name:           "Bin 1",
+		LocationType:   LocationTypeBin,
+	})
+	require.NoError(t, err)
+
+	movements := NewPostgresStockMovementStore(db)
+	for _, quantity := range []int{2, -2} {
+		movementType := MovementTypeReceipt
+		if quantity < 0 {
+			movementType = MovementTypeIssue
+		}
+
+		_, err := movements.CreateMovement(&StockMovement{
+			ItemID:       item.ID,
+			LocationID:   bin.ID,
+			MovementType: movementType,
+			Quantity:     quantity,
+		})
+		require.NoError(t, err)
+	}
+
+	// The bin is empty again but its ledger must survive.
+	assert.ErrorIs(t, locations.DeleteLocation(bin.ID), ErrLocationHasHistory)
+
+	var entries int
+	err = db.QueryRow(`SELECT COUNT(*) FROM stock_movements WHERE location_id = $1`, bin.ID).Scan(&entries)
+	require.NoError(t, err)
+	assert.Equal(t, 2, entries)
+
+	archived, err := locations.ArchiveLocation(bin.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, archived.ArchivedAt)
+}
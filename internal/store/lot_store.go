@@ -0,0 +1,304 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrLotExpired is returned when an outbound movement could only be covered
+// by stock in expired lots. It is a kind of ErrInsufficientStock.
+var ErrLotExpired = fmt.Errorf("%w: only expired lot stock remains", ErrInsufficientStock)
+
+type Lot struct {
+	ID             uuid.UUID  `json:"id"`
+	ItemID         uuid.UUID  `json:"item_id"`
+	LotNumber      string     `json:"lot_number"`
+	ManufacturedAt *time.Time `json:"manufactured_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Stock          []LotStock `json:"stock,omitempty"`
+}
+
+type LotStock struct {
+	LocationID uuid.UUID `json:"location_id"`
+	Quantity   int       `json:"quantity"`
+}
+
+type ExpiringLot struct {
+	LotID      uuid.UUID `json:"lot_id"`
+	ItemID     uuid.UUID `json:"item_id"`
+	LotNumber  string    `json:"lot_number"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LocationID uuid.UUID `json:"location_id"`
+	Quantity   int       `json:"quantity"`
+}
+
+type PostgresLotStore struct {
+	db *sql.DB
+}
+
+func NewPostgresLotStore(db *sql.DB) *PostgresLotStore {
+	return &PostgresLotStore{db: db}
+}
+
+type LotStore interface {
+	GetLotByID(id uuid.UUID) (*Lot, error)
+	GetLotsByItem(itemID uuid.UUID) ([]*Lot, error)
+	GetExpiringLots(organizationID uuid.UUID, before time.Time) ([]*ExpiringLot, error)
+}
+
+func (s *PostgresLotStore) GetLotByID(id uuid.UUID) (*Lot, error) {
+	query := lotSelect + `
+		WHERE l.id = $1
+	`
+
+	lot, err := scanLot(s.db.QueryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return lot, nil
+}
+
+func (s *PostgresLotStore) GetLotsByItem(itemID uuid.UUID) ([]*Lot, error) {
+	query := lotSelect + `
+		WHERE l.item_id = $1
+		ORDER BY l.expires_at NULLS LAST, l.created_at
+	`
+
+	rows, err := s.db.Query(query, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []*Lot
+	for rows.Next() {
+		lot, err := scanLot(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		lots = append(lots, lot)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lots, nil
+}
+
+// GetExpiringLots lists lot stock on hand that expires on or before before,
+// including lots that have already expired.
+func (s *PostgresLotStore) GetExpiringLots(organizationID uuid.UUID, before time.Time) ([]*ExpiringLot, error) {
+	query := `
+		SELECT l.id, l.item_id, l.lot_number, l.expires_at, ls.location_id, ls.quantity
+		FROM lot_stock ls
+		JOIN lots l ON l.id = ls.lot_id
+		JOIN items i ON i.id = l.item_id
+		WHERE i.organization_id = $1 AND ls.quantity > 0 AND l.expires_at <= $2
+		ORDER BY l.expires_at, l.lot_number, ls.location_id
+	`
+
+	rows, err := s.db.Query(query, organizationID, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lots := []*ExpiringLot{}
+	for rows.Next() {
+		lot := &ExpiringLot{}
+		err := rows.Scan(
+			&lot.LotID,
+			&lot.ItemID,
+			&lot.LotNumber,
+			&lot.ExpiresAt,
+			&lot.LocationID,
+			&lot.Quantity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		lots = append(lots, lot)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lots, nil
+}
+
+// upsertLot returns the item's lot with lot.LotNumber, creating it if needed.
+// Dates given on an existing lot replace the stored ones.
+func upsertLot(queryRow func(query string, args ...any) *sql.Row, lot *Lot) error {
+	return queryRow(`
+		INSERT INTO lots (item_id, lot_number, manufactured_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (item_id, lot_number) DO UPDATE
+		SET manufactured_at = COALESCE(EXCLUDED.manufactured_at, lots.manufactured_at),
+			expires_at = COALESCE(EXCLUDED.expires_at, lots.expires_at)
+		RETURNING id, manufactured_at, expires_at, created_at
+	`, lot.ItemID, lot.LotNumber, lot.ManufacturedAt, lot.ExpiresAt).Scan(
+		&lot.ID,
+		&lot.ManufacturedAt,
+		&lot.ExpiresAt,
+		&lot.CreatedAt,
+	)
+}
+
+type lotPortion struct {
+	lotID    *uuid.UUID
+	quantity int
+	serials  []string
+}
+
+// allocateLots splits quantity across the item's unexpired lots at a
+// location, earliest expiry first. Whatever the lots cannot cover is returned
+// as a final portion without a lot, drawn from untracked stock; when that is
+// not enough and the rest of the stock on hand is in expired lots the issue
+// fails with ErrLotExpired. Expired lots are only issued by naming them.
+func allocateLots(tx *sql.Tx, itemID, locationID uuid.UUID, quantity int) ([]lotPortion, error) {
+	// Lock the stock level before any lot rows so lot receipts, which lock in
+	// the same order through postLedgerEntry, cannot deadlock with us.
+	var physical int
+	err := tx.QueryRow(`
+		SELECT quantity_physical
+		FROM stock_levels
+		WHERE item_id = $1 AND location_id = $2
+		FOR UPDATE
+	`, itemID, locationID).Scan(&physical)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT ls.lot_id, ls.quantity, l.expires_at IS NOT NULL AND l.expires_at <= NOW()
+		FROM lot_stock ls
+		JOIN lots l ON l.id = ls.lot_id
+		WHERE l.item_id = $1 AND ls.location_id = $2 AND ls.quantity > 0
+		ORDER BY l.expires_at NULLS LAST, l.created_at
+		FOR UPDATE OF ls
+	`, itemID, locationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var portions []lotPortion
+	untracked, expired := physical, 0
+	for rows.Next() {
+		var lotID uuid.UUID
+		var onHand int
+		var isExpired bool
+		err := rows.Scan(&lotID, &onHand, &isExpired)
+		if err != nil {
+			return nil, err
+		}
+
+		untracked -= onHand
+		if isExpired {
+			expired += onHand
+			continue
+		}
+
+		if quantity > 0 {
+			taken := min(onHand, quantity)
+			portions = append(portions, lotPortion{lotID: &lotID, quantity: taken})
+			quantity -= taken
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if quantity > untracked && expired > 0 {
+		return nil, ErrLotExpired
+	}
+
+	if quantity > 0 {
+		portions = append(portions, lotPortion{quantity: quantity})
+	}
+
+	return portions, nil
+}
+
+func adjustLotStock(tx *sql.Tx, lotID, locationID uuid.UUID, delta int) error {
+	if delta > 0 {
+		_, err := tx.Exec(`
+			INSERT INTO lot_stock (lot_id, location_id, quantity)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (lot_id, location_id) DO UPDATE
+			SET quantity = lot_stock.quantity + EXCLUDED.quantity, updated_at = NOW()
+		`, lotID, locationID, delta)
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE lot_stock
+		SET quantity = quantity + $3, updated_at = NOW()
+		WHERE lot_id = $1 AND location_id = $2 AND quantity + $3 >= 0
+	`, lotID, locationID, delta)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrInsufficientStock
+	}
+
+	return nil
+}
+
+const lotSelect = `
+	SELECT l.id, l.item_id, l.lot_number, l.manufactured_at, l.expires_at, l.created_at,
+		COALESCE((
+			SELECT JSON_AGG(
+				JSON_BUILD_OBJECT(
+					'location_id', ls.location_id,
+					'quantity', ls.quantity
+				) ORDER BY ls.location_id
+			)
+			FROM lot_stock ls
+			WHERE ls.lot_id = l.id AND ls.quantity > 0
+		), '[]') AS stock
+	FROM lots l
+`
+
+func scanLot(scan func(dest ...any) error) (*Lot, error) {
+	lot := &Lot{}
+	var stockJSON []byte
+	err := scan(
+		&lot.ID,
+		&lot.ItemID,
+		&lot.LotNumber,
+		&lot.ManufacturedAt,
+		&lot.ExpiresAt,
+		&lot.CreatedAt,
+		&stockJSON,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(stockJSON, &lot.Stock); err != nil {
+		return nil, err
+	}
+
+	return lot, nil
+}
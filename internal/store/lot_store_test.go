@@ -0,0 +1,95 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueLotsFirstExpiredFirstOut(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	seeded, location := seedItemAndLocation(t, db)
+	item, err := NewPostgresItemStore(db).CreateItem(&Item{
+		OrganizationID: seeded.OrganizationID,
+		CategoryID:     seeded.CategoryID,
+		Name:           "Ledger Medicine",
+		UnitPrice:      100,
+		CostPrice:      10,
+		IsActive:       true,
+		BaseUnit:       DefaultBaseUnit,
+	})
+	require.NoError(t, err)
+
+	movements := NewPostgresStockMovementStore(db)
+	receive := func(lotNumber string, expiresAt time.Time, quantity int) *Lot {
+		movement, err := movements.CreateMovement(&StockMovement{
+			ItemID:       item.ID,
+			LocationID:   location.ID,
+			MovementType: MovementTypeReceipt,
+			Quantity:     quantity,
+			Lot:          &Lot{LotNumber: lotNumber, ExpiresAt: &expiresAt},
+		})
+		require.NoError(t, err)
+		return movement.Lot
+	}
+
+	late := receive("LATE", time.Now().AddDate(0, 0, 10), 3)
+	early := receive("EARLY", time.Now().AddDate(0, 0, 5), 4)
+	expired := receive("EXPIRED", time.Now().AddDate(0, 0, -1), 2)
+
+	lotQuantity := func(lot *Lot) int {
+		t.Helper()
+		var quantity int
+		err := db.QueryRow(`SELECT quantity FROM lot_stock WHERE lot_id = $1 AND location_id = $2`, lot.ID, location.ID).Scan(&quantity)
+		require.NoError(t, err)
+		return quantity
+	}
+
+	// One issue spanning two lots takes the earliest expiry first and skips
+	// the expired lot.
+	issued, err := movements.CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeIssue,
+		Quantity:     -6,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, issued.TotalCost)
+	assert.Equal(t, -60, *issued.TotalCost)
+
+	assert.Equal(t, 0, lotQuantity(early))
+	assert.Equal(t, 1, lotQuantity(late))
+	assert.Equal(t, 2, lotQuantity(expired))
+
+	var entries int
+	err = db.QueryRow(`SELECT COUNT(*) FROM stock_movements WHERE item_id = $1 AND movement_type = $2`, item.ID, MovementTypeIssue).Scan(&entries)
+	require.NoError(t, err)
+	assert.Equal(t, 2, entries)
+
+	// Only expired stock is left beyond the last unit of LATE.
+	_, err = movements.CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeIssue,
+		Quantity:     -2,
+	})
+	assert.ErrorIs(t, err, ErrLotExpired)
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+
+	physical, _ := readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 3, physical)
+
+	_, err = movements.CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeIssue,
+		Quantity:     -2,
+		LotID:        &expired.ID,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, lotQuantity(expired))
+}
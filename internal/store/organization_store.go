@@ -8,10 +8,11 @@ import (
 )
 
 type Organization struct {
-	ID        uuid.UUID `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	CostingMethod string    `json:"costing_method"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
 type PostgresOrganizationStore struct {
@@ -37,15 +38,17 @@ func (pg *PostgresOrganizationStore) CreateOrganization(org *Organization) (*Org
 	defer tx.Rollback()
 
 	query := `
-		INSERT INTO organizations (name)
-		VALUES ($1)
-		RETURNING id, created_at, updated_at
+		INSERT INTO organizations (name, costing_method)
+		VALUES ($1, COALESCE(NULLIF($2, ''), 'fifo'))
+		RETURNING id, costing_method, created_at, updated_at
 	`
 	err = tx.QueryRow(
 		query,
 		org.Name,
+		org.CostingMethod,
 	).Scan(
 		&org.ID,
+		&org.CostingMethod,
 		&org.CreatedAt,
 		&org.UpdatedAt,
 	)
@@ -64,13 +67,14 @@ func (pg *PostgresOrganizationStore) CreateOrganization(org *Organization) (*Org
 func (pg *PostgresOrganizationStore) GetOrganizationByID(id uuid.UUID) (*Organization, error) {
 	org := &Organization{}
 	query := `
-		SELECT id, name, created_at, updated_at
+		SELECT id, name, costing_method, created_at, updated_at
 		FROM organizations
 		WHERE id = $1
 	`
 	err := pg.db.QueryRow(query, id).Scan(
 		&org.ID,
 		&org.Name,
+		&org.CostingMethod,
 		&org.CreatedAt,
 		&org.UpdatedAt,
 	)
@@ -95,13 +99,14 @@ func (pg *PostgresOrganizationStore) UpdateOrganization(org *Organization) (*Org
 
 	query := `
 		UPDATE organizations
-		SET name = $1, updated_at = NOW()
-		WHERE id = $2
+		SET name = $1, costing_method = $2, updated_at = NOW()
+		WHERE id = $3
 		RETURNING updated_at
 	`
 	results, err := tx.Exec(
 		query,
 		org.Name,
+		org.CostingMethod,
 		org.ID,
 	)
 	if err != nil {
@@ -0,0 +1,754 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kabancount/internal/pagination"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrProductHasVariants = errors.New("product has variants")
+	ErrItemNameTaken      = errors.New("item name is already in use")
+	ErrVariantExists      = errors.New("product already has a variant with these option values")
+)
+
+// ProductOption is one axis a product varies along, such as size or color,
+// with the values it can take.
+type ProductOption struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values"`
+}
+
+// Product is the parent of a set of variant items. It holds the attributes
+// its variants share and the option axes they are generated from; each
+// variant is an ordinary item with its own SKU, price and stock levels.
+type Product struct {
+	ID             uuid.UUID        `json:"id"`
+	OrganizationID uuid.UUID        `json:"organization_id"`
+	CategoryID     uuid.UUID        `json:"category_id"`
+	SKU            *string          `json:"sku"`
+	Name           string           `json:"name"`
+	Description    *string          `json:"description"`
+	UnitPrice      int              `json:"unit_price"`
+	CostPrice      int              `json:"cost_price"`
+	BaseUnit       string           `json:"base_unit"`
+	Attributes     map[string]any   `json:"attributes"`
+	Options        []ProductOption  `json:"options"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	Variants       []ProductVariant `json:"variants"`
+}
+
+// ProductVariant summarises a variant item and its stock summed over all
+// locations.
+type ProductVariant struct {
+	ID                uuid.UUID         `json:"id"`
+	SKU               *string           `json:"sku"`
+	Name              string            `json:"name"`
+	OptionValues      map[string]string `json:"option_values"`
+	UnitPrice         int               `json:"unit_price"`
+	UnitPriceOverride *int              `json:"unit_price_override"`
+	CostPrice         int               `json:"cost_price"`
+	IsActive          bool              `json:"is_active"`
+	QuantityPhysical  int               `json:"quantity_physical"`
+	QuantityAvailable int               `json:"quantity_available"`
+	QuantityReserved  int               `json:"quantity_reserved"`
+}
+
+type PostgresProductStore struct {
+	db *sql.DB
+}
+
+func NewPostgresProductStore(db *sql.DB) *PostgresProductStore {
+	return &PostgresProductStore{db: db}
+}
+
+type ProductStore interface {
+	CreateProduct(product *Product) (*Product, error)
+	GetProductByID(id uuid.UUID) (*Product, error)
+	UpdateProduct(product *Product) (*Product, error)
+	DeleteProduct(id uuid.UUID) error
+	GetProductsByOrganization(params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Product], error)
+	CountProductsByOrganization(organizationID uuid.UUID) (int, error)
+	GenerateVariants(productID uuid.UUID) ([]*Item, error)
+}
+
+// productVariantsJSON aggregates the variants of product p with their stock
+// summed across locations.
+const productVariantsJSON = `
+	COALESCE((
+		SELECT JSON_AGG(
+			JSON_BUILD_OBJECT(
+				'id', i.id,
+				'sku', i.sku,
+				'name', i.name,
+				'option_values', i.option_values,
+				'unit_price', i.unit_price,
+				'unit_price_override', i.unit_price_override,
+				'cost_price', i.cost_price,
+				'is_active', i.is_active,
+				'quantity_physical', COALESCE(s.quantity_physical, 0),
+				'quantity_available', COALESCE(s.quantity_available, 0),
+				'quantity_reserved', COALESCE(s.quantity_reserved, 0)
+			) ORDER BY i.name
+		)
+		FROM items i
+		LEFT JOIN (
+			SELECT item_id,
+				SUM(quantity_physical) AS quantity_physical,
+				SUM(quantity_available) AS quantity_available,
+				SUM(quantity_reserved) AS quantity_reserved
+			FROM stock_levels
+			GROUP BY item_id
+		) s ON s.item_id = i.id
+		WHERE i.product_id = p.id AND i.deleted_at IS NULL
+	), '[]')
+`
+
+func (s *PostgresProductStore) CreateProduct(product *Product) (*Product, error) {
+	if product.Attributes == nil {
+		product.Attributes = map[string]any{}
+	}
+
+	attributesJSON, err := json.Marshal(product.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	optionsJSON, err := json.Marshal(product.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO products (organization_id, category_id, sku, name, description, unit_price, cost_price, base_unit, attributes, options)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at, updated_at
+	`
+
+	err = s.db.QueryRow(
+		query,
+		product.OrganizationID,
+		product.CategoryID,
+		product.SKU,
+		product.Name,
+		product.Description,
+		product.UnitPrice,
+		product.CostPrice,
+		product.BaseUnit,
+		attributesJSON,
+		optionsJSON,
+	).Scan(
+		&product.ID,
+		&product.CreatedAt,
+		&product.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	product.Variants = []ProductVariant{}
+
+	return product, nil
+}
+
+func (s *PostgresProductStore) GetProductByID(id uuid.UUID) (*Product, error) {
+	query := `
+		SELECT p.id, p.organization_id, p.category_id, p.sku, p.name, p.description, p.unit_price, p.cost_price, p.base_unit, p.attributes, p.options, p.created_at, p.updated_at,
+		` + productVariantsJSON + `
+		FROM products p
+		WHERE p.id = $1
+	`
+
+	product := &Product{}
+	var attributesJSON, optionsJSON, variantsJSON []byte
+	err := s.db.QueryRow(query, id).Scan(
+		&product.ID,
+		&product.OrganizationID,
+		&product.CategoryID,
+		&product.SKU,
+		&product.Name,
+		&product.Description,
+		&product.UnitPrice,
+		&product.CostPrice,
+		&product.BaseUnit,
+		&attributesJSON,
+		&optionsJSON,
+		&product.CreatedAt,
+		&product.UpdatedAt,
+		&variantsJSON,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(attributesJSON, &product.Attributes); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(optionsJSON, &product.Options); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(variantsJSON, &product.Variants); err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// UpdateProduct saves a product and carries what it shares down to its
+// variants: category, description and the product's attributes always follow
+// the product, and a variant's unit price follows it unless the variant has a
+// price override. Attributes a variant holds on its own are kept.
+// Moving the product to another category returns ErrInvalidAttributes when a
+// variant's attributes do not fit the new category's schema. Renaming an
+// option axis renames it in the variants' option values, so
+// regenerating does not create the variants again. Existing variants are left
+// in place when option values are removed.
+func (s *PostgresProductStore) UpdateProduct(product *Product) (*Product, error) {
+	if product.Attributes == nil {
+		product.Attributes = map[string]any{}
+	}
+
+	attributesJSON, err := json.Marshal(product.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	optionsJSON, err := json.Marshal(product.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var previousCategoryID uuid.UUID
+	var previousOptionsJSON []byte
+	err = tx.QueryRow(`SELECT category_id, options FROM products WHERE id = $1 FOR UPDATE`, product.ID).Scan(&previousCategoryID, &previousOptionsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var previousOptions []ProductOption
+	if err := json.Unmarshal(previousOptionsJSON, &previousOptions); err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		UPDATE products
+		SET category_id = $1, sku = $2, name = $3, description = $4, unit_price = $5, cost_price = $6, attributes = $7, options = $8, updated_at = NOW()
+		WHERE id = $9
+		RETURNING updated_at
+	`,
+		product.CategoryID,
+		product.SKU,
+		product.Name,
+		product.Description,
+		product.UnitPrice,
+		product.CostPrice,
+		attributesJSON,
+		optionsJSON,
+		product.ID,
+	).Scan(&product.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE items
+		SET category_id = $2,
+			description = $3,
+			unit_price = COALESCE(unit_price_override, $4),
+			attributes = attributes || $5::jsonb,
+			updated_at = NOW()
+		WHERE product_id = $1
+	`, product.ID, product.CategoryID, product.Description, product.UnitPrice, attributesJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if product.CategoryID != previousCategoryID {
+		err = checkVariantAttributes(tx, product.ID, product.CategoryID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if renames := optionRenames(previousOptions, product.Options); len(renames) > 0 {
+		err = renameVariantOptions(tx, product.ID, renames)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetProductByID(product.ID)
+}
+
+func (s *PostgresProductStore) DeleteProduct(id uuid.UUID) error {
+	var hasVariants bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM items WHERE product_id = $1)`, id).Scan(&hasVariants)
+	if err != nil {
+		return err
+	}
+
+	if hasVariants {
+		return ErrProductHasVariants
+	}
+
+	result, err := s.db.Exec(`
+		DELETE FROM products
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// productOrder lists products by name.
+var productOrder = pagination.Order[*Product]{
+	Name:     "name",
+	Column:   "p.name",
+	Type:     "text",
+	IDColumn: "p.id",
+	Key:      func(product *Product) (string, uuid.UUID) { return product.Name, product.ID },
+}
+
+func (s *PostgresProductStore) GetProductsByOrganization(params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Product], error) {
+	pageClause, args, err := pagination.Clause(params, productOrder, []any{organizationID})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT p.id, p.organization_id, p.category_id, p.sku, p.name, p.description, p.unit_price, p.cost_price, p.base_unit, p.attributes, p.options, p.created_at, p.updated_at,
+		` + productVariantsJSON + `
+		FROM products p
+		WHERE p.organization_id = $1` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*Product{}
+	for rows.Next() {
+		product := &Product{}
+		var attributesJSON, optionsJSON, variantsJSON []byte
+		err := rows.Scan(
+			&product.ID,
+			&product.OrganizationID,
+			&product.CategoryID,
+			&product.SKU,
+			&product.Name,
+			&product.Description,
+			&product.UnitPrice,
+			&product.CostPrice,
+			&product.BaseUnit,
+			&attributesJSON,
+			&optionsJSON,
+			&product.CreatedAt,
+			&product.UpdatedAt,
+			&variantsJSON,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(attributesJSON, &product.Attributes); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(optionsJSON, &product.Options); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(variantsJSON, &product.Variants); err != nil {
+			return nil, err
+		}
+
+		products = append(products, product)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, productOrder, products), nil
+}
+
+func (s *PostgresProductStore) CountProductsByOrganization(organizationID uuid.UUID) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM products WHERE organization_id = $1`, organizationID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GenerateVariants creates a variant item for every combination of the
+// product's option values that has no live variant, and returns the items
+// it created. Variants start with the product's prices and no stock; they are
+// named after the product and their option values, and get an SKU built the
+// same way when the product has one, and carry a copy of the product's
+// attributes. A generated name already used by another item returns
+// ErrItemNameTaken, and product attributes that no longer fit the category,
+// such as after it gained a required attribute, return ErrInvalidAttributes.
+func (s *PostgresProductStore) GenerateVariants(productID uuid.UUID) ([]*Item, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	product := &Product{}
+	var attributesJSON, optionsJSON []byte
+	err = tx.QueryRow(`
+		SELECT id, organization_id, category_id, sku, name, description, unit_price, cost_price, base_unit, attributes, options
+		FROM products
+		WHERE id = $1
+		FOR UPDATE
+	`, productID).Scan(
+		&product.ID,
+		&product.OrganizationID,
+		&product.CategoryID,
+		&product.SKU,
+		&product.Name,
+		&product.Description,
+		&product.UnitPrice,
+		&product.CostPrice,
+		&product.BaseUnit,
+		&attributesJSON,
+		&optionsJSON,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(attributesJSON, &product.Attributes); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(optionsJSON, &product.Options); err != nil {
+		return nil, err
+	}
+
+	// Variants start with the product's attributes, which the category may
+	// have changed its schema under since they were saved.
+	schema, err := attributeSchema(tx, product.CategoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ValidateAttributes(schema, product.Attributes); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAttributes, err)
+	}
+
+	rows, err := tx.Query(`SELECT option_values FROM items WHERE product_id = $1 AND deleted_at IS NULL`, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]bool{}
+	for rows.Next() {
+		var optionValuesJSON []byte
+		if err := rows.Scan(&optionValuesJSON); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		var optionValues map[string]string
+		if err := json.Unmarshal(optionValuesJSON, &optionValues); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		key, err := json.Marshal(optionValues)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		existing[string(key)] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	created := []*Item{}
+	for _, values := range optionCombinations(product.Options) {
+		optionValues := make(map[string]string, len(values))
+		for i, option := range product.Options {
+			optionValues[option.Name] = values[i]
+		}
+
+		// json.Marshal sorts map keys, so the encoding doubles as a key
+		// that does not depend on axis order.
+		optionValuesJSON, err := json.Marshal(optionValues)
+		if err != nil {
+			return nil, err
+		}
+
+		if existing[string(optionValuesJSON)] {
+			continue
+		}
+
+		item := &Item{
+			OrganizationID: product.OrganizationID,
+			CategoryID:     product.CategoryID,
+			Name:           product.Name + " " + strings.Join(values, " "),
+			Description:    product.Description,
+			UnitPrice:      product.UnitPrice,
+			CostPrice:      product.CostPrice,
+			IsActive:       true,
+			BaseUnit:       product.BaseUnit,
+			ProductID:      &product.ID,
+			OptionValues:   optionValues,
+			Attributes:     product.Attributes,
+		}
+
+		if product.SKU != nil {
+			sku := strings.ToUpper(strings.ReplaceAll(*product.SKU+"-"+strings.Join(values, "-"), " ", "-"))
+			item.SKU = &sku
+		}
+
+		var nameTaken bool
+		err = tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM items WHERE organization_id = $1 AND name = $2 AND deleted_at IS NULL)
+		`, item.OrganizationID, item.Name).Scan(&nameTaken)
+		if err != nil {
+			return nil, err
+		}
+
+		if nameTaken {
+			return nil, fmt.Errorf("%w: %s", ErrItemNameTaken, item.Name)
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO items (sku, organization_id, category_id, name, description, unit_price, cost_price, is_active, base_unit, product_id, option_values, attributes)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			RETURNING id, created_at, updated_at
+		`,
+			item.SKU,
+			item.OrganizationID,
+			item.CategoryID,
+			item.Name,
+			item.Description,
+			item.UnitPrice,
+			item.CostPrice,
+			item.IsActive,
+			item.BaseUnit,
+			item.ProductID,
+			optionValuesJSON,
+			attributesJSON,
+		).Scan(
+			&item.ID,
+			&item.CreatedAt,
+			&item.UpdatedAt,
+		)
+		if isUniqueViolation(err, "idx_items_product_options") {
+			return nil, fmt.Errorf("%w: %s", ErrVariantExists, item.Name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		created = append(created, item)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// attributeSchema reads the attribute schema of a category.
+func attributeSchema(tx *sql.Tx, categoryID uuid.UUID) ([]CategoryAttribute, error) {
+	var schemaJSON []byte
+	err := tx.QueryRow(`SELECT attribute_schema FROM categories WHERE id = $1`, categoryID).Scan(&schemaJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema []CategoryAttribute
+	if err := json.Unmarshal(schemaJSON, &schema); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// checkVariantAttributes validates the attributes of a product's live
+// variants against the schema of categoryID.
+func checkVariantAttributes(tx *sql.Tx, productID, categoryID uuid.UUID) error {
+	schema, err := attributeSchema(tx, categoryID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT name, attributes FROM items WHERE product_id = $1 AND deleted_at IS NULL ORDER BY name`, productID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var attributesJSON []byte
+		if err := rows.Scan(&name, &attributesJSON); err != nil {
+			return err
+		}
+
+		var attributes map[string]any
+		if err := json.Unmarshal(attributesJSON, &attributes); err != nil {
+			return err
+		}
+
+		if err := ValidateAttributes(schema, attributes); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidAttributes, name, err)
+		}
+	}
+
+	return rows.Err()
+}
+
+// optionRenames pairs up the option axes that were renamed in place: an axis
+// whose name changed at the same position, where neither name appears on the
+// other side. Adding, removing or reordering axes renames nothing.
+func optionRenames(previous, options []ProductOption) map[string]string {
+	if len(previous) != len(options) {
+		return nil
+	}
+
+	previousNames := make(map[string]bool, len(previous))
+	for _, option := range previous {
+		previousNames[option.Name] = true
+	}
+
+	names := make(map[string]bool, len(options))
+	for _, option := range options {
+		names[option.Name] = true
+	}
+
+	renames := map[string]string{}
+	for i, option := range options {
+		from := previous[i].Name
+		if from != option.Name && !names[from] && !previousNames[option.Name] {
+			renames[from] = option.Name
+		}
+	}
+
+	return renames
+}
+
+// renameVariantOptions rewrites the option value keys of a product's variants,
+// trashed ones included, according to renames.
+func renameVariantOptions(tx *sql.Tx, productID uuid.UUID, renames map[string]string) error {
+	rows, err := tx.Query(`SELECT id, option_values FROM items WHERE product_id = $1 FOR UPDATE`, productID)
+	if err != nil {
+		return err
+	}
+
+	variants := map[uuid.UUID]map[string]string{}
+	for rows.Next() {
+		var id uuid.UUID
+		var optionValuesJSON []byte
+		if err := rows.Scan(&id, &optionValuesJSON); err != nil {
+			rows.Close()
+			return err
+		}
+
+		var optionValues map[string]string
+		if err := json.Unmarshal(optionValuesJSON, &optionValues); err != nil {
+			rows.Close()
+			return err
+		}
+		variants[id] = optionValues
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for id, optionValues := range variants {
+		renamed := make(map[string]string, len(optionValues))
+		for name, value := range optionValues {
+			if to, ok := renames[name]; ok {
+				name = to
+			}
+			renamed[name] = value
+		}
+
+		renamedJSON, err := json.Marshal(renamed)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`UPDATE items SET option_values = $2 WHERE id = $1`, id, renamedJSON)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// optionCombinations returns every combination of one value per option, in
+// the order of the options and their values. A product without options has
+// no combinations.
+func optionCombinations(options []ProductOption) [][]string {
+	if len(options) == 0 {
+		return nil
+	}
+
+	combinations := [][]string{{}}
+	for _, option := range options {
+		next := make([][]string, 0, len(combinations)*len(option.Values))
+		for _, combination := range combinations {
+			for _, value := range option.Values {
+				extended := make([]string, len(combination), len(combination)+1)
+				copy(extended, combination)
+				next = append(next, append(extended, value))
+			}
+		}
+		combinations = next
+	}
+
+	return combinations
+}
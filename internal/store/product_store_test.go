@@ -0,0 +1,152 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateVariants(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, _ := seedItemAndLocation(t, db)
+	products := NewPostgresProductStore(db)
+
+	sku := "shirt"
+	product, err := products.CreateProduct(&Product{
+		OrganizationID: item.OrganizationID,
+		CategoryID:     item.CategoryID,
+		SKU:            &sku,
+		Name:           "Shirt",
+		UnitPrice:      2000,
+		CostPrice:      800,
+		BaseUnit:       DefaultBaseUnit,
+		Options: []ProductOption{
+			{Name: "color", Values: []string{"Red", "Blue"}},
+			{Name: "size", Values: []string{"M", "L"}},
+		},
+	})
+	require.NoError(t, err)
+
+	variants, err := products.GenerateVariants(product.ID)
+	require.NoError(t, err)
+	require.Len(t, variants, 4)
+	assert.Equal(t, "Shirt Red M", variants[0].Name)
+	assert.Equal(t, "SHIRT-RED-M", *variants[0].SKU)
+	assert.Equal(t, map[string]string{"color": "Red", "size": "M"}, variants[0].OptionValues)
+
+	product.Options[1].Values = append(product.Options[1].Values, "XL")
+	_, err = products.UpdateProduct(product)
+	require.NoError(t, err)
+
+	variants, err = products.GenerateVariants(product.ID)
+	require.NoError(t, err)
+	assert.Len(t, variants, 2)
+
+	product, err = products.GetProductByID(product.ID)
+	require.NoError(t, err)
+	assert.Len(t, product.Variants, 6)
+
+	items := NewPostgresItemStore(db)
+	overridden, err := items.GetItemByID(variants[0].ID)
+	require.NoError(t, err)
+	overridden.UnitPrice = 2500
+	_, err = items.UpdateItem(overridden, "*")
+	require.NoError(t, err)
+
+	// The override survives the product reaching and then passing its price.
+	for _, price := range []int{2500, 3000} {
+		product.UnitPrice = price
+		product, err = products.UpdateProduct(product)
+		require.NoError(t, err)
+	}
+
+	for _, variant := range product.Variants {
+		if variant.ID == overridden.ID {
+			assert.Equal(t, 2500, variant.UnitPrice)
+			require.NotNil(t, variant.UnitPriceOverride)
+			assert.Equal(t, 2500, *variant.UnitPriceOverride)
+		} else {
+			assert.Equal(t, 3000, variant.UnitPrice)
+			assert.Nil(t, variant.UnitPriceOverride)
+		}
+	}
+
+	product.Options[1].Name = "Size"
+	product, err = products.UpdateProduct(product)
+	require.NoError(t, err)
+
+	variants, err = products.GenerateVariants(product.ID)
+	require.NoError(t, err)
+	assert.Empty(t, variants)
+	for _, variant := range product.Variants {
+		assert.Contains(t, variant.OptionValues, "Size")
+	}
+
+	// A trashed variant's combination is generated again.
+	trashed := product.Variants[0]
+	require.NoError(t, items.DeleteItem(trashed.ID))
+
+	variants, err = products.GenerateVariants(product.ID)
+	require.NoError(t, err)
+	require.Len(t, variants, 1)
+	assert.Equal(t, trashed.Name, variants[0].Name)
+
+	_, err = items.RestoreItem(item.OrganizationID, trashed.ID)
+	assert.ErrorIs(t, err, ErrItemNameTaken)
+
+	assert.ErrorIs(t, products.DeleteProduct(product.ID), ErrProductHasVariants)
+
+	appliances, err := NewPostgresCategoryStore(db).CreateCategory(&Category{
+		Name:           "Appliances",
+		OrganizationID: item.OrganizationID,
+		Attributes:     []CategoryAttribute{{Name: "voltage", Type: AttributeTypeNumber, Required: true}},
+	})
+	require.NoError(t, err)
+
+	product.CategoryID = appliances.ID
+	_, err = products.UpdateProduct(product)
+	assert.ErrorIs(t, err, ErrInvalidAttributes)
+
+	kettle, err := products.CreateProduct(&Product{
+		OrganizationID: item.OrganizationID,
+		CategoryID:     appliances.ID,
+		Name:           "Kettle",
+		UnitPrice:      3000,
+		CostPrice:      1200,
+		BaseUnit:       DefaultBaseUnit,
+		Attributes:     map[string]any{"voltage": 230.0},
+		Options:        []ProductOption{{Name: "color", Values: []string{"White", "Black"}}},
+	})
+	require.NoError(t, err)
+
+	// Variants carry the product's attributes, so a required one is met.
+	variants, err = products.GenerateVariants(kettle.ID)
+	require.NoError(t, err)
+	require.Len(t, variants, 2)
+	assert.Equal(t, map[string]any{"voltage": 230.0}, variants[0].Attributes)
+
+	kettle.Attributes = map[string]any{"voltage": 110.0}
+	_, err = products.UpdateProduct(kettle)
+	require.NoError(t, err)
+
+	variant, err := items.GetItemByID(variants[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"voltage": 110.0}, variant.Attributes)
+
+	toaster, err := products.CreateProduct(&Product{
+		OrganizationID: item.OrganizationID,
+		CategoryID:     appliances.ID,
+		Name:           "Toaster",
+		UnitPrice:      2500,
+		CostPrice:      1000,
+		BaseUnit:       DefaultBaseUnit,
+		Options:        []ProductOption{{Name: "color", Values: []string{"White"}}},
+	})
+	require.NoError(t, err)
+
+	_, err = products.GenerateVariants(toaster.ID)
+	assert.ErrorIs(t, err, ErrInvalidAttributes)
+}
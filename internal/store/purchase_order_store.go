@@ -0,0 +1,473 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/pagination"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PurchaseOrderStatusDraft             = "draft"
+	PurchaseOrderStatusSent              = "sent"
+	PurchaseOrderStatusPartiallyReceived = "partially_received"
+	PurchaseOrderStatusReceived          = "received"
+	PurchaseOrderStatusCancelled         = "cancelled"
+)
+
+var (
+	ErrUnknownOrderLine = errors.New("line does not belong to the order")
+	ErrOverReceipt      = errors.New("quantity exceeds the quantity outstanding")
+)
+
+type PurchaseOrder struct {
+	ID             uuid.UUID           `json:"id"`
+	OrganizationID uuid.UUID           `json:"organization_id"`
+	SupplierID     uuid.UUID           `json:"supplier_id"`
+	Reference      *string             `json:"reference"`
+	Status         string              `json:"status"`
+	ExpectedAt     *time.Time          `json:"expected_at"`
+	Notes          *string             `json:"notes"`
+	CreatedBy      *uuid.UUID          `json:"created_by"`
+	CreatedAt      time.Time           `json:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at"`
+	Lines          []PurchaseOrderLine `json:"lines"`
+}
+
+type PurchaseOrderLine struct {
+	ID               uuid.UUID `json:"id"`
+	PurchaseOrderID  uuid.UUID `json:"purchase_order_id"`
+	ItemID           uuid.UUID `json:"item_id"`
+	QuantityOrdered  int       `json:"quantity_ordered"`
+	QuantityReceived int       `json:"quantity_received"`
+	UnitCost         int       `json:"unit_cost"`
+}
+
+// PurchaseOrderReceipt books Quantity against an order line. A LotNumber puts
+// the received stock into that lot, creating it if needed. Serialized items
+// need one entry in SerialNumbers per unit received.
+type PurchaseOrderReceipt struct {
+	LineID         uuid.UUID  `json:"line_id"`
+	Quantity       int        `json:"quantity"`
+	LotNumber      *string    `json:"lot_number"`
+	ManufacturedAt *time.Time `json:"manufactured_at"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	SerialNumbers  []string   `json:"serial_numbers"`
+}
+
+type PostgresPurchaseOrderStore struct {
+	db *sql.DB
+}
+
+func NewPostgresPurchaseOrderStore(db *sql.DB) *PostgresPurchaseOrderStore {
+	return &PostgresPurchaseOrderStore{db: db}
+}
+
+type PurchaseOrderStore interface {
+	CreatePurchaseOrder(order *PurchaseOrder) (*PurchaseOrder, error)
+	GetPurchaseOrderByID(id uuid.UUID) (*PurchaseOrder, error)
+	UpdatePurchaseOrder(order *PurchaseOrder) (*PurchaseOrder, error)
+	GetPurchaseOrdersByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*PurchaseOrder], error)
+	CountPurchaseOrdersByOrganization(status string, organizationID uuid.UUID) (int, error)
+	SendPurchaseOrder(id uuid.UUID) (*PurchaseOrder, error)
+	CancelPurchaseOrder(id uuid.UUID) (*PurchaseOrder, error)
+	ReceivePurchaseOrder(id uuid.UUID, locationID uuid.UUID, receipts []PurchaseOrderReceipt, userID uuid.UUID) (*PurchaseOrder, error)
+}
+
+func (s *PostgresPurchaseOrderStore) CreatePurchaseOrder(order *PurchaseOrder) (*PurchaseOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO purchase_orders (organization_id, supplier_id, reference, status, expected_at, notes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, status, created_at, updated_at
+	`
+
+	err = tx.QueryRow(
+		query,
+		order.OrganizationID,
+		order.SupplierID,
+		order.Reference,
+		PurchaseOrderStatusDraft,
+		order.ExpectedAt,
+		order.Notes,
+		order.CreatedBy,
+	).Scan(
+		&order.ID,
+		&order.Status,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertPurchaseOrderLines(tx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (s *PostgresPurchaseOrderStore) GetPurchaseOrderByID(id uuid.UUID) (*PurchaseOrder, error) {
+	return getPurchaseOrder(s.db.QueryRow, id, false)
+}
+
+// UpdatePurchaseOrder replaces the header fields and lines of a draft order.
+func (s *PostgresPurchaseOrderStore) UpdatePurchaseOrder(order *PurchaseOrder) (*PurchaseOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := getPurchaseOrder(tx.QueryRow, order.ID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if existing.Status != PurchaseOrderStatusDraft {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	err = tx.QueryRow(`
+		UPDATE purchase_orders
+		SET supplier_id = $1, reference = $2, expected_at = $3, notes = $4, updated_at = NOW()
+		WHERE id = $5
+		RETURNING status, created_at, updated_at
+	`, order.SupplierID, order.Reference, order.ExpectedAt, order.Notes, order.ID).Scan(
+		&order.Status,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM purchase_order_lines WHERE purchase_order_id = $1`, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertPurchaseOrderLines(tx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// purchaseOrderOrder lists purchase orders newest first.
+var purchaseOrderOrder = pagination.Newest("o", func(order *PurchaseOrder) (time.Time, uuid.UUID) { return order.CreatedAt, order.ID })
+
+func (s *PostgresPurchaseOrderStore) GetPurchaseOrdersByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*PurchaseOrder], error) {
+	pageClause, args, err := pagination.Clause(params, purchaseOrderOrder, []any{organizationID, status})
+	if err != nil {
+		return nil, err
+	}
+
+	query := purchaseOrderSelect + `
+		WHERE o.organization_id = $1 AND ($2 = '' OR o.status = $2)` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*PurchaseOrder
+	for rows.Next() {
+		order, err := scanPurchaseOrder(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, purchaseOrderOrder, orders), nil
+}
+
+func (s *PostgresPurchaseOrderStore) CountPurchaseOrdersByOrganization(status string, organizationID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM purchase_orders
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2)
+	`
+
+	var count int
+	err := s.db.QueryRow(query, organizationID, status).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *PostgresPurchaseOrderStore) SendPurchaseOrder(id uuid.UUID) (*PurchaseOrder, error) {
+	return s.transition(id, PurchaseOrderStatusSent, PurchaseOrderStatusDraft)
+}
+
+func (s *PostgresPurchaseOrderStore) CancelPurchaseOrder(id uuid.UUID) (*PurchaseOrder, error) {
+	return s.transition(id, PurchaseOrderStatusCancelled, PurchaseOrderStatusDraft, PurchaseOrderStatusSent)
+}
+
+// ReceivePurchaseOrder books received quantities into stock at locationID.
+// Each receipt is recorded as a movement referencing its order line; all
+// movements from one call share a batch. The order becomes received once every
+// line is complete.
+func (s *PostgresPurchaseOrderStore) ReceivePurchaseOrder(id uuid.UUID, locationID uuid.UUID, receipts []PurchaseOrderReceipt, userID uuid.UUID) (*PurchaseOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	order, err := getPurchaseOrder(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if order == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if order.Status != PurchaseOrderStatusSent && order.Status != PurchaseOrderStatusPartiallyReceived {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	lines := make(map[uuid.UUID]*PurchaseOrderLine, len(order.Lines))
+	for i := range order.Lines {
+		lines[order.Lines[i].ID] = &order.Lines[i]
+	}
+
+	batchID := uuid.New()
+	for _, receipt := range receipts {
+		line, ok := lines[receipt.LineID]
+		if !ok {
+			return nil, ErrUnknownOrderLine
+		}
+
+		if line.QuantityReceived+receipt.Quantity > line.QuantityOrdered {
+			return nil, ErrOverReceipt
+		}
+
+		unitCost := line.UnitCost
+		movement := &StockMovement{
+			ItemID:        line.ItemID,
+			LocationID:    locationID,
+			MovementType:  MovementTypeReceipt,
+			Quantity:      receipt.Quantity,
+			ReferenceType: stringPtr(ReferenceTypePurchaseOrderLine),
+			ReferenceID:   &line.ID,
+			CreatedBy:     &userID,
+			BatchID:       &batchID,
+			UnitCost:      &unitCost,
+			SerialNumbers: receipt.SerialNumbers,
+		}
+
+		if receipt.LotNumber != nil {
+			lot := &Lot{
+				ItemID:         line.ItemID,
+				LotNumber:      *receipt.LotNumber,
+				ManufacturedAt: receipt.ManufacturedAt,
+				ExpiresAt:      receipt.ExpiresAt,
+			}
+
+			err := upsertLot(tx.QueryRow, lot)
+			if err != nil {
+				return nil, err
+			}
+			movement.LotID = &lot.ID
+		}
+
+		err := postMovement(tx, movement)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(`
+			UPDATE purchase_order_lines
+			SET quantity_received = quantity_received + $1
+			WHERE id = $2
+		`, receipt.Quantity, line.ID)
+		if err != nil {
+			return nil, err
+		}
+		line.QuantityReceived += receipt.Quantity
+	}
+
+	status := PurchaseOrderStatusReceived
+	for _, line := range order.Lines {
+		if line.QuantityReceived < line.QuantityOrdered {
+			status = PurchaseOrderStatusPartiallyReceived
+			break
+		}
+	}
+
+	err = tx.QueryRow(`
+		UPDATE purchase_orders
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, updated_at
+	`, status, order.ID).Scan(&order.Status, &order.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (s *PostgresPurchaseOrderStore) transition(id uuid.UUID, to string, from ...string) (*PurchaseOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	order, err := getPurchaseOrder(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if order == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if !slices.Contains(from, order.Status) {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	err = tx.QueryRow(`
+		UPDATE purchase_orders
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, updated_at
+	`, to, id).Scan(&order.Status, &order.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func insertPurchaseOrderLines(tx *sql.Tx, order *PurchaseOrder) error {
+	for i := range order.Lines {
+		line := &order.Lines[i]
+		line.PurchaseOrderID = order.ID
+		line.QuantityReceived = 0
+
+		err := tx.QueryRow(`
+			INSERT INTO purchase_order_lines (purchase_order_id, item_id, quantity_ordered, unit_cost)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, line.PurchaseOrderID, line.ItemID, line.QuantityOrdered, line.UnitCost).Scan(&line.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const purchaseOrderSelect = `
+	SELECT o.id, o.organization_id, o.supplier_id, o.reference, o.status, o.expected_at, o.notes, o.created_by, o.created_at, o.updated_at,
+		COALESCE((
+			SELECT JSON_AGG(
+				JSON_BUILD_OBJECT(
+					'id', l.id,
+					'purchase_order_id', l.purchase_order_id,
+					'item_id', l.item_id,
+					'quantity_ordered', l.quantity_ordered,
+					'quantity_received', l.quantity_received,
+					'unit_cost', l.unit_cost
+				) ORDER BY l.id
+			)
+			FROM purchase_order_lines l
+			WHERE l.purchase_order_id = o.id
+		), '[]') AS lines
+	FROM purchase_orders o
+`
+
+func getPurchaseOrder(queryRow func(query string, args ...any) *sql.Row, id uuid.UUID, forUpdate bool) (*PurchaseOrder, error) {
+	query := purchaseOrderSelect + `
+		WHERE o.id = $1
+	`
+	if forUpdate {
+		query += " FOR UPDATE OF o"
+	}
+
+	order, err := scanPurchaseOrder(queryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func scanPurchaseOrder(scan func(dest ...any) error) (*PurchaseOrder, error) {
+	order := &PurchaseOrder{}
+	var linesJSON []byte
+	err := scan(
+		&order.ID,
+		&order.OrganizationID,
+		&order.SupplierID,
+		&order.Reference,
+		&order.Status,
+		&order.ExpectedAt,
+		&order.Notes,
+		&order.CreatedBy,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+		&linesJSON,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(linesJSON, &order.Lines); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
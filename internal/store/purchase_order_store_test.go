@@ -0,0 +1,61 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceivePurchaseOrder(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	user := seedUser(t, db, item.OrganizationID)
+
+	supplier, err := NewPostgresSupplierStore(db).CreateSupplier(&Supplier{OrganizationID: item.OrganizationID, Name: "Ledger Supplies", IsActive: true})
+	require.NoError(t, err)
+
+	orders := NewPostgresPurchaseOrderStore(db)
+	order, err := orders.CreatePurchaseOrder(&PurchaseOrder{
+		OrganizationID: item.OrganizationID,
+		SupplierID:     supplier.ID,
+		Lines:          []PurchaseOrderLine{{ItemID: item.ID, QuantityOrdered: 5, UnitCost: 70}},
+	})
+	require.NoError(t, err)
+	lineID := order.Lines[0].ID
+
+	receive := func(receipts ...PurchaseOrderReceipt) (*PurchaseOrder, error) {
+		return orders.ReceivePurchaseOrder(order.ID, location.ID, receipts, user.ID)
+	}
+
+	_, err = receive(PurchaseOrderReceipt{LineID: lineID, Quantity: 1})
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+	_, err = orders.SendPurchaseOrder(order.ID)
+	require.NoError(t, err)
+
+	order, err = receive(PurchaseOrderReceipt{LineID: lineID, Quantity: 3})
+	require.NoError(t, err)
+	assert.Equal(t, PurchaseOrderStatusPartiallyReceived, order.Status)
+
+	// Receipts are booked together or not at all.
+	_, err = receive(PurchaseOrderReceipt{LineID: lineID, Quantity: 1}, PurchaseOrderReceipt{LineID: lineID, Quantity: 2})
+	assert.ErrorIs(t, err, ErrOverReceipt)
+
+	physical, _ := readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 13, physical)
+
+	lotNumber := "LOT-1"
+	order, err = receive(PurchaseOrderReceipt{LineID: lineID, Quantity: 2, LotNumber: &lotNumber})
+	require.NoError(t, err)
+	assert.Equal(t, PurchaseOrderStatusReceived, order.Status)
+	assert.Equal(t, 5, order.Lines[0].QuantityReceived)
+
+	physical, _ = readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 15, physical)
+
+	_, err = orders.CancelPurchaseOrder(order.ID)
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+}
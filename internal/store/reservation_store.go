@@ -0,0 +1,345 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"kabancount/internal/pagination"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ReservationStatusActive    = "active"
+	ReservationStatusReleased  = "released"
+	ReservationStatusCommitted = "committed"
+	ReservationStatusExpired   = "expired"
+)
+
+var ErrReservationExpired = errors.New("reservation has expired")
+
+type Reservation struct {
+	ID             uuid.UUID  `json:"id"`
+	OrganizationID uuid.UUID  `json:"organization_id"`
+	ItemID         uuid.UUID  `json:"item_id"`
+	LocationID     uuid.UUID  `json:"location_id"`
+	Quantity       int        `json:"quantity"`
+	Status         string     `json:"status"`
+	ReferenceType  *string    `json:"reference_type"`
+	ReferenceID    *uuid.UUID `json:"reference_id"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CreatedBy      *uuid.UUID `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type PostgresReservationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresReservationStore(db *sql.DB) *PostgresReservationStore {
+	return &PostgresReservationStore{db: db}
+}
+
+type ReservationStore interface {
+	CreateReservation(reservation *Reservation) (*Reservation, error)
+	GetReservationByID(id uuid.UUID) (*Reservation, error)
+	GetReservationsByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Reservation], error)
+	CountReservationsByOrganization(status string, organizationID uuid.UUID) (int, error)
+	ReleaseReservation(id uuid.UUID, userID uuid.UUID) (*Reservation, error)
+	CommitReservation(id uuid.UUID, serialNumbers []string, userID uuid.UUID) (*Reservation, error)
+	ExpireReservations(now time.Time) (int, error)
+}
+
+func (s *PostgresReservationStore) CreateReservation(reservation *Reservation) (*Reservation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = createReservation(tx, reservation)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+func (s *PostgresReservationStore) GetReservationByID(id uuid.UUID) (*Reservation, error) {
+	return getReservation(s.db.QueryRow, id, false)
+}
+
+// reservationOrder lists reservations newest first.
+var reservationOrder = pagination.Newest("reservations", func(reservation *Reservation) (time.Time, uuid.UUID) { return reservation.CreatedAt, reservation.ID })
+
+func (s *PostgresReservationStore) GetReservationsByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Reservation], error) {
+	pageClause, args, err := pagination.Clause(params, reservationOrder, []any{organizationID, status})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, organization_id, item_id, location_id, quantity, status, reference_type, reference_id, expires_at, created_by, created_at, updated_at
+		FROM reservations
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2)` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reservations []*Reservation
+	for rows.Next() {
+		reservation, err := scanReservation(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, reservationOrder, reservations), nil
+}
+
+func (s *PostgresReservationStore) CountReservationsByOrganization(status string, organizationID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM reservations
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2)
+	`
+
+	var count int
+	err := s.db.QueryRow(query, organizationID, status).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *PostgresReservationStore) ReleaseReservation(id uuid.UUID, userID uuid.UUID) (*Reservation, error) {
+	return s.settle(id, ReservationStatusReleased, nil, &userID)
+}
+
+// CommitReservation consumes the reserved stock. serialNumbers names the units
+// taken when the item is serialized.
+func (s *PostgresReservationStore) CommitReservation(id uuid.UUID, serialNumbers []string, userID uuid.UUID) (*Reservation, error) {
+	return s.settle(id, ReservationStatusCommitted, serialNumbers, &userID)
+}
+
+// ExpireReservations releases every active reservation whose expiry has
+// passed. Rows locked by a concurrent release or commit are skipped and picked
+// up on the next sweep.
+func (s *PostgresReservationStore) ExpireReservations(now time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, organization_id, item_id, location_id, quantity, status, reference_type, reference_id, expires_at, created_by, created_at, updated_at
+		FROM reservations
+		WHERE status = $1 AND expires_at <= $2
+		ORDER BY expires_at
+		FOR UPDATE SKIP LOCKED
+	`, ReservationStatusActive, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []*Reservation
+	for rows.Next() {
+		reservation, err := scanReservation(rows.Scan)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, reservation)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, reservation := range expired {
+		err := settleReservation(tx, reservation, ReservationStatusExpired, nil, nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(expired), nil
+}
+
+func (s *PostgresReservationStore) settle(id uuid.UUID, status string, serialNumbers []string, userID *uuid.UUID) (*Reservation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	reservation, err := getReservation(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if reservation == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	// A reservation past its expiry is left for the sweeper even when it has
+	// not run yet.
+	if reservation.Status == ReservationStatusActive && !reservation.ExpiresAt.After(time.Now()) {
+		return nil, ErrReservationExpired
+	}
+
+	err = settleReservation(tx, reservation, status, serialNumbers, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// createReservation inserts reservation and moves its quantity from available
+// to reserved at the reservation's location.
+func createReservation(tx *sql.Tx, reservation *Reservation) error {
+	query := `
+		INSERT INTO reservations (organization_id, item_id, location_id, quantity, status, reference_type, reference_id, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, status, created_at, updated_at
+	`
+
+	err := tx.QueryRow(
+		query,
+		reservation.OrganizationID,
+		reservation.ItemID,
+		reservation.LocationID,
+		reservation.Quantity,
+		ReservationStatusActive,
+		reservation.ReferenceType,
+		reservation.ReferenceID,
+		reservation.ExpiresAt,
+		reservation.CreatedBy,
+	).Scan(
+		&reservation.ID,
+		&reservation.Status,
+		&reservation.CreatedAt,
+		&reservation.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return postMovement(tx, &StockMovement{
+		ItemID:        reservation.ItemID,
+		LocationID:    reservation.LocationID,
+		MovementType:  MovementTypeReserve,
+		Quantity:      reservation.Quantity,
+		ReferenceType: stringPtr(ReferenceTypeReservation),
+		ReferenceID:   &reservation.ID,
+		CreatedBy:     reservation.CreatedBy,
+	})
+}
+
+// settleReservation closes an active reservation. Committing consumes the
+// reserved stock, taking the serial numbers named; releasing or expiring
+// hands it back to available.
+func settleReservation(tx *sql.Tx, reservation *Reservation, status string, serialNumbers []string, userID *uuid.UUID) error {
+	if reservation.Status != ReservationStatusActive {
+		return ErrInvalidStatusTransition
+	}
+
+	movementType := MovementTypeRelease
+	if status == ReservationStatusCommitted {
+		movementType = MovementTypeCommit
+	}
+
+	err := postMovement(tx, &StockMovement{
+		ItemID:        reservation.ItemID,
+		LocationID:    reservation.LocationID,
+		MovementType:  movementType,
+		Quantity:      -reservation.Quantity,
+		ReferenceType: stringPtr(ReferenceTypeReservation),
+		ReferenceID:   &reservation.ID,
+		Reason:        stringPtr("reservation " + status),
+		CreatedBy:     userID,
+		SerialNumbers: serialNumbers,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.QueryRow(`
+		UPDATE reservations
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, updated_at
+	`, status, reservation.ID).Scan(&reservation.Status, &reservation.UpdatedAt)
+}
+
+func getReservation(queryRow func(query string, args ...any) *sql.Row, id uuid.UUID, forUpdate bool) (*Reservation, error) {
+	query := `
+		SELECT id, organization_id, item_id, location_id, quantity, status, reference_type, reference_id, expires_at, created_by, created_at, updated_at
+		FROM reservations
+		WHERE id = $1
+	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	reservation, err := scanReservation(queryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+func scanReservation(scan func(dest ...any) error) (*Reservation, error) {
+	reservation := &Reservation{}
+	err := scan(
+		&reservation.ID,
+		&reservation.OrganizationID,
+		&reservation.ItemID,
+		&reservation.LocationID,
+		&reservation.Quantity,
+		&reservation.Status,
+		&reservation.ReferenceType,
+		&reservation.ReferenceID,
+		&reservation.ExpiresAt,
+		&reservation.CreatedBy,
+		&reservation.CreatedAt,
+		&reservation.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return reservation, nil
+}
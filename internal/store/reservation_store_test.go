@@ -0,0 +1,78 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservations(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	user := seedUser(t, db, item.OrganizationID)
+	reservations := NewPostgresReservationStore(db)
+
+	reserve := func(quantity int, expiresAt time.Time) (*Reservation, error) {
+		return reservations.CreateReservation(&Reservation{
+			OrganizationID: item.OrganizationID,
+			ItemID:         item.ID,
+			LocationID:     location.ID,
+			Quantity:       quantity,
+			ExpiresAt:      expiresAt,
+		})
+	}
+
+	committed, err := reserve(4, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	physical, reserved := readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 10, physical)
+	assert.Equal(t, 4, reserved)
+
+	_, err = reserve(7, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+
+	released, err := reserve(3, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	committed, err = reservations.CommitReservation(committed.ID, nil, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ReservationStatusCommitted, committed.Status)
+
+	physical, reserved = readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 6, physical)
+	assert.Equal(t, 3, reserved)
+
+	_, err = reservations.ReleaseReservation(committed.ID, user.ID)
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+	_, err = reservations.ReleaseReservation(released.ID, user.ID)
+	require.NoError(t, err)
+
+	physical, reserved = readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 6, physical)
+	assert.Equal(t, 0, reserved)
+
+	// An expired reservation cannot be settled before the sweeper releases it.
+	expired, err := reserve(2, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+
+	_, err = reservations.CommitReservation(expired.ID, nil, user.ID)
+	assert.ErrorIs(t, err, ErrReservationExpired)
+
+	count, err := reservations.ExpireReservations(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	expired, err = reservations.GetReservationByID(expired.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ReservationStatusExpired, expired.Status)
+
+	physical, reserved = readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 6, physical)
+	assert.Equal(t, 0, reserved)
+}
@@ -0,0 +1,489 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"kabancount/internal/pagination"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SalesOrderStatusDraft     = "draft"
+	SalesOrderStatusAllocated = "allocated"
+	SalesOrderStatusPicked    = "picked"
+	SalesOrderStatusPacked    = "packed"
+	SalesOrderStatusShipped   = "shipped"
+	SalesOrderStatusCancelled = "cancelled"
+)
+
+type SalesOrder struct {
+	ID             uuid.UUID        `json:"id"`
+	OrganizationID uuid.UUID        `json:"organization_id"`
+	CustomerName   string           `json:"customer_name"`
+	Reference      *string          `json:"reference"`
+	Status         string           `json:"status"`
+	Notes          *string          `json:"notes"`
+	TrackingNumber *string          `json:"tracking_number"`
+	CreatedBy      *uuid.UUID       `json:"created_by"`
+	ShippedAt      *time.Time       `json:"shipped_at"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+	Lines          []SalesOrderLine `json:"lines"`
+}
+
+type SalesOrderLine struct {
+	ID           uuid.UUID `json:"id"`
+	SalesOrderID uuid.UUID `json:"sales_order_id"`
+	ItemID       uuid.UUID `json:"item_id"`
+	LocationID   uuid.UUID `json:"location_id"`
+	Quantity     int       `json:"quantity"`
+	UnitPrice    int       `json:"unit_price"`
+}
+
+type PostgresSalesOrderStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSalesOrderStore(db *sql.DB) *PostgresSalesOrderStore {
+	return &PostgresSalesOrderStore{db: db}
+}
+
+type SalesOrderStore interface {
+	CreateSalesOrder(order *SalesOrder) (*SalesOrder, error)
+	GetSalesOrderByID(id uuid.UUID) (*SalesOrder, error)
+	UpdateSalesOrder(order *SalesOrder) (*SalesOrder, error)
+	GetSalesOrdersByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*SalesOrder], error)
+	CountSalesOrdersByOrganization(status string, organizationID uuid.UUID) (int, error)
+	AllocateSalesOrder(id uuid.UUID, userID uuid.UUID) (*SalesOrder, error)
+	PickSalesOrder(id uuid.UUID, userID uuid.UUID) (*SalesOrder, error)
+	PackSalesOrder(id uuid.UUID, userID uuid.UUID) (*SalesOrder, error)
+	ShipSalesOrder(id uuid.UUID, trackingNumber *string, serialNumbers map[uuid.UUID][]string, userID uuid.UUID) (*SalesOrder, error)
+	CancelSalesOrder(id uuid.UUID, userID uuid.UUID) (*SalesOrder, error)
+}
+
+func (s *PostgresSalesOrderStore) CreateSalesOrder(order *SalesOrder) (*SalesOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO sales_orders (organization_id, customer_name, reference, status, notes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, status, created_at, updated_at
+	`
+
+	err = tx.QueryRow(
+		query,
+		order.OrganizationID,
+		order.CustomerName,
+		order.Reference,
+		SalesOrderStatusDraft,
+		order.Notes,
+		order.CreatedBy,
+	).Scan(
+		&order.ID,
+		&order.Status,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertSalesOrderLines(tx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func (s *PostgresSalesOrderStore) GetSalesOrderByID(id uuid.UUID) (*SalesOrder, error) {
+	return getSalesOrder(s.db.QueryRow, id, false)
+}
+
+// UpdateSalesOrder replaces the header fields and lines of a draft order.
+func (s *PostgresSalesOrderStore) UpdateSalesOrder(order *SalesOrder) (*SalesOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := getSalesOrder(tx.QueryRow, order.ID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if existing.Status != SalesOrderStatusDraft {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	err = tx.QueryRow(`
+		UPDATE sales_orders
+		SET customer_name = $1, reference = $2, notes = $3, updated_at = NOW()
+		WHERE id = $4
+		RETURNING status, created_at, updated_at
+	`, order.CustomerName, order.Reference, order.Notes, order.ID).Scan(
+		&order.Status,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`DELETE FROM sales_order_lines WHERE sales_order_id = $1`, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertSalesOrderLines(tx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// salesOrderOrder lists sales orders newest first.
+var salesOrderOrder = pagination.Newest("o", func(order *SalesOrder) (time.Time, uuid.UUID) { return order.CreatedAt, order.ID })
+
+func (s *PostgresSalesOrderStore) GetSalesOrdersByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*SalesOrder], error) {
+	pageClause, args, err := pagination.Clause(params, salesOrderOrder, []any{organizationID, status})
+	if err != nil {
+		return nil, err
+	}
+
+	query := salesOrderSelect + `
+		WHERE o.organization_id = $1 AND ($2 = '' OR o.status = $2)` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*SalesOrder
+	for rows.Next() {
+		order, err := scanSalesOrder(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, salesOrderOrder, orders), nil
+}
+
+func (s *PostgresSalesOrderStore) CountSalesOrdersByOrganization(status string, organizationID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM sales_orders
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2)
+	`
+
+	var count int
+	err := s.db.QueryRow(query, organizationID, status).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// AllocateSalesOrder reserves every line at its location. Allocation is all or
+// nothing: a single short line fails the whole order with ErrInsufficientStock.
+func (s *PostgresSalesOrderStore) AllocateSalesOrder(id uuid.UUID, userID uuid.UUID) (*SalesOrder, error) {
+	return s.transition(id, SalesOrderStatusAllocated, MovementTypeReserve, userID, SalesOrderStatusDraft)
+}
+
+func (s *PostgresSalesOrderStore) PickSalesOrder(id uuid.UUID, userID uuid.UUID) (*SalesOrder, error) {
+	return s.transition(id, SalesOrderStatusPicked, "", userID, SalesOrderStatusAllocated)
+}
+
+func (s *PostgresSalesOrderStore) PackSalesOrder(id uuid.UUID, userID uuid.UUID) (*SalesOrder, error) {
+	return s.transition(id, SalesOrderStatusPacked, "", userID, SalesOrderStatusPicked)
+}
+
+// ShipSalesOrder confirms shipment of a packed order, consuming the allocated
+// stock so that both physical and reserved quantities drop. serialNumbers
+// names the units shipped on each line of a serialized item, keyed by line ID.
+func (s *PostgresSalesOrderStore) ShipSalesOrder(id uuid.UUID, trackingNumber *string, serialNumbers map[uuid.UUID][]string, userID uuid.UUID) (*SalesOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	order, err := getSalesOrder(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if order == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if order.Status != SalesOrderStatusPacked {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	err = postSalesOrderMovements(tx, order, MovementTypeCommit, serialNumbers, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		UPDATE sales_orders
+		SET status = $1, tracking_number = $2, shipped_at = NOW(), updated_at = NOW()
+		WHERE id = $3
+		RETURNING status, tracking_number, shipped_at, updated_at
+	`, SalesOrderStatusShipped, trackingNumber, order.ID).Scan(
+		&order.Status,
+		&order.TrackingNumber,
+		&order.ShippedAt,
+		&order.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// CancelSalesOrder cancels an order that has not shipped, releasing any
+// allocated stock back to available.
+func (s *PostgresSalesOrderStore) CancelSalesOrder(id uuid.UUID, userID uuid.UUID) (*SalesOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	order, err := getSalesOrder(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if order == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	switch order.Status {
+	case SalesOrderStatusDraft:
+	case SalesOrderStatusAllocated, SalesOrderStatusPicked, SalesOrderStatusPacked:
+		err = postSalesOrderMovements(tx, order, MovementTypeRelease, nil, userID)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidStatusTransition
+	}
+
+	err = updateSalesOrderStatus(tx, order, SalesOrderStatusCancelled)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// transition moves an order from one of the from statuses to to, posting
+// movementType for every line first when it is set.
+func (s *PostgresSalesOrderStore) transition(id uuid.UUID, to string, movementType string, userID uuid.UUID, from ...string) (*SalesOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	order, err := getSalesOrder(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if order == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if !slices.Contains(from, order.Status) {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	if movementType != "" {
+		err = postSalesOrderMovements(tx, order, movementType, nil, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = updateSalesOrderStatus(tx, order, to)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// postSalesOrderMovements posts one movement per order line, all sharing a
+// batch. Reserve carries the line quantity; release and commit carry its
+// negation to unwind the reservation.
+func postSalesOrderMovements(tx *sql.Tx, order *SalesOrder, movementType string, serialNumbers map[uuid.UUID][]string, userID uuid.UUID) error {
+	batchID := uuid.New()
+	for _, line := range order.Lines {
+		quantity := line.Quantity
+		if movementType != MovementTypeReserve {
+			quantity = -quantity
+		}
+
+		err := postMovement(tx, &StockMovement{
+			ItemID:        line.ItemID,
+			LocationID:    line.LocationID,
+			MovementType:  movementType,
+			Quantity:      quantity,
+			ReferenceType: stringPtr(ReferenceTypeSalesOrder),
+			ReferenceID:   &order.ID,
+			CreatedBy:     &userID,
+			BatchID:       &batchID,
+			SerialNumbers: serialNumbers[line.ID],
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func updateSalesOrderStatus(tx *sql.Tx, order *SalesOrder, status string) error {
+	return tx.QueryRow(`
+		UPDATE sales_orders
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, updated_at
+	`, status, order.ID).Scan(&order.Status, &order.UpdatedAt)
+}
+
+func insertSalesOrderLines(tx *sql.Tx, order *SalesOrder) error {
+	for i := range order.Lines {
+		line := &order.Lines[i]
+		line.SalesOrderID = order.ID
+
+		err := tx.QueryRow(`
+			INSERT INTO sales_order_lines (sales_order_id, item_id, location_id, quantity, unit_price)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, line.SalesOrderID, line.ItemID, line.LocationID, line.Quantity, line.UnitPrice).Scan(&line.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const salesOrderSelect = `
+	SELECT o.id, o.organization_id, o.customer_name, o.reference, o.status, o.notes, o.tracking_number, o.created_by, o.shipped_at, o.created_at, o.updated_at,
+		COALESCE((
+			SELECT JSON_AGG(
+				JSON_BUILD_OBJECT(
+					'id', l.id,
+					'sales_order_id', l.sales_order_id,
+					'item_id', l.item_id,
+					'location_id', l.location_id,
+					'quantity', l.quantity,
+					'unit_price', l.unit_price
+				) ORDER BY l.id
+			)
+			FROM sales_order_lines l
+			WHERE l.sales_order_id = o.id
+		), '[]') AS lines
+	FROM sales_orders o
+`
+
+func getSalesOrder(queryRow func(query string, args ...any) *sql.Row, id uuid.UUID, forUpdate bool) (*SalesOrder, error) {
+	query := salesOrderSelect + `
+		WHERE o.id = $1
+	`
+	if forUpdate {
+		query += " FOR UPDATE OF o"
+	}
+
+	order, err := scanSalesOrder(queryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+func scanSalesOrder(scan func(dest ...any) error) (*SalesOrder, error) {
+	order := &SalesOrder{}
+	var linesJSON []byte
+	err := scan(
+		&order.ID,
+		&order.OrganizationID,
+		&order.CustomerName,
+		&order.Reference,
+		&order.Status,
+		&order.Notes,
+		&order.TrackingNumber,
+		&order.CreatedBy,
+		&order.ShippedAt,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+		&linesJSON,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(linesJSON, &order.Lines); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSalesOrderFulfilment(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	user := seedUser(t, db, item.OrganizationID)
+	orders := NewPostgresSalesOrderStore(db)
+
+	create := func(quantity int) *SalesOrder {
+		order, err := orders.CreateSalesOrder(&SalesOrder{
+			OrganizationID: item.OrganizationID,
+			CustomerName:   "Ledger Customer",
+			Lines:          []SalesOrderLine{{ItemID: item.ID, LocationID: location.ID, Quantity: quantity, UnitPrice: 100}},
+		})
+		require.NoError(t, err)
+		return order
+	}
+
+	shipped := create(4)
+	_, err := orders.AllocateSalesOrder(shipped.ID, user.ID)
+	require.NoError(t, err)
+
+	physical, reserved := readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 10, physical)
+	assert.Equal(t, 4, reserved)
+
+	_, err = orders.AllocateSalesOrder(create(7).ID, user.ID)
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+
+	cancelled := create(3)
+	_, err = orders.AllocateSalesOrder(cancelled.ID, user.ID)
+	require.NoError(t, err)
+
+	_, err = orders.CancelSalesOrder(cancelled.ID, user.ID)
+	require.NoError(t, err)
+
+	_, err = orders.ShipSalesOrder(shipped.ID, nil, nil, user.ID)
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+	_, err = orders.PickSalesOrder(shipped.ID, user.ID)
+	require.NoError(t, err)
+	_, err = orders.PackSalesOrder(shipped.ID, user.ID)
+	require.NoError(t, err)
+
+	trackingNumber := "TRACK-1"
+	shipped, err = orders.ShipSalesOrder(shipped.ID, &trackingNumber, nil, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, SalesOrderStatusShipped, shipped.Status)
+	assert.NotNil(t, shipped.ShippedAt)
+
+	physical, reserved = readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 6, physical)
+	assert.Equal(t, 0, reserved)
+
+	_, err = orders.CancelSalesOrder(shipped.ID, user.ID)
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+}
@@ -0,0 +1,356 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kabancount/internal/pagination"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SerialStatusInStock   = "in_stock"
+	SerialStatusInTransit = "in_transit"
+	SerialStatusIssued    = "issued"
+)
+
+var (
+	ErrSerialMismatch    = errors.New("serial numbers do not match the quantity moved")
+	ErrSerialUnavailable = errors.New("serial number is not available")
+)
+
+// serialsRequired lists the movement types that must name a serial number for
+// every unit of a serialized item. Other movement types may name them and are
+// validated when they do.
+var serialsRequired = map[string]bool{
+	MovementTypeReceipt:     true,
+	MovementTypeIssue:       true,
+	MovementTypeAdjustment:  true,
+	MovementTypeTransferOut: true,
+	MovementTypeTransferIn:  true,
+	MovementTypeCommit:      true,
+	MovementTypeConsume:     true,
+	MovementTypeProduce:     true,
+}
+
+type SerialNumber struct {
+	ID           uuid.UUID        `json:"id"`
+	ItemID       uuid.UUID        `json:"item_id"`
+	SerialNumber string           `json:"serial_number"`
+	LocationID   *uuid.UUID       `json:"location_id"`
+	LotID        *uuid.UUID       `json:"lot_id"`
+	Status       string           `json:"status"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+	History      []*StockMovement `json:"history,omitempty"`
+}
+
+type PostgresSerialNumberStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSerialNumberStore(db *sql.DB) *PostgresSerialNumberStore {
+	return &PostgresSerialNumberStore{db: db}
+}
+
+type SerialNumberStore interface {
+	GetSerialNumber(itemID uuid.UUID, serialNumber string) (*SerialNumber, error)
+	GetSerialNumbersByItem(itemID uuid.UUID, status string, params pagination.Params) (*pagination.Page[*SerialNumber], error)
+	CountSerialNumbersByItem(itemID uuid.UUID, status string) (int, error)
+}
+
+// GetSerialNumber returns one serial number with every stock movement that
+// named it, oldest first.
+func (s *PostgresSerialNumberStore) GetSerialNumber(itemID uuid.UUID, serialNumber string) (*SerialNumber, error) {
+	serial := &SerialNumber{}
+	err := s.db.QueryRow(`
+		SELECT id, item_id, serial_number, location_id, lot_id, status, created_at, updated_at
+		FROM serial_numbers
+		WHERE item_id = $1 AND serial_number = $2
+	`, itemID, serialNumber).Scan(
+		&serial.ID,
+		&serial.ItemID,
+		&serial.SerialNumber,
+		&serial.LocationID,
+		&serial.LotID,
+		&serial.Status,
+		&serial.CreatedAt,
+		&serial.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT m.id, m.item_id, m.location_id, m.movement_type, m.quantity, m.reference_type, m.reference_id, m.reason, m.created_at, m.created_by, m.batch_id, m.unit_cost, m.total_cost, m.lot_id, m.updated_at
+		FROM stock_movement_serials ms
+		JOIN stock_movements m ON m.id = ms.movement_id
+		WHERE ms.serial_number_id = $1
+		ORDER BY m.created_at, m.id
+	`, serial.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	serial.History = []*StockMovement{}
+	for rows.Next() {
+		movement := &StockMovement{}
+		err := rows.Scan(
+			&movement.ID,
+			&movement.ItemID,
+			&movement.LocationID,
+			&movement.MovementType,
+			&movement.Quantity,
+			&movement.ReferenceType,
+			&movement.ReferenceID,
+			&movement.Reason,
+			&movement.CreatedAt,
+			&movement.CreatedBy,
+			&movement.BatchID,
+			&movement.UnitCost,
+			&movement.TotalCost,
+			&movement.LotID,
+			&movement.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		serial.History = append(serial.History, movement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return serial, nil
+}
+
+// serialNumberOrder lists serial numbers in order of their numbers.
+var serialNumberOrder = pagination.Order[*SerialNumber]{
+	Name:     "serial_number",
+	Column:   "serial_number",
+	Type:     "text",
+	IDColumn: "id",
+	Key:      func(serial *SerialNumber) (string, uuid.UUID) { return serial.SerialNumber, serial.ID },
+}
+
+func (s *PostgresSerialNumberStore) GetSerialNumbersByItem(itemID uuid.UUID, status string, params pagination.Params) (*pagination.Page[*SerialNumber], error) {
+	pageClause, args, err := pagination.Clause(params, serialNumberOrder, []any{itemID, status})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, item_id, serial_number, location_id, lot_id, status, created_at, updated_at
+		FROM serial_numbers
+		WHERE item_id = $1 AND ($2 = '' OR status = $2)` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var serials []*SerialNumber
+	for rows.Next() {
+		serial := &SerialNumber{}
+		err := rows.Scan(
+			&serial.ID,
+			&serial.ItemID,
+			&serial.SerialNumber,
+			&serial.LocationID,
+			&serial.LotID,
+			&serial.Status,
+			&serial.CreatedAt,
+			&serial.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		serials = append(serials, serial)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, serialNumberOrder, serials), nil
+}
+
+func (s *PostgresSerialNumberStore) CountSerialNumbersByItem(itemID uuid.UUID, status string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM serial_numbers
+		WHERE item_id = $1 AND ($2 = '' OR status = $2)
+	`
+
+	var count int
+	err := s.db.QueryRow(query, itemID, status).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// applySerialNumbers moves the serial numbers named by a posted movement and
+// links them to it. For serialized items the serial count must equal the
+// physical quantity moved; stock coming in registers each serial as in stock
+// at the location, and stock going out requires each serial to be in stock
+// there. Items that do not track serials must not name any.
+func applySerialNumbers(tx *sql.Tx, movement *StockMovement) error {
+	physicalDelta, _ := movementDeltas(movement)
+
+	var tracked bool
+	err := tx.QueryRow(`SELECT track_serials FROM items WHERE id = $1`, movement.ItemID).Scan(&tracked)
+	if err != nil {
+		return err
+	}
+
+	quantity := physicalDelta
+	if quantity < 0 {
+		quantity = -quantity
+	}
+
+	switch {
+	case !tracked || physicalDelta == 0:
+		if len(movement.SerialNumbers) > 0 {
+			return ErrSerialMismatch
+		}
+		return nil
+	case len(movement.SerialNumbers) == 0 && !serialsRequired[movement.MovementType]:
+		return nil
+	case len(movement.SerialNumbers) != quantity:
+		return ErrSerialMismatch
+	}
+
+	outboundStatus := SerialStatusIssued
+	if movement.MovementType == MovementTypeTransferOut {
+		outboundStatus = SerialStatusInTransit
+	}
+
+	seen := make(map[string]bool, len(movement.SerialNumbers))
+	for _, serialNumber := range movement.SerialNumbers {
+		if seen[serialNumber] {
+			return ErrSerialMismatch
+		}
+		seen[serialNumber] = true
+
+		var serialID uuid.UUID
+		if physicalDelta > 0 {
+			err = tx.QueryRow(`
+				INSERT INTO serial_numbers (item_id, serial_number, location_id, status, lot_id)
+				VALUES ($1, $2, $3, $4, $5)
+				ON CONFLICT (item_id, serial_number) DO UPDATE
+				SET location_id = EXCLUDED.location_id, status = EXCLUDED.status, lot_id = EXCLUDED.lot_id, updated_at = NOW()
+				WHERE serial_numbers.status <> EXCLUDED.status
+				RETURNING id
+			`, movement.ItemID, serialNumber, movement.LocationID, SerialStatusInStock, movement.LotID).Scan(&serialID)
+		} else {
+			err = tx.QueryRow(`
+				UPDATE serial_numbers
+				SET location_id = NULL, status = $1, updated_at = NOW()
+				WHERE item_id = $2 AND serial_number = $3 AND location_id = $4 AND status = $5 AND lot_id IS NOT DISTINCT FROM $6
+				RETURNING id
+			`, outboundStatus, movement.ItemID, serialNumber, movement.LocationID, SerialStatusInStock, movement.LotID).Scan(&serialID)
+		}
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %s", ErrSerialUnavailable, serialNumber)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO stock_movement_serials (movement_id, serial_number_id)
+			VALUES ($1, $2)
+		`, movement.ID, serialID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// serialLots splits an outbound movement of quantity units across the lots
+// holding the serial numbers it names at its location, in the order the
+// serial numbers are first seen. Serial numbers outside any lot form a
+// portion without a lot.
+func serialLots(tx *sql.Tx, movement *StockMovement, quantity int) ([]lotPortion, error) {
+	var tracked bool
+	err := tx.QueryRow(`SELECT track_serials FROM items WHERE id = $1`, movement.ItemID).Scan(&tracked)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tracked || len(movement.SerialNumbers) != quantity {
+		return nil, ErrSerialMismatch
+	}
+
+	var portions []lotPortion
+	index := map[uuid.UUID]int{}
+	for _, serialNumber := range movement.SerialNumbers {
+		var lotID *uuid.UUID
+		err := tx.QueryRow(`
+			SELECT lot_id
+			FROM serial_numbers
+			WHERE item_id = $1 AND serial_number = $2 AND location_id = $3 AND status = $4
+		`, movement.ItemID, serialNumber, movement.LocationID, SerialStatusInStock).Scan(&lotID)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: %s", ErrSerialUnavailable, serialNumber)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		key := uuid.Nil
+		if lotID != nil {
+			key = *lotID
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(portions)
+			index[key] = i
+			portions = append(portions, lotPortion{lotID: lotID})
+		}
+		portions[i].quantity++
+		portions[i].serials = append(portions[i].serials, serialNumber)
+	}
+
+	return portions, nil
+}
+
+// batchSerialNumbers returns the serial numbers carried by the movements of
+// movementType in a batch for itemID that drew on lotID.
+func batchSerialNumbers(tx *sql.Tx, batchID, itemID uuid.UUID, movementType string, lotID *uuid.UUID) ([]string, error) {
+	var serialsJSON []byte
+	err := tx.QueryRow(`
+		SELECT COALESCE(JSON_AGG(sn.serial_number ORDER BY sn.serial_number), '[]')
+		FROM stock_movements m
+		JOIN stock_movement_serials ms ON ms.movement_id = m.id
+		JOIN serial_numbers sn ON sn.id = ms.serial_number_id
+		WHERE m.batch_id = $1 AND m.item_id = $2 AND m.movement_type = $3 AND m.lot_id IS NOT DISTINCT FROM $4
+	`, batchID, itemID, movementType, lotID).Scan(&serialsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var serials []string
+	if err := json.Unmarshal(serialsJSON, &serials); err != nil {
+		return nil, err
+	}
+
+	return serials, nil
+}
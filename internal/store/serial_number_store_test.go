@@ -0,0 +1,172 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerialNumbers(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedSerializedItem(t, db)
+	movements := NewPostgresStockMovementStore(db)
+
+	_, err := movements.CreateMovement(&StockMovement{
+		ItemID:       item.ID,
+		LocationID:   location.ID,
+		MovementType: MovementTypeReceipt,
+		Quantity:     2,
+	})
+	assert.ErrorIs(t, err, ErrSerialMismatch)
+
+	_, err = movements.CreateMovement(&StockMovement{
+		ItemID:        item.ID,
+		LocationID:    location.ID,
+		MovementType:  MovementTypeReceipt,
+		Quantity:      2,
+		SerialNumbers: []string{"SN-1", "SN-2"},
+	})
+	require.NoError(t, err)
+
+	_, err = movements.CreateMovement(&StockMovement{
+		ItemID:        item.ID,
+		LocationID:    location.ID,
+		MovementType:  MovementTypeReceipt,
+		Quantity:      1,
+		SerialNumbers: []string{"SN-1"},
+	})
+	assert.ErrorIs(t, err, ErrSerialUnavailable)
+
+	_, err = movements.CreateMovement(&StockMovement{
+		ItemID:        item.ID,
+		LocationID:    location.ID,
+		MovementType:  MovementTypeIssue,
+		Quantity:      -1,
+		SerialNumbers: []string{"SN-1"},
+	})
+	require.NoError(t, err)
+
+	_, err = movements.CreateMovement(&StockMovement{
+		ItemID:        item.ID,
+		LocationID:    location.ID,
+		MovementType:  MovementTypeIssue,
+		Quantity:      -1,
+		SerialNumbers: []string{"SN-1"},
+	})
+	assert.ErrorIs(t, err, ErrSerialUnavailable)
+
+	serial, err := NewPostgresSerialNumberStore(db).GetSerialNumber(item.ID, "SN-1")
+	require.NoError(t, err)
+	require.NotNil(t, serial)
+	assert.Equal(t, SerialStatusIssued, serial.Status)
+	assert.Nil(t, serial.LocationID)
+	require.Len(t, serial.History, 2)
+	assert.Equal(t, MovementTypeReceipt, serial.History[0].MovementType)
+	assert.Equal(t, MovementTypeIssue, serial.History[1].MovementType)
+}
+
+func TestSerialNumbersAcrossLots(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedSerializedItem(t, db)
+	movements := NewPostgresStockMovementStore(db)
+
+	receive := func(lotNumber string, serials ...string) *Lot {
+		movement, err := movements.CreateMovement(&StockMovement{
+			ItemID:        item.ID,
+			LocationID:    location.ID,
+			MovementType:  MovementTypeReceipt,
+			Quantity:      len(serials),
+			SerialNumbers: serials,
+			Lot:           &Lot{LotNumber: lotNumber},
+		})
+		require.NoError(t, err)
+		return movement.Lot
+	}
+
+	first := receive("LOT-A", "SN-A1", "SN-A2")
+	second := receive("LOT-B", "SN-B1", "SN-B2")
+
+	// The issue is split by the lots holding the named serials, whatever
+	// their expiry order.
+	_, err := movements.CreateMovement(&StockMovement{
+		ItemID:        item.ID,
+		LocationID:    location.ID,
+		MovementType:  MovementTypeIssue,
+		Quantity:      -2,
+		SerialNumbers: []string{"SN-B1", "SN-A1"},
+	})
+	require.NoError(t, err)
+
+	serials := NewPostgresSerialNumberStore(db)
+	for serialNumber, lot := range map[string]*Lot{"SN-A1": first, "SN-B1": second} {
+		serial, err := serials.GetSerialNumber(item.ID, serialNumber)
+		require.NoError(t, err)
+		require.NotNil(t, serial)
+		require.Len(t, serial.History, 2)
+		issue := serial.History[1]
+		assert.Equal(t, MovementTypeIssue, issue.MovementType)
+		assert.Equal(t, -1, issue.Quantity)
+		require.NotNil(t, issue.LotID)
+		assert.Equal(t, lot.ID, *issue.LotID)
+	}
+
+	// A serial cannot leave under a lot it was not received into.
+	_, err = movements.CreateMovement(&StockMovement{
+		ItemID:        item.ID,
+		LocationID:    location.ID,
+		MovementType:  MovementTypeIssue,
+		Quantity:      -1,
+		SerialNumbers: []string{"SN-A2"},
+		LotID:         &second.ID,
+	})
+	assert.ErrorIs(t, err, ErrSerialUnavailable)
+
+	// Committing a reservation moves physical stock, so it names serials too.
+	reservations := NewPostgresReservationStore(db)
+	user := seedUser(t, db, item.OrganizationID)
+	reservation, err := reservations.CreateReservation(&Reservation{
+		OrganizationID: item.OrganizationID,
+		ItemID:         item.ID,
+		LocationID:     location.ID,
+		Quantity:       1,
+		ExpiresAt:      time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	_, err = reservations.CommitReservation(reservation.ID, nil, user.ID)
+	assert.ErrorIs(t, err, ErrSerialMismatch)
+
+	_, err = reservations.CommitReservation(reservation.ID, []string{"SN-A2"}, user.ID)
+	require.NoError(t, err)
+
+	physical, _ := readStockLevel(t, db, item.ID, location.ID)
+	assert.Equal(t, 1, physical)
+}
+
+// seedSerializedItem creates an item that tracks serial numbers, with no
+// stock, next to the seeded location.
+func seedSerializedItem(t *testing.T, db *sql.DB) (*Item, *Location) {
+	t.Helper()
+
+	seeded, location := seedItemAndLocation(t, db)
+	item, err := NewPostgresItemStore(db).CreateItem(&Item{
+		OrganizationID: seeded.OrganizationID,
+		CategoryID:     seeded.CategoryID,
+		Name:           "Serialized Scanner",
+		UnitPrice:      100,
+		CostPrice:      40,
+		IsActive:       true,
+		TrackSerials:   true,
+		BaseUnit:       DefaultBaseUnit,
+	})
+	require.NoError(t, err)
+
+	return item, location
+}
@@ -0,0 +1,187 @@
+package store
+
+import (
+	"database/sql"
+	"kabancount/internal/pagination"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AlertTypeLowStock  = "low_stock"
+	AlertTypeOverstock = "overstock"
+)
+
+const (
+	AlertStatusOpen     = "open"
+	AlertStatusResolved = "resolved"
+)
+
+type StockAlert struct {
+	ID             uuid.UUID  `json:"id"`
+	OrganizationID uuid.UUID  `json:"organization_id"`
+	ItemID         uuid.UUID  `json:"item_id"`
+	LocationID     uuid.UUID  `json:"location_id"`
+	AlertType      string     `json:"alert_type"`
+	Status         string     `json:"status"`
+	Quantity       int        `json:"quantity"`
+	Threshold      int        `json:"threshold"`
+	TriggeredAt    time.Time  `json:"triggered_at"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type PostgresStockAlertStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStockAlertStore(db *sql.DB) *PostgresStockAlertStore {
+	return &PostgresStockAlertStore{db: db}
+}
+
+type StockAlertStore interface {
+	EvaluateAlerts() (raised int, resolved int, err error)
+	GetAlertsByOrganization(status, alertType string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*StockAlert], error)
+	CountAlertsByOrganization(status, alertType string, organizationID uuid.UUID) (int, error)
+}
+
+// EvaluateAlerts raises an alert for every stock level that is at or below its
+// reorder level or above its max stock level, and resolves open alerts whose
+// condition no longer holds. A level with a zero threshold is not monitored,
+// nor are deleted items.
+// At most one alert per item, location and type is open at a time.
+func (s *PostgresStockAlertStore) EvaluateAlerts() (int, int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO stock_alerts (organization_id, item_id, location_id, alert_type, quantity, threshold)
+		SELECT i.organization_id, s.item_id, s.location_id, $1, s.quantity_available, s.reorder_level
+		FROM stock_levels s
+		INNER JOIN items i ON i.id = s.item_id
+		WHERE s.quantity_available <= s.reorder_level AND s.reorder_level > 0 AND i.deleted_at IS NULL
+		UNION ALL
+		SELECT i.organization_id, s.item_id, s.location_id, $2, s.quantity_physical, s.max_stock_level
+		FROM stock_levels s
+		INNER JOIN items i ON i.id = s.item_id
+		WHERE s.quantity_physical > s.max_stock_level AND s.max_stock_level > 0 AND i.deleted_at IS NULL
+		ON CONFLICT (item_id, location_id, alert_type) WHERE status = 'open' DO NOTHING
+	`, AlertTypeLowStock, AlertTypeOverstock)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	raised, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	result, err = tx.Exec(`
+		UPDATE stock_alerts a
+		SET status = $1, resolved_at = NOW(), updated_at = NOW()
+		WHERE a.status = $2 AND NOT EXISTS (
+			SELECT 1
+			FROM stock_levels s
+			JOIN items i ON i.id = s.item_id AND i.deleted_at IS NULL
+			WHERE s.item_id = a.item_id AND s.location_id = a.location_id AND (
+				(a.alert_type = $3 AND s.quantity_available <= s.reorder_level AND s.reorder_level > 0) OR
+				(a.alert_type = $4 AND s.quantity_physical > s.max_stock_level AND s.max_stock_level > 0)
+			)
+		)
+	`, AlertStatusResolved, AlertStatusOpen, AlertTypeLowStock, AlertTypeOverstock)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	resolved, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(raised), int(resolved), nil
+}
+
+// stockAlertOrder lists stock alerts most recently triggered first.
+var stockAlertOrder = pagination.Order[*StockAlert]{
+	Name:       "-triggered_at",
+	Column:     "triggered_at",
+	Type:       "timestamptz",
+	IDColumn:   "id",
+	Descending: true,
+	Key: func(alert *StockAlert) (string, uuid.UUID) {
+		return pagination.FormatTime(alert.TriggeredAt), alert.ID
+	},
+}
+
+func (s *PostgresStockAlertStore) GetAlertsByOrganization(status, alertType string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*StockAlert], error) {
+	pageClause, args, err := pagination.Clause(params, stockAlertOrder, []any{organizationID, status, alertType})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, organization_id, item_id, location_id, alert_type, status, quantity, threshold, triggered_at, resolved_at, created_at, updated_at
+		FROM stock_alerts
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2) AND ($3 = '' OR alert_type = $3)` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []*StockAlert
+	for rows.Next() {
+		alert := &StockAlert{}
+		err := rows.Scan(
+			&alert.ID,
+			&alert.OrganizationID,
+			&alert.ItemID,
+			&alert.LocationID,
+			&alert.AlertType,
+			&alert.Status,
+			&alert.Quantity,
+			&alert.Threshold,
+			&alert.TriggeredAt,
+			&alert.ResolvedAt,
+			&alert.CreatedAt,
+			&alert.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, stockAlertOrder, alerts), nil
+}
+
+func (s *PostgresStockAlertStore) CountAlertsByOrganization(status, alertType string, organizationID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM stock_alerts
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2) AND ($3 = '' OR alert_type = $3)
+	`
+
+	var count int
+	err := s.db.QueryRow(query, organizationID, status, alertType).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
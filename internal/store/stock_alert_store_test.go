@@ -0,0 +1,54 @@
+package store
+
+import (
+	"kabancount/internal/pagination"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluateAlerts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	_, err := db.Exec(`UPDATE stock_levels SET reorder_level = 5, max_stock_level = 20 WHERE item_id = $1`, item.ID)
+	require.NoError(t, err)
+
+	alerts := NewPostgresStockAlertStore(db)
+	movements := NewPostgresStockMovementStore(db)
+
+	evaluate := func(wantRaised, wantResolved int) {
+		t.Helper()
+		raised, resolved, err := alerts.EvaluateAlerts()
+		require.NoError(t, err)
+		assert.Equal(t, wantRaised, raised)
+		assert.Equal(t, wantResolved, resolved)
+	}
+
+	evaluate(0, 0)
+
+	_, err = movements.CreateMovement(&StockMovement{ItemID: item.ID, LocationID: location.ID, MovementType: MovementTypeIssue, Quantity: -6})
+	require.NoError(t, err)
+
+	// An alert stays open, and is not raised again, while the level stays low.
+	evaluate(1, 0)
+	evaluate(0, 0)
+
+	_, err = movements.CreateMovement(&StockMovement{ItemID: item.ID, LocationID: location.ID, MovementType: MovementTypeReceipt, Quantity: 20})
+	require.NoError(t, err)
+
+	evaluate(1, 1)
+
+	open, err := alerts.GetAlertsByOrganization(AlertStatusOpen, "", pagination.Params{Limit: 10}, item.OrganizationID)
+	require.NoError(t, err)
+	require.Len(t, open.Data, 1)
+	assert.Equal(t, AlertTypeOverstock, open.Data[0].AlertType)
+	assert.Equal(t, 24, open.Data[0].Quantity)
+	assert.Equal(t, 20, open.Data[0].Threshold)
+
+	resolved, err := alerts.CountAlertsByOrganization(AlertStatusResolved, AlertTypeLowStock, item.OrganizationID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, resolved)
+}
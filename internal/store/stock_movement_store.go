@@ -0,0 +1,424 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/pagination"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MovementTypeReceipt     = "receipt"
+	MovementTypeIssue       = "issue"
+	MovementTypeAdjustment  = "adjustment"
+	MovementTypeTransferOut = "transfer_out"
+	MovementTypeTransferIn  = "transfer_in"
+	MovementTypeReserve     = "reserve"
+	MovementTypeRelease     = "release"
+	MovementTypeCommit      = "commit"
+	MovementTypeConsume     = "consume"
+	MovementTypeProduce     = "produce"
+)
+
+const (
+	ReferenceTypeItem              = "item"
+	ReferenceTypeTransfer          = "transfer"
+	ReferenceTypeReservation       = "reservation"
+	ReferenceTypeCycleCount        = "cycle_count"
+	ReferenceTypePurchaseOrderLine = "purchase_order_line"
+	ReferenceTypeSalesOrder        = "sales_order"
+	ReferenceTypeWorkOrder         = "work_order"
+)
+
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+type StockMovement struct {
+	ID            uuid.UUID  `json:"id"`
+	ItemID        uuid.UUID  `json:"item_id"`
+	LocationID    uuid.UUID  `json:"location_id"`
+	MovementType  string     `json:"movement_type"`
+	Quantity      int        `json:"quantity"`
+	ReferenceType *string    `json:"reference_type"`
+	ReferenceID   *uuid.UUID `json:"reference_id"`
+	Reason        *string    `json:"reason"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CreatedBy     *uuid.UUID `json:"created_by"`
+	BatchID       *uuid.UUID `json:"batch_id"`
+	UnitCost      *int       `json:"unit_cost"`
+	TotalCost     *int       `json:"total_cost"`
+	LotID         *uuid.UUID `json:"lot_id"`
+	KitItemID     *uuid.UUID `json:"kit_item_id,omitempty"`
+	SerialNumbers []string   `json:"serial_numbers,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	// Lot, when set on a new movement, is the lot to post it into, created
+	// in the same transaction if the item has no lot with its number yet.
+	Lot *Lot `json:"lot,omitempty"`
+	// Components holds the entries a kit movement was exploded into; a kit
+	// movement has no ledger entry of its own.
+	Components []*StockMovement `json:"components,omitempty"`
+}
+
+type PostgresStockMovementStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStockMovementStore(db *sql.DB) *PostgresStockMovementStore {
+	return &PostgresStockMovementStore{db: db}
+}
+
+type StockMovementStore interface {
+	CreateMovement(movement *StockMovement) (*StockMovement, error)
+	GetMovementsByItem(itemID uuid.UUID, params pagination.Params) (*pagination.Page[*StockMovement], error)
+	CountMovementsByItem(itemID uuid.UUID) (int, error)
+}
+
+func (s *PostgresStockMovementStore) CreateMovement(movement *StockMovement) (*StockMovement, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if movement.Lot != nil {
+		movement.Lot.ItemID = movement.ItemID
+		if err := upsertLot(tx.QueryRow, movement.Lot); err != nil {
+			return nil, err
+		}
+		movement.LotID = &movement.Lot.ID
+	}
+
+	if err := postMovement(tx, movement); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return movement, nil
+}
+
+// stockMovementOrder lists stock movements newest first.
+var stockMovementOrder = pagination.Newest("m", func(movement *StockMovement) (time.Time, uuid.UUID) { return movement.CreatedAt, movement.ID })
+
+func (s *PostgresStockMovementStore) GetMovementsByItem(itemID uuid.UUID, params pagination.Params) (*pagination.Page[*StockMovement], error) {
+	pageClause, args, err := pagination.Clause(params, stockMovementOrder, []any{itemID})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT m.id, m.item_id, m.location_id, m.movement_type, m.quantity, m.reference_type, m.reference_id, m.reason, m.created_at, m.created_by, m.batch_id, m.unit_cost, m.total_cost, m.lot_id, m.kit_item_id, m.updated_at,
+			(
+				SELECT JSON_AGG(sn.serial_number ORDER BY sn.serial_number)
+				FROM stock_movement_serials ms
+				JOIN serial_numbers sn ON sn.id = ms.serial_number_id
+				WHERE ms.movement_id = m.id
+			) AS serial_numbers
+		FROM stock_movements m
+		WHERE m.item_id = $1` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []*StockMovement
+	for rows.Next() {
+		movement := &StockMovement{}
+		var serialsJSON []byte
+		err := rows.Scan(
+			&movement.ID,
+			&movement.ItemID,
+			&movement.LocationID,
+			&movement.MovementType,
+			&movement.Quantity,
+			&movement.ReferenceType,
+			&movement.ReferenceID,
+			&movement.Reason,
+			&movement.CreatedAt,
+			&movement.CreatedBy,
+			&movement.BatchID,
+			&movement.UnitCost,
+			&movement.TotalCost,
+			&movement.LotID,
+			&movement.KitItemID,
+			&movement.UpdatedAt,
+			&serialsJSON,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if serialsJSON != nil {
+			if err := json.Unmarshal(serialsJSON, &movement.SerialNumbers); err != nil {
+				return nil, err
+			}
+		}
+		movements = append(movements, movement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, stockMovementOrder, movements), nil
+}
+
+func (s *PostgresStockMovementStore) CountMovementsByItem(itemID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM stock_movements
+		WHERE item_id = $1
+	`
+
+	var count int
+	err := s.db.QueryRow(query, itemID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// movementEffects describes how the signed quantity of a movement type is
+// applied to quantity_physical and quantity_reserved. Types not listed move
+// physical stock only.
+var movementEffects = map[string]struct{ physical, reserved int }{
+	MovementTypeReserve: {physical: 0, reserved: 1},
+	MovementTypeRelease: {physical: 0, reserved: 1},
+	MovementTypeCommit:  {physical: 1, reserved: 1},
+}
+
+// postMovement writes a ledger entry and applies its quantity to the matching
+// stock_levels row inside tx, then moves the serial numbers it names. A
+// movement of a kit is posted against its components instead.
+func postMovement(tx *sql.Tx, movement *StockMovement) error {
+	components, err := getKitComponents(tx.Query, movement.ItemID)
+	if err != nil {
+		return err
+	}
+
+	if len(components) > 0 {
+		return postKitMovement(tx, movement, components)
+	}
+
+	return postLotEntries(tx, movement)
+}
+
+// postLotEntries posts movement to the ledger. Outbound movements without a
+// lot draw from the lots holding the serial numbers they name or, when they
+// name none, from the item's lots at the location earliest expiry first; when
+// that spans several lots one entry is written per lot, carrying that lot's
+// serial numbers, and movement carries the first entry's ID and the combined
+// cost.
+func postLotEntries(tx *sql.Tx, movement *StockMovement) error {
+	physicalDelta, _ := movementDeltas(movement)
+	if movement.LotID != nil || physicalDelta >= 0 {
+		return postSerialEntry(tx, movement)
+	}
+
+	var portions []lotPortion
+	var err error
+	if len(movement.SerialNumbers) > 0 {
+		portions, err = serialLots(tx, movement, -physicalDelta)
+	} else {
+		portions, err = allocateLots(tx, movement.ItemID, movement.LocationID, -physicalDelta)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(portions) == 1 {
+		movement.LotID = portions[0].lotID
+		return postSerialEntry(tx, movement)
+	}
+
+	totalCost := 0
+	for i, portion := range portions {
+		entry := *movement
+		entry.Quantity = -portion.quantity
+		entry.LotID = portion.lotID
+		entry.UnitCost = nil
+		entry.SerialNumbers = portion.serials
+
+		err := postSerialEntry(tx, &entry)
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			movement.ID = entry.ID
+			movement.CreatedAt = entry.CreatedAt
+			movement.UpdatedAt = entry.UpdatedAt
+		}
+		totalCost += *entry.TotalCost
+	}
+
+	unitCost := totalCost / movement.Quantity
+	movement.UnitCost = &unitCost
+	movement.TotalCost = &totalCost
+
+	return nil
+}
+
+// postSerialEntry writes one ledger entry and links the serial numbers it
+// names to it.
+func postSerialEntry(tx *sql.Tx, movement *StockMovement) error {
+	err := postLedgerEntry(tx, movement)
+	if err != nil {
+		return err
+	}
+
+	return applySerialNumbers(tx, movement)
+}
+
+func movementDeltas(movement *StockMovement) (physical, reserved int) {
+	effect, ok := movementEffects[movement.MovementType]
+	if !ok {
+		effect.physical = 1
+	}
+
+	return effect.physical * movement.Quantity, effect.reserved * movement.Quantity
+}
+
+// postLedgerEntry writes a single ledger entry and applies it to the matching
+// stock_levels row inside tx. The row is locked for the duration of the
+// transaction and created on first receipt. Movements that would leave less
+// physical stock than is reserved fail with ErrInsufficientStock, those that
+// would overfill the location fail with ErrCapacityExceeded, and reservations
+// and inbound stock at an archived location fail with ErrLocationArchived.
+// Movements that change physical stock are costed and adjust the row's
+// stock_value, and those with a lot adjust the lot's quantity at the location.
+func postLedgerEntry(tx *sql.Tx, movement *StockMovement) error {
+	physicalDelta, reservedDelta := movementDeltas(movement)
+
+	// Archived locations keep their stock but can no longer be allocated from
+	// or take in more, so only reservations and inbound stock are refused.
+	// Transfers check their destination when received, which lets a cancelled
+	// transfer still hand its stock back to an archived source.
+	inbound := physicalDelta > 0 && movement.MovementType != MovementTypeTransferIn
+	if movement.MovementType == MovementTypeReserve || inbound {
+		err := checkLocationActive(tx, movement.LocationID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if physicalDelta > 0 {
+		err := checkCapacity(tx, movement.LocationID, physicalDelta)
+		if err != nil {
+			return err
+		}
+	}
+
+	var physical, reserved, stockValue int
+	err := tx.QueryRow(`
+		SELECT quantity_physical, quantity_reserved, stock_value
+		FROM stock_levels
+		WHERE item_id = $1 AND location_id = $2
+		FOR UPDATE
+	`, movement.ItemID, movement.LocationID).Scan(&physical, &reserved, &stockValue)
+
+	switch {
+	case err == sql.ErrNoRows:
+		if physicalDelta < 0 || reservedDelta != 0 {
+			return ErrInsufficientStock
+		}
+
+		err = costMovement(tx, movement, physicalDelta, 0, 0)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO stock_levels (location_id, item_id, quantity_physical, quantity_available, quantity_reserved, stock_value)
+			VALUES ($1, $2, $3, $3, 0, $4)
+		`, movement.LocationID, movement.ItemID, physicalDelta, *movement.TotalCost)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		if reserved+reservedDelta < 0 || physical+physicalDelta < reserved+reservedDelta {
+			return ErrInsufficientStock
+		}
+
+		err = costMovement(tx, movement, physicalDelta, physical, stockValue)
+		if err != nil {
+			return err
+		}
+
+		valueDelta := 0
+		if movement.TotalCost != nil {
+			valueDelta = *movement.TotalCost
+		}
+
+		_, err = tx.Exec(`
+			UPDATE stock_levels
+			SET quantity_physical = quantity_physical + $1,
+				quantity_reserved = quantity_reserved + $2,
+				quantity_available = quantity_physical + $1 - (quantity_reserved + $2),
+				stock_value = stock_value + $3,
+				version = version + 1,
+				updated_at = NOW()
+			WHERE item_id = $4 AND location_id = $5
+		`, physicalDelta, reservedDelta, valueDelta, movement.ItemID, movement.LocationID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if movement.LotID != nil && physicalDelta != 0 {
+		err = adjustLotStock(tx, *movement.LotID, movement.LocationID, physicalDelta)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		INSERT INTO stock_movements (item_id, location_id, movement_type, quantity, reference_type, reference_id, reason, created_by, batch_id, unit_cost, total_cost, lot_id, kit_item_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id, created_at, updated_at
+	`
+
+	err = tx.QueryRow(
+		query,
+		movement.ItemID,
+		movement.LocationID,
+		movement.MovementType,
+		movement.Quantity,
+		movement.ReferenceType,
+		movement.ReferenceID,
+		movement.Reason,
+		movement.CreatedBy,
+		movement.BatchID,
+		movement.UnitCost,
+		movement.TotalCost,
+		movement.LotID,
+		movement.KitItemID,
+	).Scan(
+		&movement.ID,
+		&movement.CreatedAt,
+		&movement.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	if physicalDelta > 0 {
+		return createCostLayer(tx, movement, physicalDelta)
+	}
+
+	return nil
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
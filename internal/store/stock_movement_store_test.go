@@ -0,0 +1,118 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedItemAndLocation(t *testing.T, db *sql.DB) (*Item, *Location) {
+	org, err := NewPostgresOrganizationStore(db).CreateOrganization(&Organization{Name: "Ledger Org"})
+	require.NoError(t, err)
+
+	category, err := NewPostgresCategoryStore(db).CreateCategory(&Category{Name: "Ledger Category", OrganizationID: org.ID})
+	require.NoError(t, err)
+
+	location, err := NewPostgresLocationStore(db).CreateLocation(&Location{Name: "Main", OrganizationID: org.ID})
+	require.NoError(t, err)
+
+	item, err := NewPostgresItemStore(db).CreateItem(&Item{
+		OrganizationID: org.ID,
+		CategoryID:     category.ID,
+		Name:           "Ledger Item",
+		UnitPrice:      100,
+		CostPrice:      50,
+		IsActive:       true,
+		Stock:          []ItemStock{{LocationID: location.ID, QuantityAvailable: 10}},
+	})
+	require.NoError(t, err)
+
+	return item, location
+}
+
+func seedUser(t *testing.T, db *sql.DB, organizationID uuid.UUID) *User {
+	user := &User{OrganizationID: organizationID, Username: "ledger", Email: "ledger@example.com", Role: "user"}
+	require.NoError(t, user.PasswordHash.Set("password"))
+
+	user, err := NewPostgresUserStore(db).CreateUser(user)
+	require.NoError(t, err)
+
+	return user
+}
+
+// readStockLevel returns the physical and reserved quantities of an item at a
+// location, or zeros when it has never been stocked there.
+func readStockLevel(t *testing.T, db *sql.DB, itemID, locationID uuid.UUID) (physical, reserved int) {
+	err := db.QueryRow(`SELECT quantity_physical, quantity_reserved FROM stock_levels WHERE item_id = $1 AND location_id = $2`, itemID, locationID).Scan(&physical, &reserved)
+	if err != sql.ErrNoRows {
+		require.NoError(t, err)
+	}
+
+	return physical, reserved
+}
+
+func TestCreateMovement(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, location := seedItemAndLocation(t, db)
+	store := NewPostgresStockMovementStore(db)
+
+	tests := []struct {
+		name         string
+		movementType string
+		quantity     int
+		wantErr      error
+		wantPhysical int
+	}{
+		{
+			name:         "Receipt increases stock",
+			movementType: MovementTypeReceipt,
+			quantity:     5,
+			wantPhysical: 15,
+		},
+		{
+			name:         "Issue decreases stock",
+			movementType: MovementTypeIssue,
+			quantity:     -12,
+			wantPhysical: 3,
+		},
+		{
+			name:         "Issue beyond stock is rejected",
+			movementType: MovementTypeIssue,
+			quantity:     -4,
+			wantErr:      ErrInsufficientStock,
+			wantPhysical: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := store.CreateMovement(&StockMovement{
+				ItemID:       item.ID,
+				LocationID:   location.ID,
+				MovementType: tt.movementType,
+				Quantity:     tt.quantity,
+			})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var physical, available int
+			err = db.QueryRow(`SELECT quantity_physical, quantity_available FROM stock_levels WHERE item_id = $1 AND location_id = $2`, item.ID, location.ID).Scan(&physical, &available)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPhysical, physical)
+			assert.Equal(t, tt.wantPhysical, available)
+		})
+	}
+
+	// The initial stock from CreateItem is recorded as a receipt too.
+	total, err := store.CountMovementsByItem(item.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, total)
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"kabancount/internal/pagination"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrSupplierInUse = errors.New("supplier has purchase orders")
+
+type Supplier struct {
+	ID             uuid.UUID `json:"id"`
+	OrganizationID uuid.UUID `json:"organization_id"`
+	Name           string    `json:"name"`
+	ContactName    *string   `json:"contact_name"`
+	Email          *string   `json:"email"`
+	Phone          *string   `json:"phone"`
+	Address        *string   `json:"address"`
+	Notes          *string   `json:"notes"`
+	IsActive       bool      `json:"is_active"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type PostgresSupplierStore struct {
+	db *sql.DB
+}
+
+func NewPostgresSupplierStore(db *sql.DB) *PostgresSupplierStore {
+	return &PostgresSupplierStore{db: db}
+}
+
+type SupplierStore interface {
+	CreateSupplier(supplier *Supplier) (*Supplier, error)
+	GetSupplierByID(id uuid.UUID) (*Supplier, error)
+	UpdateSupplier(supplier *Supplier) (*Supplier, error)
+	DeleteSupplier(id uuid.UUID) error
+	GetSuppliersByOrganization(params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Supplier], error)
+	CountSuppliersByOrganization(organizationID uuid.UUID) (int, error)
+}
+
+func (s *PostgresSupplierStore) CreateSupplier(supplier *Supplier) (*Supplier, error) {
+	query := `
+		INSERT INTO suppliers (organization_id, name, contact_name, email, phone, address, notes, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := s.db.QueryRow(
+		query,
+		supplier.OrganizationID,
+		supplier.Name,
+		supplier.ContactName,
+		supplier.Email,
+		supplier.Phone,
+		supplier.Address,
+		supplier.Notes,
+		supplier.IsActive,
+	).Scan(
+		&supplier.ID,
+		&supplier.CreatedAt,
+		&supplier.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return supplier, nil
+}
+
+func (s *PostgresSupplierStore) GetSupplierByID(id uuid.UUID) (*Supplier, error) {
+	query := `
+		SELECT id, organization_id, name, contact_name, email, phone, address, notes, is_active, created_at, updated_at
+		FROM suppliers
+		WHERE id = $1
+	`
+
+	supplier := &Supplier{}
+	err := s.db.QueryRow(query, id).Scan(
+		&supplier.ID,
+		&supplier.OrganizationID,
+		&supplier.Name,
+		&supplier.ContactName,
+		&supplier.Email,
+		&supplier.Phone,
+		&supplier.Address,
+		&supplier.Notes,
+		&supplier.IsActive,
+		&supplier.CreatedAt,
+		&supplier.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return supplier, nil
+}
+
+func (s *PostgresSupplierStore) UpdateSupplier(supplier *Supplier) (*Supplier, error) {
+	query := `
+		UPDATE suppliers
+		SET name = $1, contact_name = $2, email = $3, phone = $4, address = $5, notes = $6, is_active = $7, updated_at = NOW()
+		WHERE id = $8
+		RETURNING updated_at
+	`
+
+	err := s.db.QueryRow(
+		query,
+		supplier.Name,
+		supplier.ContactName,
+		supplier.Email,
+		supplier.Phone,
+		supplier.Address,
+		supplier.Notes,
+		supplier.IsActive,
+		supplier.ID,
+	).Scan(&supplier.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return supplier, nil
+}
+
+func (s *PostgresSupplierStore) DeleteSupplier(id uuid.UUID) error {
+	var inUse bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM purchase_orders WHERE supplier_id = $1)`, id).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+
+	if inUse {
+		return ErrSupplierInUse
+	}
+
+	query := `
+		DELETE FROM suppliers
+		WHERE id = $1
+	`
+
+	result, err := s.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// supplierOrder lists suppliers by name.
+var supplierOrder = pagination.Order[*Supplier]{
+	Name:     "name",
+	Column:   "name",
+	Type:     "text",
+	IDColumn: "id",
+	Key:      func(supplier *Supplier) (string, uuid.UUID) { return supplier.Name, supplier.ID },
+}
+
+func (s *PostgresSupplierStore) GetSuppliersByOrganization(params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Supplier], error) {
+	pageClause, args, err := pagination.Clause(params, supplierOrder, []any{organizationID})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, organization_id, name, contact_name, email, phone, address, notes, is_active, created_at, updated_at
+		FROM suppliers
+		WHERE organization_id = $1` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suppliers []*Supplier
+	for rows.Next() {
+		supplier := &Supplier{}
+		err := rows.Scan(
+			&supplier.ID,
+			&supplier.OrganizationID,
+			&supplier.Name,
+			&supplier.ContactName,
+			&supplier.Email,
+			&supplier.Phone,
+			&supplier.Address,
+			&supplier.Notes,
+			&supplier.IsActive,
+			&supplier.CreatedAt,
+			&supplier.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, supplier)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, supplierOrder, suppliers), nil
+}
+
+func (s *PostgresSupplierStore) CountSuppliersByOrganization(organizationID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM suppliers
+		WHERE organization_id = $1
+	`
+
+	var count int
+	err := s.db.QueryRow(query, organizationID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
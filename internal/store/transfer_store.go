@@ -0,0 +1,447 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/pagination"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TransferStatusInTransit = "in_transit"
+	TransferStatusCompleted = "completed"
+	TransferStatusCancelled = "cancelled"
+)
+
+var ErrInvalidStatusTransition = errors.New("invalid status transition")
+
+type Transfer struct {
+	ID             uuid.UUID      `json:"id"`
+	OrganizationID uuid.UUID      `json:"organization_id"`
+	FromLocationID uuid.UUID      `json:"from_location_id"`
+	ToLocationID   uuid.UUID      `json:"to_location_id"`
+	Status         string         `json:"status"`
+	BatchID        uuid.UUID      `json:"batch_id"`
+	Reason         *string        `json:"reason"`
+	CreatedBy      *uuid.UUID     `json:"created_by"`
+	ShippedAt      time.Time      `json:"shipped_at"`
+	ReceivedAt     *time.Time     `json:"received_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	Lines          []TransferLine `json:"lines"`
+}
+
+type TransferLine struct {
+	ID            uuid.UUID `json:"id"`
+	TransferID    uuid.UUID `json:"transfer_id"`
+	ItemID        uuid.UUID `json:"item_id"`
+	Quantity      int       `json:"quantity"`
+	SerialNumbers []string  `json:"serial_numbers,omitempty"`
+}
+
+type PostgresTransferStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTransferStore(db *sql.DB) *PostgresTransferStore {
+	return &PostgresTransferStore{db: db}
+}
+
+type TransferStore interface {
+	CreateTransfer(transfer *Transfer) (*Transfer, error)
+	GetTransferByID(id uuid.UUID) (*Transfer, error)
+	GetTransfersByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Transfer], error)
+	CountTransfersByOrganization(status string, organizationID uuid.UUID) (int, error)
+	ReceiveTransfer(id uuid.UUID, userID uuid.UUID) (*Transfer, error)
+	CancelTransfer(id uuid.UUID, userID uuid.UUID) (*Transfer, error)
+}
+
+// CreateTransfer debits every line from the source location. When the
+// transfer is created with status completed the destination is credited in the
+// same transaction; otherwise the goods stay in transit until received.
+func (s *PostgresTransferStore) CreateTransfer(transfer *Transfer) (*Transfer, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO transfers (organization_id, from_location_id, to_location_id, status, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, batch_id, shipped_at, created_at, updated_at
+	`
+
+	err = tx.QueryRow(
+		query,
+		transfer.OrganizationID,
+		transfer.FromLocationID,
+		transfer.ToLocationID,
+		TransferStatusInTransit,
+		transfer.Reason,
+		transfer.CreatedBy,
+	).Scan(
+		&transfer.ID,
+		&transfer.BatchID,
+		&transfer.ShippedAt,
+		&transfer.CreatedAt,
+		&transfer.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range transfer.Lines {
+		line := &transfer.Lines[i]
+		line.TransferID = transfer.ID
+
+		err := tx.QueryRow(`
+			INSERT INTO transfer_lines (transfer_id, item_id, quantity)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, line.TransferID, line.ItemID, line.Quantity).Scan(&line.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = postTransferMovements(tx, transfer, transfer.FromLocationID, MovementTypeTransferOut, -1, transfer.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	completeNow := transfer.Status == TransferStatusCompleted
+	transfer.Status = TransferStatusInTransit
+
+	if completeNow {
+		err = completeTransfer(tx, transfer, transfer.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+func (s *PostgresTransferStore) GetTransferByID(id uuid.UUID) (*Transfer, error) {
+	return getTransfer(s.db.QueryRow, id, false)
+}
+
+// transferOrder lists transfers newest first.
+var transferOrder = pagination.Newest("t", func(transfer *Transfer) (time.Time, uuid.UUID) { return transfer.CreatedAt, transfer.ID })
+
+func (s *PostgresTransferStore) GetTransfersByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*Transfer], error) {
+	pageClause, args, err := pagination.Clause(params, transferOrder, []any{organizationID, status})
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT t.id, t.organization_id, t.from_location_id, t.to_location_id, t.status, t.batch_id, t.reason, t.created_by, t.shipped_at, t.received_at, t.created_at, t.updated_at,
+			COALESCE(l.lines, '[]') AS lines
+		FROM transfers t
+		LEFT JOIN (
+			SELECT transfer_id,
+				JSON_AGG(
+					JSON_BUILD_OBJECT(
+						'id', id,
+						'transfer_id', transfer_id,
+						'item_id', item_id,
+						'quantity', quantity
+					)
+				) AS lines
+			FROM transfer_lines
+			GROUP BY transfer_id
+		) l ON t.id = l.transfer_id
+		WHERE t.organization_id = $1 AND ($2 = '' OR t.status = $2)` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []*Transfer
+	for rows.Next() {
+		transfer, err := scanTransfer(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, transferOrder, transfers), nil
+}
+
+func (s *PostgresTransferStore) CountTransfersByOrganization(status string, organizationID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM transfers
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2)
+	`
+
+	var count int
+	err := s.db.QueryRow(query, organizationID, status).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *PostgresTransferStore) ReceiveTransfer(id uuid.UUID, userID uuid.UUID) (*Transfer, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, err := getTransfer(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if transfer == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if transfer.Status != TransferStatusInTransit {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	err = completeTransfer(tx, transfer, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+// CancelTransfer returns in-transit goods to the source location.
+func (s *PostgresTransferStore) CancelTransfer(id uuid.UUID, userID uuid.UUID) (*Transfer, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	transfer, err := getTransfer(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if transfer == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if transfer.Status != TransferStatusInTransit {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	err = postTransferMovements(tx, transfer, transfer.FromLocationID, MovementTypeTransferIn, 1, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		UPDATE transfers
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, updated_at
+	`, TransferStatusCancelled, transfer.ID).Scan(&transfer.Status, &transfer.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+func completeTransfer(tx *sql.Tx, transfer *Transfer, userID *uuid.UUID) error {
+	err := checkLocationActive(tx, transfer.ToLocationID)
+	if err != nil {
+		return err
+	}
+
+	err = postTransferMovements(tx, transfer, transfer.ToLocationID, MovementTypeTransferIn, 1, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.QueryRow(`
+		UPDATE transfers
+		SET status = $1, received_at = NOW(), updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, received_at, updated_at
+	`, TransferStatusCompleted, transfer.ID).Scan(&transfer.Status, &transfer.ReceivedAt, &transfer.UpdatedAt)
+}
+
+// postTransferMovements posts the transfer's lines at locationID. Stock coming
+// in keeps the lots, cost and serial numbers it left the source location with.
+func postTransferMovements(tx *sql.Tx, transfer *Transfer, locationID uuid.UUID, movementType string, sign int, userID *uuid.UUID) error {
+	for _, line := range transfer.Lines {
+		movement := StockMovement{
+			ItemID:        line.ItemID,
+			LocationID:    locationID,
+			MovementType:  movementType,
+			Quantity:      sign * line.Quantity,
+			ReferenceType: stringPtr(ReferenceTypeTransfer),
+			ReferenceID:   &transfer.ID,
+			Reason:        transfer.Reason,
+			CreatedBy:     userID,
+			BatchID:       &transfer.BatchID,
+		}
+
+		if movementType != MovementTypeTransferIn {
+			movement.SerialNumbers = line.SerialNumbers
+			err := postMovement(tx, &movement)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		rows, err := tx.Query(`
+			SELECT lot_id, -SUM(quantity), -SUM(total_cost)
+			FROM stock_movements
+			WHERE batch_id = $1 AND item_id = $2 AND movement_type = $3
+			GROUP BY lot_id
+		`, transfer.BatchID, line.ItemID, MovementTypeTransferOut)
+		if err != nil {
+			return err
+		}
+
+		var inbound []StockMovement
+		for rows.Next() {
+			var quantity int
+			var cost sql.NullInt64
+			portion := movement
+			err := rows.Scan(&portion.LotID, &quantity, &cost)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			portion.Quantity = quantity
+			if cost.Valid {
+				totalCost := int(cost.Int64)
+				portion.TotalCost = &totalCost
+			}
+			inbound = append(inbound, portion)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if len(inbound) == 0 {
+			inbound = append(inbound, movement)
+		}
+
+		for i := range inbound {
+			serials, err := batchSerialNumbers(tx, transfer.BatchID, line.ItemID, MovementTypeTransferOut, inbound[i].LotID)
+			if err != nil {
+				return err
+			}
+			inbound[i].SerialNumbers = serials
+
+			err = postMovement(tx, &inbound[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func getTransfer(queryRow func(query string, args ...any) *sql.Row, id uuid.UUID, forUpdate bool) (*Transfer, error) {
+	query := `
+		SELECT t.id, t.organization_id, t.from_location_id, t.to_location_id, t.status, t.batch_id, t.reason, t.created_by, t.shipped_at, t.received_at, t.created_at, t.updated_at,
+			COALESCE((
+				SELECT JSON_AGG(
+					JSON_BUILD_OBJECT(
+						'id', l.id,
+						'transfer_id', l.transfer_id,
+						'item_id', l.item_id,
+						'quantity', l.quantity,
+						'serial_numbers', (
+							SELECT JSON_AGG(sn.serial_number ORDER BY sn.serial_number)
+							FROM stock_movements m
+							JOIN stock_movement_serials ms ON ms.movement_id = m.id
+							JOIN serial_numbers sn ON sn.id = ms.serial_number_id
+							WHERE m.batch_id = t.batch_id AND m.item_id = l.item_id AND m.movement_type = 'transfer_out'
+						)
+					)
+				)
+				FROM transfer_lines l
+				WHERE l.transfer_id = t.id
+			), '[]') AS lines
+		FROM transfers t
+		WHERE t.id = $1
+	`
+	if forUpdate {
+		query += " FOR UPDATE OF t"
+	}
+
+	transfer, err := scanTransfer(queryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
+
+func scanTransfer(scan func(dest ...any) error) (*Transfer, error) {
+	transfer := &Transfer{}
+	var linesJSON []byte
+	err := scan(
+		&transfer.ID,
+		&transfer.OrganizationID,
+		&transfer.FromLocationID,
+		&transfer.ToLocationID,
+		&transfer.Status,
+		&transfer.BatchID,
+		&transfer.Reason,
+		&transfer.CreatedBy,
+		&transfer.ShippedAt,
+		&transfer.ReceivedAt,
+		&transfer.CreatedAt,
+		&transfer.UpdatedAt,
+		&linesJSON,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(linesJSON, &transfer.Lines); err != nil {
+		return nil, err
+	}
+
+	return transfer, nil
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransfers(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, source := seedItemAndLocation(t, db)
+	destination, err := NewPostgresLocationStore(db).CreateLocation(&Location{Name: "Overflow", OrganizationID: item.OrganizationID})
+	require.NoError(t, err)
+
+	user := seedUser(t, db, item.OrganizationID)
+	transfers := NewPostgresTransferStore(db)
+
+	// A line the source cannot cover fails the whole transfer.
+	_, err = transfers.CreateTransfer(&Transfer{
+		OrganizationID: item.OrganizationID,
+		FromLocationID: source.ID,
+		ToLocationID:   destination.ID,
+		Lines:          []TransferLine{{ItemID: item.ID, Quantity: 4}, {ItemID: item.ID, Quantity: 7}},
+	})
+	assert.ErrorIs(t, err, ErrInsufficientStock)
+
+	physical, _ := readStockLevel(t, db, item.ID, source.ID)
+	assert.Equal(t, 10, physical)
+
+	count, err := transfers.CountTransfersByOrganization("", item.OrganizationID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	inTransit, err := transfers.CreateTransfer(&Transfer{
+		OrganizationID: item.OrganizationID,
+		FromLocationID: source.ID,
+		ToLocationID:   destination.ID,
+		Lines:          []TransferLine{{ItemID: item.ID, Quantity: 4}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, TransferStatusInTransit, inTransit.Status)
+
+	physical, _ = readStockLevel(t, db, item.ID, source.ID)
+	assert.Equal(t, 6, physical)
+	physical, _ = readStockLevel(t, db, item.ID, destination.ID)
+	assert.Equal(t, 0, physical)
+
+	received, err := transfers.ReceiveTransfer(inTransit.ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TransferStatusCompleted, received.Status)
+	assert.NotNil(t, received.ReceivedAt)
+
+	physical, _ = readStockLevel(t, db, item.ID, destination.ID)
+	assert.Equal(t, 4, physical)
+
+	_, err = transfers.CancelTransfer(inTransit.ID, user.ID)
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+	cancelled, err := transfers.CreateTransfer(&Transfer{
+		OrganizationID: item.OrganizationID,
+		FromLocationID: source.ID,
+		ToLocationID:   destination.ID,
+		Lines:          []TransferLine{{ItemID: item.ID, Quantity: 6}},
+	})
+	require.NoError(t, err)
+
+	cancelled, err = transfers.CancelTransfer(cancelled.ID, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TransferStatusCancelled, cancelled.Status)
+
+	physical, _ = readStockLevel(t, db, item.ID, source.ID)
+	assert.Equal(t, 6, physical)
+}
+
+func TestTransferCarriesUnevenCost(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	// Seeds 10 units valued at the item's cost price of 50.
+	item, source := seedItemAndLocation(t, db)
+	destination, err := NewPostgresLocationStore(db).CreateLocation(&Location{Name: "Overflow", OrganizationID: item.OrganizationID})
+	require.NoError(t, err)
+
+	user := seedUser(t, db, item.OrganizationID)
+	movements := NewPostgresStockMovementStore(db)
+
+	unitCost := 81
+	_, err = movements.CreateMovement(&StockMovement{ItemID: item.ID, LocationID: source.ID, MovementType: MovementTypeReceipt, Quantity: 1, UnitCost: &unitCost})
+	require.NoError(t, err)
+
+	// Leaves one unit at 50 and one at 81, worth 131 together.
+	_, err = movements.CreateMovement(&StockMovement{ItemID: item.ID, LocationID: source.ID, MovementType: MovementTypeIssue, Quantity: -9})
+	require.NoError(t, err)
+
+	transfers := NewPostgresTransferStore(db)
+	transfer, err := transfers.CreateTransfer(&Transfer{
+		OrganizationID: item.OrganizationID,
+		FromLocationID: source.ID,
+		ToLocationID:   destination.ID,
+		Lines:          []TransferLine{{ItemID: item.ID, Quantity: 2}},
+	})
+	require.NoError(t, err)
+
+	_, err = transfers.ReceiveTransfer(transfer.ID, user.ID)
+	require.NoError(t, err)
+
+	var stockValue, layerValue int
+	err = db.QueryRow(`
+		SELECT s.stock_value, (SELECT SUM(remaining_quantity * unit_cost) FROM cost_layers c WHERE c.item_id = s.item_id AND c.location_id = s.location_id)
+		FROM stock_levels s
+		WHERE s.item_id = $1 AND s.location_id = $2
+	`, item.ID, destination.ID).Scan(&stockValue, &layerValue)
+	require.NoError(t, err)
+	assert.Equal(t, 131, stockValue)
+	assert.Equal(t, 131, layerValue)
+}
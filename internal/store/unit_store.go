@@ -0,0 +1,201 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultBaseUnit = "each"
+
+var (
+	ErrUnknownUnit        = errors.New("unit is not defined for item")
+	ErrFractionalQuantity = errors.New("quantity must be a whole number")
+	ErrUnitIsBaseUnit     = errors.New("unit name is the item's base unit")
+)
+
+// ItemUnit is an alternate unit for an item, worth Factor of the item's base
+// unit. Quantities in units that allow fractions may have a fractional part
+// as long as they still come to a whole number of base units.
+type ItemUnit struct {
+	ID              uuid.UUID `json:"id"`
+	ItemID          uuid.UUID `json:"item_id"`
+	Name            string    `json:"name"`
+	Factor          int       `json:"factor"`
+	AllowFractional bool      `json:"allow_fractional"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+type PostgresUnitStore struct {
+	db *sql.DB
+}
+
+func NewPostgresUnitStore(db *sql.DB) *PostgresUnitStore {
+	return &PostgresUnitStore{db: db}
+}
+
+type UnitStore interface {
+	CreateItemUnit(unit *ItemUnit) (*ItemUnit, error)
+	GetItemUnits(itemID uuid.UUID) ([]*ItemUnit, error)
+	DeleteItemUnit(itemID, id uuid.UUID) error
+	ConvertToBaseUnits(itemID uuid.UUID, unit string, quantity float64) (int, error)
+}
+
+// CreateItemUnit adds an alternate unit to an item. The item row is share
+// locked while its base unit is compared, so a concurrent rename of the base
+// unit cannot take the same name; a clash returns ErrUnitIsBaseUnit.
+func (s *PostgresUnitStore) CreateItemUnit(unit *ItemUnit) (*ItemUnit, error) {
+	query := `
+		INSERT INTO item_units (item_id, name, factor, allow_fractional)
+		SELECT id, $2, $3, $4
+		FROM items
+		WHERE id = $1 AND base_unit <> $2
+		FOR KEY SHARE
+		RETURNING id, created_at
+	`
+
+	err := s.db.QueryRow(
+		query,
+		unit.ItemID,
+		unit.Name,
+		unit.Factor,
+		unit.AllowFractional,
+	).Scan(
+		&unit.ID,
+		&unit.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnitIsBaseUnit
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return unit, nil
+}
+
+func (s *PostgresUnitStore) GetItemUnits(itemID uuid.UUID) ([]*ItemUnit, error) {
+	query := `
+		SELECT id, item_id, name, factor, allow_fractional, created_at
+		FROM item_units
+		WHERE item_id = $1
+		ORDER BY factor, name
+	`
+
+	rows, err := s.db.Query(query, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var units []*ItemUnit
+	for rows.Next() {
+		unit := &ItemUnit{}
+		err := rows.Scan(
+			&unit.ID,
+			&unit.ItemID,
+			&unit.Name,
+			&unit.Factor,
+			&unit.AllowFractional,
+			&unit.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return units, nil
+}
+
+func (s *PostgresUnitStore) DeleteItemUnit(itemID, id uuid.UUID) error {
+	query := `
+		DELETE FROM item_units
+		WHERE id = $1 AND item_id = $2
+	`
+
+	result, err := s.db.Exec(query, id, itemID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ConvertToBaseUnits converts quantity expressed in unit to the item's base
+// unit. An empty unit or the base unit's own name means the quantity is
+// already in base units. Unknown units return ErrUnknownUnit and quantities
+// that are fractional where the unit does not allow it, or that do not come
+// to a whole number of base units, return ErrFractionalQuantity.
+func (s *PostgresUnitStore) ConvertToBaseUnits(itemID uuid.UUID, unit string, quantity float64) (int, error) {
+	factor := 1
+	allowFractional := false
+
+	if unit != "" {
+		var baseUnit string
+		var unitFactor sql.NullInt64
+		var unitAllowFractional sql.NullBool
+		err := s.db.QueryRow(`
+			SELECT i.base_unit, u.factor, u.allow_fractional
+			FROM items i
+			LEFT JOIN item_units u ON u.item_id = i.id AND u.name = $2
+			WHERE i.id = $1
+		`, itemID, unit).Scan(&baseUnit, &unitFactor, &unitAllowFractional)
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("%w: %s", ErrUnknownUnit, unit)
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case unitFactor.Valid:
+			factor = int(unitFactor.Int64)
+			allowFractional = unitAllowFractional.Bool
+		case unit != baseUnit:
+			return 0, fmt.Errorf("%w: %s", ErrUnknownUnit, unit)
+		}
+	}
+
+	if !allowFractional && !isWhole(quantity) {
+		return 0, fmt.Errorf("%w of %s", ErrFractionalQuantity, unitLabel(unit))
+	}
+
+	base := quantity * float64(factor)
+	if !isWhole(base) {
+		return 0, fmt.Errorf("%w of base units", ErrFractionalQuantity)
+	}
+
+	return int(math.Round(base)), nil
+}
+
+func isWhole(quantity float64) bool {
+	return math.Abs(quantity-math.Round(quantity)) < 1e-6
+}
+
+func unitLabel(unit string) string {
+	if unit == "" {
+		return "base units"
+	}
+
+	return unit
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertToBaseUnits(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	item, _ := seedItemAndLocation(t, db)
+	units := NewPostgresUnitStore(db)
+
+	_, err := units.CreateItemUnit(&ItemUnit{ItemID: item.ID, Name: "case", Factor: 12})
+	require.NoError(t, err)
+	_, err = units.CreateItemUnit(&ItemUnit{ItemID: item.ID, Name: "pallet", Factor: 480, AllowFractional: true})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		unit     string
+		quantity float64
+		want     int
+		wantErr  error
+	}{
+		{name: "Base units pass through", unit: "", quantity: 7, want: 7},
+		{name: "Base unit by name", unit: DefaultBaseUnit, quantity: 7, want: 7},
+		{name: "Cases convert to base units", unit: "case", quantity: 3, want: 36},
+		{name: "Fractional pallet", unit: "pallet", quantity: 0.25, want: 120},
+		{name: "Fractional case is rejected", unit: "case", quantity: 1.5, wantErr: ErrFractionalQuantity},
+		{name: "Fractional base units are rejected", unit: "", quantity: 0.5, wantErr: ErrFractionalQuantity},
+		{name: "Pallet fraction must be whole base units", unit: "pallet", quantity: 0.001, wantErr: ErrFractionalQuantity},
+		{name: "Unknown unit", unit: "crate", quantity: 1, wantErr: ErrUnknownUnit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := units.ConvertToBaseUnits(item.ID, tt.unit, tt.quantity)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBaseUnitChanges(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	seeded, _ := seedItemAndLocation(t, db)
+	items := NewPostgresItemStore(db)
+	units := NewPostgresUnitStore(db)
+
+	_, err := units.CreateItemUnit(&ItemUnit{ItemID: seeded.ID, Name: DefaultBaseUnit, Factor: 2})
+	assert.ErrorIs(t, err, ErrUnitIsBaseUnit)
+
+	// The seeded item holds stock, so its base unit is fixed.
+	current, err := items.GetItemByID(seeded.ID)
+	require.NoError(t, err)
+	current.BaseUnit = "gram"
+	_, err = items.UpdateItem(current, "*")
+	assert.ErrorIs(t, err, ErrBaseUnitInUse)
+
+	empty, err := items.CreateItem(&Item{
+		OrganizationID: seeded.OrganizationID,
+		CategoryID:     seeded.CategoryID,
+		Name:           "Bulk Flour",
+		IsActive:       true,
+		BaseUnit:       DefaultBaseUnit,
+	})
+	require.NoError(t, err)
+
+	empty.BaseUnit = "gram"
+	empty, err = items.UpdateItem(empty, "*")
+	require.NoError(t, err)
+	assert.Equal(t, "gram", empty.BaseUnit)
+
+	_, err = units.CreateItemUnit(&ItemUnit{ItemID: empty.ID, Name: "kilogram", Factor: 1000})
+	require.NoError(t, err)
+
+	empty.BaseUnit = "kilogram"
+	_, err = items.UpdateItem(empty, "*")
+	assert.ErrorIs(t, err, ErrBaseUnitInUse)
+}
@@ -0,0 +1,265 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CostingMethodFIFO    = "fifo"
+	CostingMethodAverage = "average"
+)
+
+type ValuationReport struct {
+	AsOf          time.Time           `json:"as_of"`
+	CostingMethod string              `json:"costing_method"`
+	TotalValue    int                 `json:"total_value"`
+	Locations     []LocationValuation `json:"locations"`
+}
+
+type LocationValuation struct {
+	LocationID uuid.UUID       `json:"location_id"`
+	Quantity   int             `json:"quantity"`
+	Value      int             `json:"value"`
+	Items      []ItemValuation `json:"items"`
+}
+
+type ItemValuation struct {
+	ItemID   uuid.UUID `json:"item_id"`
+	Quantity int       `json:"quantity"`
+	Value    int       `json:"value"`
+}
+
+type PostgresValuationStore struct {
+	db *sql.DB
+}
+
+func NewPostgresValuationStore(db *sql.DB) *PostgresValuationStore {
+	return &PostgresValuationStore{db: db}
+}
+
+type ValuationStore interface {
+	GetValuation(organizationID uuid.UUID, asOf time.Time) (*ValuationReport, error)
+}
+
+// GetValuation values on-hand stock per location as it stood at asOf. Current
+// quantities and values are rolled back by every movement recorded after asOf.
+func (s *PostgresValuationStore) GetValuation(organizationID uuid.UUID, asOf time.Time) (*ValuationReport, error) {
+	report := &ValuationReport{
+		AsOf:      asOf,
+		Locations: []LocationValuation{},
+	}
+
+	err := s.db.QueryRow(`SELECT costing_method FROM organizations WHERE id = $1`, organizationID).Scan(&report.CostingMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT location_id, item_id, quantity, value
+		FROM (
+			SELECT s.location_id, s.item_id,
+				s.quantity_physical - COALESCE(SUM(CASE WHEN m.movement_type IN ($3, $4) THEN 0 ELSE m.quantity END), 0) AS quantity,
+				s.stock_value - COALESCE(SUM(m.total_cost), 0) AS value
+			FROM stock_levels s
+			JOIN items i ON i.id = s.item_id
+			LEFT JOIN stock_movements m ON m.item_id = s.item_id AND m.location_id = s.location_id AND m.created_at > $2
+			WHERE i.organization_id = $1
+			GROUP BY s.location_id, s.item_id, s.quantity_physical, s.stock_value
+		) v
+		WHERE quantity != 0 OR value != 0
+		ORDER BY location_id, item_id
+	`
+
+	rows, err := s.db.Query(query, organizationID, asOf, MovementTypeReserve, MovementTypeRelease)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var locationID uuid.UUID
+		var line ItemValuation
+		err := rows.Scan(&locationID, &line.ItemID, &line.Quantity, &line.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		last := len(report.Locations) - 1
+		if last < 0 || report.Locations[last].LocationID != locationID {
+			report.Locations = append(report.Locations, LocationValuation{LocationID: locationID})
+			last++
+		}
+
+		location := &report.Locations[last]
+		location.Items = append(location.Items, line)
+		location.Quantity += line.Quantity
+		location.Value += line.Value
+		report.TotalValue += line.Value
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// costMovement sets UnitCost and TotalCost on a movement that changes physical
+// stock. Inbound stock is valued at the movement's TotalCost when given, which
+// carries value over exactly where it does not divide into a whole unit cost,
+// else at its UnitCost, else at the current average cost at the location, else
+// at the item's cost price.
+// Outbound stock draws down cost layers oldest first and is costed from them
+// under FIFO, or at the location's average cost under moving average.
+func costMovement(tx *sql.Tx, movement *StockMovement, physicalDelta, physical, stockValue int) error {
+	if physicalDelta == 0 {
+		return nil
+	}
+
+	var costingMethod string
+	var costPrice int
+	err := tx.QueryRow(`
+		SELECT o.costing_method, i.cost_price
+		FROM items i
+		JOIN organizations o ON o.id = i.organization_id
+		WHERE i.id = $1
+	`, movement.ItemID).Scan(&costingMethod, &costPrice)
+	if err != nil {
+		return err
+	}
+
+	if physicalDelta > 0 {
+		if movement.TotalCost != nil {
+			unitCost := *movement.TotalCost / physicalDelta
+			movement.UnitCost = &unitCost
+			return nil
+		}
+
+		unitCost := costPrice
+		switch {
+		case movement.UnitCost != nil:
+			unitCost = *movement.UnitCost
+		case physical > 0:
+			unitCost = stockValue / physical
+		}
+
+		totalCost := unitCost * physicalDelta
+		movement.UnitCost = &unitCost
+		movement.TotalCost = &totalCost
+		return nil
+	}
+
+	quantity := -physicalDelta
+	cost, err := consumeCostLayers(tx, movement.ItemID, movement.LocationID, quantity, costPrice)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case quantity == physical:
+		// Emptying the location takes whatever value is left so rounding never
+		// strands value against zero stock.
+		cost = stockValue
+	case costingMethod == CostingMethodAverage:
+		cost = stockValue * quantity / physical
+	}
+
+	unitCost := cost / quantity
+	totalCost := -cost
+	movement.UnitCost = &unitCost
+	movement.TotalCost = &totalCost
+
+	return nil
+}
+
+// consumeCostLayers removes quantity from the oldest open layers for an item at
+// a location and returns their cost. Any quantity not covered by layers is
+// costed at fallbackUnitCost.
+func consumeCostLayers(tx *sql.Tx, itemID, locationID uuid.UUID, quantity, fallbackUnitCost int) (int, error) {
+	rows, err := tx.Query(`
+		SELECT id, remaining_quantity, unit_cost
+		FROM cost_layers
+		WHERE item_id = $1 AND location_id = $2 AND remaining_quantity > 0
+		ORDER BY created_at, id
+		FOR UPDATE
+	`, itemID, locationID)
+	if err != nil {
+		return 0, err
+	}
+
+	type layer struct {
+		id        uuid.UUID
+		remaining int
+		unitCost  int
+	}
+
+	var layers []layer
+	for rows.Next() {
+		var l layer
+		err := rows.Scan(&l.id, &l.remaining, &l.unitCost)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		layers = append(layers, l)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	cost := 0
+	for _, l := range layers {
+		if quantity == 0 {
+			break
+		}
+
+		taken := min(l.remaining, quantity)
+		_, err := tx.Exec(`
+			UPDATE cost_layers
+			SET remaining_quantity = remaining_quantity - $1
+			WHERE id = $2
+		`, taken, l.id)
+		if err != nil {
+			return 0, err
+		}
+
+		cost += taken * l.unitCost
+		quantity -= taken
+	}
+
+	return cost + quantity*fallbackUnitCost, nil
+}
+
+// createCostLayer opens the cost layers for quantity units received by
+// movement. Layers hold a whole unit cost, so a total cost that does not
+// divide evenly is split over two layers a unit of cost apart, together worth
+// exactly the movement's total.
+func createCostLayer(tx *sql.Tx, movement *StockMovement, quantity int) error {
+	unitCost := *movement.TotalCost / quantity
+	remainder := *movement.TotalCost - unitCost*quantity
+
+	layers := []struct{ quantity, unitCost int }{
+		{quantity - remainder, unitCost},
+		{remainder, unitCost + 1},
+	}
+
+	for _, layer := range layers {
+		if layer.quantity == 0 {
+			continue
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO cost_layers (item_id, location_id, movement_id, quantity, remaining_quantity, unit_cost, created_at)
+			VALUES ($1, $2, $3, $4, $4, $5, $6)
+		`, movement.ItemID, movement.LocationID, movement.ID, layer.quantity, layer.unitCost, movement.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
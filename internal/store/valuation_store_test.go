@@ -0,0 +1,70 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueCosting(t *testing.T) {
+	tests := []struct {
+		name          string
+		costingMethod string
+		wantIssueCost int
+		wantValue     int
+	}{
+		{
+			name:          "FIFO issues the oldest layer first",
+			costingMethod: CostingMethodFIFO,
+			wantIssueCost: -900,
+			wantValue:     400,
+		},
+		{
+			name:          "Moving average issues at the average cost",
+			costingMethod: CostingMethodAverage,
+			wantIssueCost: -975,
+			wantValue:     325,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			defer db.Close()
+
+			// Seeds 10 units valued at the item's cost price of 50.
+			item, location := seedItemAndLocation(t, db)
+			_, err := db.Exec(`UPDATE organizations SET costing_method = $1 WHERE id = $2`, tt.costingMethod, item.OrganizationID)
+			require.NoError(t, err)
+
+			movements := NewPostgresStockMovementStore(db)
+			unitCost := 80
+			_, err = movements.CreateMovement(&StockMovement{
+				ItemID:       item.ID,
+				LocationID:   location.ID,
+				MovementType: MovementTypeReceipt,
+				Quantity:     10,
+				UnitCost:     &unitCost,
+			})
+			require.NoError(t, err)
+
+			issue, err := movements.CreateMovement(&StockMovement{
+				ItemID:       item.ID,
+				LocationID:   location.ID,
+				MovementType: MovementTypeIssue,
+				Quantity:     -15,
+			})
+			require.NoError(t, err)
+			require.NotNil(t, issue.TotalCost)
+			assert.Equal(t, tt.wantIssueCost, *issue.TotalCost)
+
+			report, err := NewPostgresValuationStore(db).GetValuation(item.OrganizationID, time.Now())
+			require.NoError(t, err)
+			require.Len(t, report.Locations, 1)
+			assert.Equal(t, 5, report.Locations[0].Quantity)
+			assert.Equal(t, tt.wantValue, report.TotalValue)
+		})
+	}
+}
@@ -0,0 +1,484 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"kabancount/internal/pagination"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	WorkOrderStatusDraft     = "draft"
+	WorkOrderStatusReleased  = "released"
+	WorkOrderStatusCompleted = "completed"
+	WorkOrderStatusCancelled = "cancelled"
+)
+
+var ErrComponentShortage = errors.New("insufficient components to release work order")
+
+type WorkOrder struct {
+	ID             uuid.UUID            `json:"id"`
+	OrganizationID uuid.UUID            `json:"organization_id"`
+	BOMID          uuid.UUID            `json:"bom_id"`
+	ItemID         uuid.UUID            `json:"item_id"`
+	LocationID     uuid.UUID            `json:"location_id"`
+	Quantity       int                  `json:"quantity"`
+	Status         string               `json:"status"`
+	BatchID        uuid.UUID            `json:"batch_id"`
+	Notes          *string              `json:"notes"`
+	CreatedBy      *uuid.UUID           `json:"created_by"`
+	ReleasedAt     *time.Time           `json:"released_at"`
+	CompletedAt    *time.Time           `json:"completed_at"`
+	CreatedAt      time.Time            `json:"created_at"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+	Components     []WorkOrderComponent `json:"components"`
+}
+
+type WorkOrderComponent struct {
+	ID               uuid.UUID `json:"id"`
+	WorkOrderID      uuid.UUID `json:"work_order_id"`
+	ItemID           uuid.UUID `json:"item_id"`
+	QuantityRequired int       `json:"quantity_required"`
+}
+
+// WorkOrderRequirement compares what a work order needs of one component with
+// what is currently available at its location.
+type WorkOrderRequirement struct {
+	ItemID            uuid.UUID `json:"item_id"`
+	QuantityRequired  int       `json:"quantity_required"`
+	QuantityAvailable int       `json:"quantity_available"`
+	Shortage          int       `json:"shortage"`
+}
+
+type PostgresWorkOrderStore struct {
+	db *sql.DB
+}
+
+func NewPostgresWorkOrderStore(db *sql.DB) *PostgresWorkOrderStore {
+	return &PostgresWorkOrderStore{db: db}
+}
+
+type WorkOrderStore interface {
+	CreateWorkOrder(workOrder *WorkOrder) (*WorkOrder, error)
+	GetWorkOrderByID(id uuid.UUID) (*WorkOrder, error)
+	GetWorkOrdersByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*WorkOrder], error)
+	CountWorkOrdersByOrganization(status string, organizationID uuid.UUID) (int, error)
+	GetWorkOrderRequirements(id uuid.UUID) ([]WorkOrderRequirement, error)
+	ReleaseWorkOrder(id uuid.UUID) (*WorkOrder, error)
+	CompleteWorkOrder(id uuid.UUID, serialNumbers map[uuid.UUID][]string, userID uuid.UUID) (*WorkOrder, error)
+	CancelWorkOrder(id uuid.UUID) (*WorkOrder, error)
+}
+
+// CreateWorkOrder opens a draft work order, copying the BOM's components
+// scaled by the order quantity.
+func (s *PostgresWorkOrderStore) CreateWorkOrder(workOrder *WorkOrder) (*WorkOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO work_orders (organization_id, bom_id, item_id, location_id, quantity, status, notes, created_by)
+		SELECT $1, b.id, b.item_id, $3, $4, $5, $6, $7
+		FROM boms b
+		WHERE b.id = $2
+		RETURNING id, item_id, status, batch_id, created_at, updated_at
+	`
+
+	err = tx.QueryRow(
+		query,
+		workOrder.OrganizationID,
+		workOrder.BOMID,
+		workOrder.LocationID,
+		workOrder.Quantity,
+		WorkOrderStatusDraft,
+		workOrder.Notes,
+		workOrder.CreatedBy,
+	).Scan(
+		&workOrder.ID,
+		&workOrder.ItemID,
+		&workOrder.Status,
+		&workOrder.BatchID,
+		&workOrder.CreatedAt,
+		&workOrder.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		INSERT INTO work_order_components (work_order_id, item_id, quantity_required)
+		SELECT $1, item_id, quantity * $2
+		FROM bom_components
+		WHERE bom_id = $3
+		RETURNING id, work_order_id, item_id, quantity_required
+	`, workOrder.ID, workOrder.Quantity, workOrder.BOMID)
+	if err != nil {
+		return nil, err
+	}
+
+	workOrder.Components = []WorkOrderComponent{}
+	for rows.Next() {
+		var component WorkOrderComponent
+		err := rows.Scan(
+			&component.ID,
+			&component.WorkOrderID,
+			&component.ItemID,
+			&component.QuantityRequired,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		workOrder.Components = append(workOrder.Components, component)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workOrder, nil
+}
+
+func (s *PostgresWorkOrderStore) GetWorkOrderByID(id uuid.UUID) (*WorkOrder, error) {
+	return getWorkOrder(s.db.QueryRow, id, false)
+}
+
+// workOrderOrder lists work orders newest first.
+var workOrderOrder = pagination.Newest("w", func(workOrder *WorkOrder) (time.Time, uuid.UUID) { return workOrder.CreatedAt, workOrder.ID })
+
+func (s *PostgresWorkOrderStore) GetWorkOrdersByOrganization(status string, params pagination.Params, organizationID uuid.UUID) (*pagination.Page[*WorkOrder], error) {
+	pageClause, args, err := pagination.Clause(params, workOrderOrder, []any{organizationID, status})
+	if err != nil {
+		return nil, err
+	}
+
+	query := workOrderSelect + `
+		WHERE w.organization_id = $1 AND ($2 = '' OR w.status = $2)` + pageClause
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workOrders []*WorkOrder
+	for rows.Next() {
+		workOrder, err := scanWorkOrder(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		workOrders = append(workOrders, workOrder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pagination.NewPage(params, workOrderOrder, workOrders), nil
+}
+
+func (s *PostgresWorkOrderStore) CountWorkOrdersByOrganization(status string, organizationID uuid.UUID) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM work_orders
+		WHERE organization_id = $1 AND ($2 = '' OR status = $2)
+	`
+
+	var count int
+	err := s.db.QueryRow(query, organizationID, status).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *PostgresWorkOrderStore) GetWorkOrderRequirements(id uuid.UUID) ([]WorkOrderRequirement, error) {
+	return getWorkOrderRequirements(s.db.Query, id)
+}
+
+// ReleaseWorkOrder moves a draft work order to released once every component
+// is available in full at the work order's location. Nothing is reserved;
+// completion re-checks stock as it consumes it.
+func (s *PostgresWorkOrderStore) ReleaseWorkOrder(id uuid.UUID) (*WorkOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	workOrder, err := getWorkOrder(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if workOrder == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if workOrder.Status != WorkOrderStatusDraft {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	requirements, err := getWorkOrderRequirements(tx.Query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, requirement := range requirements {
+		if requirement.Shortage > 0 {
+			return nil, ErrComponentShortage
+		}
+	}
+
+	err = tx.QueryRow(`
+		UPDATE work_orders
+		SET status = $1, released_at = NOW(), updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, released_at, updated_at
+	`, WorkOrderStatusReleased, id).Scan(&workOrder.Status, &workOrder.ReleasedAt, &workOrder.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workOrder, nil
+}
+
+// CompleteWorkOrder consumes every component and produces the finished item at
+// the work order's location. All movements share the work order's batch_id.
+// serialNumbers names the units consumed or produced of serialized items,
+// keyed by item ID.
+func (s *PostgresWorkOrderStore) CompleteWorkOrder(id uuid.UUID, serialNumbers map[uuid.UUID][]string, userID uuid.UUID) (*WorkOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	workOrder, err := getWorkOrder(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if workOrder == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if workOrder.Status != WorkOrderStatusReleased {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	consumedCost := 0
+	for _, component := range workOrder.Components {
+		consumption := &StockMovement{
+			ItemID:        component.ItemID,
+			LocationID:    workOrder.LocationID,
+			MovementType:  MovementTypeConsume,
+			Quantity:      -component.QuantityRequired,
+			ReferenceType: stringPtr(ReferenceTypeWorkOrder),
+			ReferenceID:   &workOrder.ID,
+			CreatedBy:     &userID,
+			BatchID:       &workOrder.BatchID,
+			SerialNumbers: serialNumbers[component.ItemID],
+		}
+
+		err := postMovement(tx, consumption)
+		if err != nil {
+			return nil, err
+		}
+		consumedCost -= *consumption.TotalCost
+	}
+
+	// Finished goods carry the cost of the components that went into them.
+	err = postMovement(tx, &StockMovement{
+		ItemID:        workOrder.ItemID,
+		LocationID:    workOrder.LocationID,
+		MovementType:  MovementTypeProduce,
+		Quantity:      workOrder.Quantity,
+		ReferenceType: stringPtr(ReferenceTypeWorkOrder),
+		ReferenceID:   &workOrder.ID,
+		CreatedBy:     &userID,
+		BatchID:       &workOrder.BatchID,
+		TotalCost:     &consumedCost,
+		SerialNumbers: serialNumbers[workOrder.ItemID],
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`
+		UPDATE work_orders
+		SET status = $1, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, completed_at, updated_at
+	`, WorkOrderStatusCompleted, id).Scan(&workOrder.Status, &workOrder.CompletedAt, &workOrder.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workOrder, nil
+}
+
+func (s *PostgresWorkOrderStore) CancelWorkOrder(id uuid.UUID) (*WorkOrder, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	workOrder, err := getWorkOrder(tx.QueryRow, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if workOrder == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	if !slices.Contains([]string{WorkOrderStatusDraft, WorkOrderStatusReleased}, workOrder.Status) {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	err = tx.QueryRow(`
+		UPDATE work_orders
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING status, updated_at
+	`, WorkOrderStatusCancelled, id).Scan(&workOrder.Status, &workOrder.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return workOrder, nil
+}
+
+func getWorkOrderRequirements(query func(query string, args ...any) (*sql.Rows, error), id uuid.UUID) ([]WorkOrderRequirement, error) {
+	rows, err := query(`
+		SELECT c.item_id, c.quantity_required, COALESCE(s.quantity_available, 0)
+		FROM work_order_components c
+		JOIN work_orders w ON w.id = c.work_order_id
+		LEFT JOIN stock_levels s ON s.item_id = c.item_id AND s.location_id = w.location_id
+		WHERE c.work_order_id = $1
+		ORDER BY c.id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requirements := []WorkOrderRequirement{}
+	for rows.Next() {
+		var requirement WorkOrderRequirement
+		err := rows.Scan(
+			&requirement.ItemID,
+			&requirement.QuantityRequired,
+			&requirement.QuantityAvailable,
+		)
+		if err != nil {
+			return nil, err
+		}
+		requirement.Shortage = max(requirement.QuantityRequired-requirement.QuantityAvailable, 0)
+		requirements = append(requirements, requirement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return requirements, nil
+}
+
+const workOrderSelect = `
+	SELECT w.id, w.organization_id, w.bom_id, w.item_id, w.location_id, w.quantity, w.status, w.batch_id, w.notes, w.created_by,
+		w.released_at, w.completed_at, w.created_at, w.updated_at,
+		COALESCE((
+			SELECT JSON_AGG(
+				JSON_BUILD_OBJECT(
+					'id', c.id,
+					'work_order_id', c.work_order_id,
+					'item_id', c.item_id,
+					'quantity_required', c.quantity_required
+				) ORDER BY c.id
+			)
+			FROM work_order_components c
+			WHERE c.work_order_id = w.id
+		), '[]') AS components
+	FROM work_orders w
+`
+
+func getWorkOrder(queryRow func(query string, args ...any) *sql.Row, id uuid.UUID, forUpdate bool) (*WorkOrder, error) {
+	query := workOrderSelect + `
+		WHERE w.id = $1
+	`
+	if forUpdate {
+		query += " FOR UPDATE OF w"
+	}
+
+	workOrder, err := scanWorkOrder(queryRow(query, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return workOrder, nil
+}
+
+func scanWorkOrder(scan func(dest ...any) error) (*WorkOrder, error) {
+	workOrder := &WorkOrder{}
+	var componentsJSON []byte
+	err := scan(
+		&workOrder.ID,
+		&workOrder.OrganizationID,
+		&workOrder.BOMID,
+		&workOrder.ItemID,
+		&workOrder.LocationID,
+		&workOrder.Quantity,
+		&workOrder.Status,
+		&workOrder.BatchID,
+		&workOrder.Notes,
+		&workOrder.CreatedBy,
+		&workOrder.ReleasedAt,
+		&workOrder.CompletedAt,
+		&workOrder.CreatedAt,
+		&workOrder.UpdatedAt,
+		&componentsJSON,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(componentsJSON, &workOrder.Components); err != nil {
+		return nil, err
+	}
+
+	return workOrder, nil
+}
@@ -0,0 +1,74 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompleteWorkOrder(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	component, location := seedItemAndLocation(t, db)
+	user := seedUser(t, db, component.OrganizationID)
+
+	finished, err := NewPostgresItemStore(db).CreateItem(&Item{
+		OrganizationID: component.OrganizationID,
+		CategoryID:     component.CategoryID,
+		Name:           "Ledger Assembly",
+		UnitPrice:      500,
+		IsActive:       true,
+		BaseUnit:       DefaultBaseUnit,
+	})
+	require.NoError(t, err)
+
+	bom, err := NewPostgresBOMStore(db).CreateBOM(&BOM{
+		OrganizationID: component.OrganizationID,
+		ItemID:         finished.ID,
+		Components:     []BOMComponent{{ItemID: component.ID, Quantity: 3}},
+	})
+	require.NoError(t, err)
+
+	workOrders := NewPostgresWorkOrderStore(db)
+	create := func(quantity int) *WorkOrder {
+		workOrder, err := workOrders.CreateWorkOrder(&WorkOrder{
+			OrganizationID: component.OrganizationID,
+			BOMID:          bom.ID,
+			LocationID:     location.ID,
+			Quantity:       quantity,
+		})
+		require.NoError(t, err)
+		return workOrder
+	}
+
+	short := create(4)
+	require.Len(t, short.Components, 1)
+	assert.Equal(t, 12, short.Components[0].QuantityRequired)
+
+	_, err = workOrders.ReleaseWorkOrder(short.ID)
+	assert.ErrorIs(t, err, ErrComponentShortage)
+
+	workOrder := create(2)
+	_, err = workOrders.CompleteWorkOrder(workOrder.ID, nil, user.ID)
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+	_, err = workOrders.ReleaseWorkOrder(workOrder.ID)
+	require.NoError(t, err)
+
+	workOrder, err = workOrders.CompleteWorkOrder(workOrder.ID, nil, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, WorkOrderStatusCompleted, workOrder.Status)
+
+	physical, _ := readStockLevel(t, db, component.ID, location.ID)
+	assert.Equal(t, 4, physical)
+	physical, _ = readStockLevel(t, db, finished.ID, location.ID)
+	assert.Equal(t, 2, physical)
+
+	// The finished goods carry the cost of the six components consumed.
+	var stockValue int
+	err = db.QueryRow(`SELECT stock_value FROM stock_levels WHERE item_id = $1 AND location_id = $2`, finished.ID, location.ID).Scan(&stockValue)
+	require.NoError(t, err)
+	assert.Equal(t, 300, stockValue)
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"net/http"
 	"regexp"
-	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -42,31 +41,6 @@ func ReadIDParam(r *http.Request) (*uuid.UUID, error) {
 	return &ID, nil
 }
 
-func PaginationParams(r *http.Request) (limit, offset int) {
-	query := r.URL.Query()
-
-	limit = 20
-	offset = 0
-
-	if l := query.Get("limit"); l != "" {
-		var err error
-		limit, err = strconv.Atoi(l)
-		if err != nil || limit < 1 {
-			limit = 20
-		}
-	}
-
-	if o := query.Get("offset"); o != "" {
-		var err error
-		offset, err = strconv.Atoi(o)
-		if err != nil || offset < 0 {
-			offset = 0
-		}
-	}
-
-	return limit, offset
-}
-
 func IsValidEmail(email string) bool {
 	// A very simple email validation
 	if len(email) < 3 || len(email) > 254 {
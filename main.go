@@ -23,6 +23,8 @@ func main() {
 
 	app.Logger.Println("Starting server on :", port)
 
+	app.StartBackgroundJobs()
+
 	r := routes.SetupRoutes(app)
 
 	server := &http.Server{
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS transfers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    from_location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    to_location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'in_transit',
+    batch_id UUID NOT NULL DEFAULT uuid_generate_v4(),
+    reason TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    shipped_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    received_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_distinct_locations CHECK (from_location_id != to_location_id)
+);
+
+CREATE TABLE IF NOT EXISTS transfer_lines (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    transfer_id UUID NOT NULL REFERENCES transfers(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    quantity INT NOT NULL,
+    CONSTRAINT check_positive_transfer_quantity CHECK (quantity > 0)
+);
+
+CREATE INDEX idx_transfers_organization_id ON transfers(organization_id);
+CREATE INDEX idx_transfers_status ON transfers(status);
+CREATE INDEX idx_transfer_lines_transfer_id ON transfer_lines(transfer_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS transfer_lines;
+DROP TABLE IF EXISTS transfers;
+
+DROP INDEX IF EXISTS idx_transfers_organization_id;
+DROP INDEX IF EXISTS idx_transfers_status;
+DROP INDEX IF EXISTS idx_transfer_lines_transfer_id;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS reservations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    quantity INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    reference_type VARCHAR(50),
+    reference_id UUID,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_positive_reservation_quantity CHECK (quantity > 0)
+);
+
+CREATE INDEX idx_reservations_organization_id ON reservations(organization_id);
+CREATE INDEX idx_reservations_reference ON reservations(reference_type, reference_id);
+CREATE INDEX idx_reservations_active_expiry ON reservations(expires_at) WHERE status = 'active';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS reservations;
+
+DROP INDEX IF EXISTS idx_reservations_organization_id;
+DROP INDEX IF EXISTS idx_reservations_reference;
+DROP INDEX IF EXISTS idx_reservations_active_expiry;
+-- +goose StatementEnd
@@ -0,0 +1,41 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS cycle_counts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    category_id UUID REFERENCES categories(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    approved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    approved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS cycle_count_lines (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    cycle_count_id UUID NOT NULL REFERENCES cycle_counts(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    expected_quantity INT NOT NULL,
+    counted_quantity INT,
+    counted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    counted_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE(cycle_count_id, item_id),
+    CONSTRAINT check_positive_counted CHECK (counted_quantity >= 0)
+);
+
+CREATE INDEX idx_cycle_counts_organization_id ON cycle_counts(organization_id);
+CREATE INDEX idx_cycle_counts_location_id ON cycle_counts(location_id);
+CREATE INDEX idx_cycle_count_lines_cycle_count_id ON cycle_count_lines(cycle_count_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS cycle_count_lines;
+DROP TABLE IF EXISTS cycle_counts;
+
+DROP INDEX IF EXISTS idx_cycle_counts_organization_id;
+DROP INDEX IF EXISTS idx_cycle_counts_location_id;
+DROP INDEX IF EXISTS idx_cycle_count_lines_cycle_count_id;
+-- +goose StatementEnd
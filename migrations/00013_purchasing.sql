@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS suppliers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    contact_name VARCHAR(100),
+    email VARCHAR(255),
+    phone VARCHAR(50),
+    address TEXT,
+    notes TEXT,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS purchase_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    supplier_id UUID NOT NULL REFERENCES suppliers(id) ON DELETE RESTRICT,
+    reference VARCHAR(100),
+    status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    expected_at TIMESTAMP WITH TIME ZONE,
+    notes TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS purchase_order_lines (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    purchase_order_id UUID NOT NULL REFERENCES purchase_orders(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    quantity_ordered INT NOT NULL,
+    quantity_received INT NOT NULL DEFAULT 0,
+    unit_cost BIGINT NOT NULL,
+    CONSTRAINT check_positive_ordered CHECK (quantity_ordered > 0),
+    CONSTRAINT check_valid_received CHECK (quantity_received >= 0 AND quantity_received <= quantity_ordered)
+);
+
+CREATE INDEX idx_suppliers_organization_id ON suppliers(organization_id);
+CREATE INDEX idx_purchase_orders_organization_id ON purchase_orders(organization_id);
+CREATE INDEX idx_purchase_orders_supplier_id ON purchase_orders(supplier_id);
+CREATE INDEX idx_purchase_order_lines_purchase_order_id ON purchase_order_lines(purchase_order_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS purchase_order_lines;
+DROP TABLE IF EXISTS purchase_orders;
+DROP TABLE IF EXISTS suppliers;
+
+DROP INDEX IF EXISTS idx_suppliers_organization_id;
+DROP INDEX IF EXISTS idx_purchase_orders_organization_id;
+DROP INDEX IF EXISTS idx_purchase_orders_supplier_id;
+DROP INDEX IF EXISTS idx_purchase_order_lines_purchase_order_id;
+-- +goose StatementEnd
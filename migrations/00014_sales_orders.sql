@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sales_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    customer_name VARCHAR(100) NOT NULL,
+    reference VARCHAR(100),
+    status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    notes TEXT,
+    tracking_number VARCHAR(100),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    shipped_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sales_order_lines (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    sales_order_id UUID NOT NULL REFERENCES sales_orders(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    quantity INT NOT NULL,
+    unit_price BIGINT NOT NULL,
+    CONSTRAINT check_positive_sales_quantity CHECK (quantity > 0)
+);
+
+CREATE INDEX idx_sales_orders_organization_id ON sales_orders(organization_id);
+CREATE INDEX idx_sales_orders_status ON sales_orders(status);
+CREATE INDEX idx_sales_order_lines_sales_order_id ON sales_order_lines(sales_order_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sales_order_lines;
+DROP TABLE IF EXISTS sales_orders;
+
+DROP INDEX IF EXISTS idx_sales_orders_organization_id;
+DROP INDEX IF EXISTS idx_sales_orders_status;
+DROP INDEX IF EXISTS idx_sales_order_lines_sales_order_id;
+-- +goose StatementEnd
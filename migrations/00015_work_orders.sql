@@ -0,0 +1,67 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS boms (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    notes TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(item_id)
+);
+
+CREATE TABLE IF NOT EXISTS bom_components (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    bom_id UUID NOT NULL REFERENCES boms(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    quantity INT NOT NULL,
+    UNIQUE(bom_id, item_id),
+    CONSTRAINT check_positive_component_quantity CHECK (quantity > 0)
+);
+
+CREATE TABLE IF NOT EXISTS work_orders (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    bom_id UUID NOT NULL REFERENCES boms(id) ON DELETE RESTRICT,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    quantity INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'draft',
+    batch_id UUID NOT NULL DEFAULT uuid_generate_v4(),
+    notes TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    released_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_positive_work_order_quantity CHECK (quantity > 0)
+);
+
+CREATE TABLE IF NOT EXISTS work_order_components (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    work_order_id UUID NOT NULL REFERENCES work_orders(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    quantity_required INT NOT NULL,
+    CONSTRAINT check_positive_required CHECK (quantity_required > 0)
+);
+
+CREATE INDEX idx_boms_organization_id ON boms(organization_id);
+CREATE INDEX idx_bom_components_bom_id ON bom_components(bom_id);
+CREATE INDEX idx_work_orders_organization_id ON work_orders(organization_id);
+CREATE INDEX idx_work_orders_bom_id ON work_orders(bom_id);
+CREATE INDEX idx_work_order_components_work_order_id ON work_order_components(work_order_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS work_order_components;
+DROP TABLE IF EXISTS work_orders;
+DROP TABLE IF EXISTS bom_components;
+DROP TABLE IF EXISTS boms;
+
+DROP INDEX IF EXISTS idx_boms_organization_id;
+DROP INDEX IF EXISTS idx_bom_components_bom_id;
+DROP INDEX IF EXISTS idx_work_orders_organization_id;
+DROP INDEX IF EXISTS idx_work_orders_bom_id;
+DROP INDEX IF EXISTS idx_work_order_components_work_order_id;
+-- +goose StatementEnd
@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE organizations ADD COLUMN costing_method VARCHAR(20) NOT NULL DEFAULT 'fifo';
+ALTER TABLE organizations ADD CONSTRAINT check_costing_method CHECK (costing_method IN ('fifo', 'average'));
+
+ALTER TABLE stock_levels ADD COLUMN stock_value BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE stock_movements ADD COLUMN unit_cost BIGINT;
+ALTER TABLE stock_movements ADD COLUMN total_cost BIGINT;
+
+CREATE TABLE IF NOT EXISTS cost_layers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    movement_id UUID REFERENCES stock_movements(id) ON DELETE SET NULL,
+    quantity INT NOT NULL,
+    remaining_quantity INT NOT NULL,
+    unit_cost BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT check_valid_remaining CHECK (remaining_quantity >= 0 AND remaining_quantity <= quantity)
+);
+
+CREATE INDEX idx_cost_layers_open ON cost_layers(item_id, location_id, created_at) WHERE remaining_quantity > 0;
+
+-- Stock on hand before costing existed is valued at the item's cost price.
+UPDATE stock_levels s
+SET stock_value = s.quantity_physical * i.cost_price
+FROM items i
+WHERE i.id = s.item_id;
+
+INSERT INTO cost_layers (item_id, location_id, quantity, remaining_quantity, unit_cost)
+SELECT s.item_id, s.location_id, s.quantity_physical, s.quantity_physical, i.cost_price
+FROM stock_levels s
+JOIN items i ON i.id = s.item_id
+WHERE s.quantity_physical > 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS cost_layers;
+
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS total_cost;
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS unit_cost;
+ALTER TABLE stock_levels DROP COLUMN IF EXISTS stock_value;
+ALTER TABLE organizations DROP CONSTRAINT IF EXISTS check_costing_method;
+ALTER TABLE organizations DROP COLUMN IF EXISTS costing_method;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS lots (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    lot_number VARCHAR(100) NOT NULL,
+    manufactured_at DATE,
+    expires_at DATE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(item_id, lot_number)
+);
+
+CREATE TABLE IF NOT EXISTS lot_stock (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    lot_id UUID NOT NULL REFERENCES lots(id) ON DELETE CASCADE,
+    location_id UUID NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    quantity INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(lot_id, location_id),
+    CONSTRAINT check_positive_lot_quantity CHECK (quantity >= 0)
+);
+
+ALTER TABLE stock_movements ADD COLUMN lot_id UUID REFERENCES lots(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_lots_expires_at ON lots(expires_at);
+CREATE INDEX idx_lot_stock_location_id ON lot_stock(location_id) WHERE quantity > 0;
+CREATE INDEX idx_movements_lot ON stock_movements(lot_id) WHERE lot_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_movements_lot;
+DROP INDEX IF EXISTS idx_lot_stock_location_id;
+DROP INDEX IF EXISTS idx_lots_expires_at;
+
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS lot_id;
+
+DROP TABLE IF EXISTS lot_stock;
+DROP TABLE IF EXISTS lots;
+-- +goose StatementEnd
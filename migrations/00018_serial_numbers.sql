@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE items ADD COLUMN track_serials BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS serial_numbers (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    serial_number VARCHAR(100) NOT NULL,
+    location_id UUID REFERENCES locations(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'in_stock',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(item_id, serial_number),
+    CONSTRAINT check_serial_status CHECK (status IN ('in_stock', 'in_transit', 'issued'))
+);
+
+CREATE TABLE IF NOT EXISTS stock_movement_serials (
+    movement_id UUID NOT NULL REFERENCES stock_movements(id) ON DELETE CASCADE,
+    serial_number_id UUID NOT NULL REFERENCES serial_numbers(id) ON DELETE CASCADE,
+    PRIMARY KEY (movement_id, serial_number_id)
+);
+
+CREATE INDEX idx_serial_numbers_location ON serial_numbers(location_id) WHERE location_id IS NOT NULL;
+CREATE INDEX idx_movement_serials_serial ON stock_movement_serials(serial_number_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_movement_serials_serial;
+DROP INDEX IF EXISTS idx_serial_numbers_location;
+
+DROP TABLE IF EXISTS stock_movement_serials;
+DROP TABLE IF EXISTS serial_numbers;
+
+ALTER TABLE items DROP COLUMN IF EXISTS track_serials;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE items ADD COLUMN base_unit VARCHAR(20) NOT NULL DEFAULT 'each';
+
+CREATE TABLE IF NOT EXISTS item_units (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    name VARCHAR(20) NOT NULL,
+    factor INT NOT NULL,
+    allow_fractional BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(item_id, name),
+    CONSTRAINT check_positive_factor CHECK (factor > 0)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS item_units;
+
+ALTER TABLE items DROP COLUMN IF EXISTS base_unit;
+-- +goose StatementEnd
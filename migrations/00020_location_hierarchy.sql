@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE locations ADD COLUMN parent_id UUID REFERENCES locations(id) ON DELETE RESTRICT;
+ALTER TABLE locations ADD COLUMN location_type VARCHAR(20) NOT NULL DEFAULT 'warehouse';
+ALTER TABLE locations ADD COLUMN capacity INT;
+
+ALTER TABLE locations ADD CONSTRAINT check_location_type CHECK (location_type IN ('warehouse', 'zone', 'aisle', 'bin'));
+ALTER TABLE locations ADD CONSTRAINT check_location_capacity CHECK (capacity IS NULL OR capacity >= 0);
+
+CREATE INDEX idx_locations_parent_id ON locations(parent_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_locations_parent_id;
+
+ALTER TABLE locations DROP CONSTRAINT IF EXISTS check_location_capacity;
+ALTER TABLE locations DROP CONSTRAINT IF EXISTS check_location_type;
+
+ALTER TABLE locations DROP COLUMN IF EXISTS capacity;
+ALTER TABLE locations DROP COLUMN IF EXISTS location_type;
+ALTER TABLE locations DROP COLUMN IF EXISTS parent_id;
+-- +goose StatementEnd
@@ -0,0 +1,45 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS products (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    category_id UUID NOT NULL REFERENCES categories(id) ON DELETE CASCADE,
+    sku VARCHAR(100) NULL,
+    name VARCHAR(50) NOT NULL,
+    description VARCHAR(255) NULL,
+    unit_price BIGINT NOT NULL,
+    cost_price BIGINT NOT NULL,
+    base_unit VARCHAR(20) NOT NULL DEFAULT 'each',
+    options JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(organization_id, name)
+);
+
+CREATE INDEX idx_products_organization_id ON products(organization_id);
+
+ALTER TABLE items ADD COLUMN product_id UUID REFERENCES products(id) ON DELETE RESTRICT;
+ALTER TABLE items ADD COLUMN option_values JSONB;
+
+CREATE UNIQUE INDEX idx_items_product_options ON items(product_id, option_values) WHERE product_id IS NOT NULL;
+
+-- Variant names repeat the product name, so item names only need to be
+-- unique within an organization.
+ALTER TABLE items ALTER COLUMN name TYPE VARCHAR(255);
+ALTER TABLE items DROP CONSTRAINT IF EXISTS items_name_key;
+ALTER TABLE items ADD CONSTRAINT items_organization_name_key UNIQUE (organization_id, name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE items DROP CONSTRAINT IF EXISTS items_organization_name_key;
+ALTER TABLE items ALTER COLUMN name TYPE VARCHAR(50);
+ALTER TABLE items ADD CONSTRAINT items_name_key UNIQUE (name);
+
+DROP INDEX IF EXISTS idx_items_product_options;
+
+ALTER TABLE items DROP COLUMN IF EXISTS option_values;
+ALTER TABLE items DROP COLUMN IF EXISTS product_id;
+
+DROP TABLE IF EXISTS products;
+-- +goose StatementEnd
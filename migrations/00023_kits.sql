@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE items ADD COLUMN is_kit BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS kit_components (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    kit_item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE RESTRICT,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    UNIQUE(kit_item_id, item_id)
+);
+
+CREATE INDEX idx_kit_components_item_id ON kit_components(item_id);
+
+ALTER TABLE stock_movements ADD COLUMN kit_item_id UUID REFERENCES items(id) ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE stock_movements DROP COLUMN IF EXISTS kit_item_id;
+
+DROP INDEX IF EXISTS idx_kit_components_item_id;
+DROP TABLE IF EXISTS kit_components;
+
+ALTER TABLE items DROP COLUMN IF EXISTS is_kit;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE categories ADD COLUMN attribute_schema JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE items ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_items_attributes ON items USING GIN (attributes);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_items_attributes;
+
+ALTER TABLE items DROP COLUMN IF EXISTS attributes;
+ALTER TABLE categories DROP COLUMN IF EXISTS attribute_schema;
+-- +goose StatementEnd
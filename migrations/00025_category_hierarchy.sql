@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE categories ADD COLUMN parent_id UUID REFERENCES categories(id) ON DELETE RESTRICT;
+
+CREATE INDEX idx_categories_parent_id ON categories(parent_id);
+
+-- Category names only need to be unique among siblings of one organization.
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_name_key;
+ALTER TABLE categories ADD CONSTRAINT categories_organization_parent_name_key UNIQUE NULLS NOT DISTINCT (organization_id, parent_id, name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_organization_parent_name_key;
+ALTER TABLE categories ADD CONSTRAINT categories_name_key UNIQUE (name);
+
+DROP INDEX IF EXISTS idx_categories_parent_id;
+
+ALTER TABLE categories DROP COLUMN IF EXISTS parent_id;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS item_barcodes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    item_id UUID NOT NULL REFERENCES items(id) ON DELETE CASCADE,
+    unit_id UUID REFERENCES item_units(id) ON DELETE CASCADE,
+    code VARCHAR(80) NOT NULL,
+    symbology VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(organization_id, code),
+    CONSTRAINT check_barcode_symbology CHECK (symbology IN ('ean13', 'upca', 'gtin14', 'code128', 'internal'))
+);
+
+CREATE INDEX idx_item_barcodes_item_id ON item_barcodes(item_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS item_barcodes;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX idx_items_name_trgm ON items USING GIN (name gin_trgm_ops);
+CREATE INDEX idx_items_sku_trgm ON items USING GIN (sku gin_trgm_ops);
+CREATE INDEX idx_items_description_trgm ON items USING GIN (description gin_trgm_ops);
+CREATE INDEX idx_items_organization_unit_price ON items(organization_id, unit_price);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_items_organization_unit_price;
+DROP INDEX IF EXISTS idx_items_description_trgm;
+DROP INDEX IF EXISTS idx_items_sku_trgm;
+DROP INDEX IF EXISTS idx_items_name_trgm;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE items ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE categories ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_items_deleted_at ON items(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_categories_deleted_at ON categories(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Deleted items and categories give up their names until they are restored.
+ALTER TABLE items DROP CONSTRAINT IF EXISTS items_organization_name_key;
+CREATE UNIQUE INDEX items_organization_name_key ON items(organization_id, name) WHERE deleted_at IS NULL;
+
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_organization_parent_name_key;
+CREATE UNIQUE INDEX categories_organization_parent_name_key ON categories(organization_id, parent_id, name) NULLS NOT DISTINCT WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM items WHERE deleted_at IS NOT NULL;
+DELETE FROM categories WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS categories_organization_parent_name_key;
+ALTER TABLE categories ADD CONSTRAINT categories_organization_parent_name_key UNIQUE NULLS NOT DISTINCT (organization_id, parent_id, name);
+
+DROP INDEX IF EXISTS items_organization_name_key;
+ALTER TABLE items ADD CONSTRAINT items_organization_name_key UNIQUE (organization_id, name);
+
+DROP INDEX IF EXISTS idx_categories_deleted_at;
+DROP INDEX IF EXISTS idx_items_deleted_at;
+
+ALTER TABLE categories DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE items DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
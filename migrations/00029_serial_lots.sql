@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE serial_numbers ADD COLUMN lot_id UUID REFERENCES lots(id) ON DELETE SET NULL;
+
+-- A serial number in stock sits in the lot of the movement that last brought
+-- it in.
+UPDATE serial_numbers sn
+SET lot_id = (
+    SELECT m.lot_id
+    FROM stock_movement_serials ms
+    JOIN stock_movements m ON m.id = ms.movement_id
+    WHERE ms.serial_number_id = sn.id AND m.quantity > 0
+    ORDER BY m.created_at DESC, m.id DESC
+    LIMIT 1
+)
+WHERE sn.status <> 'issued';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE serial_numbers DROP COLUMN IF EXISTS lot_id;
+-- +goose StatementEnd
@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Deleting a location must never take its ledger and documents with it.
+ALTER TABLE stock_movements DROP CONSTRAINT stock_movements_location_id_fkey;
+ALTER TABLE stock_movements ADD CONSTRAINT stock_movements_location_id_fkey FOREIGN KEY (location_id) REFERENCES locations(id);
+
+ALTER TABLE transfers DROP CONSTRAINT transfers_from_location_id_fkey;
+ALTER TABLE transfers ADD CONSTRAINT transfers_from_location_id_fkey FOREIGN KEY (from_location_id) REFERENCES locations(id);
+ALTER TABLE transfers DROP CONSTRAINT transfers_to_location_id_fkey;
+ALTER TABLE transfers ADD CONSTRAINT transfers_to_location_id_fkey FOREIGN KEY (to_location_id) REFERENCES locations(id);
+
+ALTER TABLE reservations DROP CONSTRAINT reservations_location_id_fkey;
+ALTER TABLE reservations ADD CONSTRAINT reservations_location_id_fkey FOREIGN KEY (location_id) REFERENCES locations(id);
+
+ALTER TABLE cycle_counts DROP CONSTRAINT cycle_counts_location_id_fkey;
+ALTER TABLE cycle_counts ADD CONSTRAINT cycle_counts_location_id_fkey FOREIGN KEY (location_id) REFERENCES locations(id);
+
+ALTER TABLE sales_order_lines DROP CONSTRAINT sales_order_lines_location_id_fkey;
+ALTER TABLE sales_order_lines ADD CONSTRAINT sales_order_lines_location_id_fkey FOREIGN KEY (location_id) REFERENCES locations(id);
+
+ALTER TABLE work_orders DROP CONSTRAINT work_orders_location_id_fkey;
+ALTER TABLE work_orders ADD CONSTRAINT work_orders_location_id_fkey FOREIGN KEY (location_id) REFERENCES locations(id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE work_orders DROP CONSTRAINT work_orders_location_id_fkey;
+ALTER TABLE work_orders ADD CONSTRAINT work_orders_location_id_fkey FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE CASCADE;
+
+ALTER TABLE sales_order_lines DROP CONSTRAINT sales_order_lines_location_id_fkey;
+ALTER TABLE sales_order_lines ADD CONSTRAINT sales_order_lines_location_id_fkey FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE CASCADE;
+
+ALTER TABLE cycle_counts DROP CONSTRAINT cycle_counts_location_id_fkey;
+ALTER TABLE cycle_counts ADD CONSTRAINT cycle_counts_location_id_fkey FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE CASCADE;
+
+ALTER TABLE reservations DROP CONSTRAINT reservations_location_id_fkey;
+ALTER TABLE reservations ADD CONSTRAINT reservations_location_id_fkey FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE CASCADE;
+
+ALTER TABLE transfers DROP CONSTRAINT transfers_to_location_id_fkey;
+ALTER TABLE transfers ADD CONSTRAINT transfers_to_location_id_fkey FOREIGN KEY (to_location_id) REFERENCES locations(id) ON DELETE CASCADE;
+ALTER TABLE transfers DROP CONSTRAINT transfers_from_location_id_fkey;
+ALTER TABLE transfers ADD CONSTRAINT transfers_from_location_id_fkey FOREIGN KEY (from_location_id) REFERENCES locations(id) ON DELETE CASCADE;
+
+ALTER TABLE stock_movements DROP CONSTRAINT stock_movements_location_id_fkey;
+ALTER TABLE stock_movements ADD CONSTRAINT stock_movements_location_id_fkey FOREIGN KEY (location_id) REFERENCES locations(id) ON DELETE CASCADE;
+-- +goose StatementEnd
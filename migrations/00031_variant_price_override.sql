@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A variant's own price, when it has one. Variants without an override
+-- follow their product's unit price.
+ALTER TABLE items ADD COLUMN unit_price_override BIGINT NULL;
+
+UPDATE items i
+SET unit_price_override = i.unit_price
+FROM products p
+WHERE i.product_id = p.id AND i.unit_price <> p.unit_price;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE items DROP COLUMN IF EXISTS unit_price_override;
+-- +goose StatementEnd
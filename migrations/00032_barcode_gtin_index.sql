@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- EAN-13, UPC-A and GTIN-14 codes of the same number identify the same trade
+-- item, so they are unique once padded to fourteen digits.
+CREATE UNIQUE INDEX idx_item_barcodes_gtin ON item_barcodes(organization_id, LPAD(code, 14, '0'))
+    WHERE symbology IN ('ean13', 'upca', 'gtin14');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_item_barcodes_gtin;
+-- +goose StatementEnd
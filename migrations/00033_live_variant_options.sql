@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Trashed variants no longer hold their option values, so generating variants
+-- again can replace them.
+DROP INDEX IF EXISTS idx_items_product_options;
+CREATE UNIQUE INDEX idx_items_product_options ON items(product_id, option_values) WHERE product_id IS NOT NULL AND deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_items_product_options;
+CREATE UNIQUE INDEX idx_items_product_options ON items(product_id, option_values) WHERE product_id IS NOT NULL;
+-- +goose StatementEnd
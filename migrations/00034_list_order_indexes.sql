@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Item, category and location listings page through an organization's rows in
+-- (created_at, id) order, and only items and categories hide deleted rows.
+CREATE INDEX idx_items_organization_created ON items(organization_id, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_categories_organization_created ON categories(organization_id, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_locations_organization_created ON locations(organization_id, created_at, id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_locations_organization_created;
+DROP INDEX IF EXISTS idx_categories_organization_created;
+DROP INDEX IF EXISTS idx_items_organization_created;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Attributes a product shares with its variants, copied onto each variant it
+-- generates.
+ALTER TABLE products ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE products DROP COLUMN IF EXISTS attributes;
+-- +goose StatementEnd